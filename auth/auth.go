@@ -0,0 +1,96 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/shakilbd009/go-cloud/cloud"
+)
+
+//ErrUnauthenticated is returned when a request carries no valid credentials.
+var ErrUnauthenticated = errors.New("missing or invalid credentials")
+
+//Principal object is the authenticated caller.
+type Principal struct {
+	Subject string   `json:"subject"`
+	Roles   []string `json:"roles"`
+}
+
+//Authenticator identifies the caller of a request.
+type Authenticator interface {
+	Authenticate(r *http.Request) (*Principal, error)
+}
+
+//BearerToken returns the token of an "Authorization: Bearer" header.
+func BearerToken(r *http.Request) (string, bool) {
+	header := r.Header.Get("Authorization")
+	if len(header) < 7 || !strings.EqualFold(header[:7], "bearer ") {
+		return "", false
+	}
+	return strings.TrimSpace(header[7:]), true
+}
+
+//StaticTokens authenticates API tokens, keyed by the hex SHA-256 of the token so no plain token sits in config.
+type StaticTokens map[string]Principal
+
+//Authenticate looks up the bearer token of r.
+func (s StaticTokens) Authenticate(r *http.Request) (*Principal, error) {
+
+	token, ok := BearerToken(r)
+	if !ok {
+		return nil, ErrUnauthenticated
+	}
+	sum := sha256.Sum256([]byte(token))
+	hash := hex.EncodeToString(sum[:])
+	for key, p := range s {
+		if subtle.ConstantTimeCompare([]byte(strings.ToLower(key)), []byte(hash)) == 1 {
+			principal := p
+			return &principal, nil
+		}
+	}
+	return nil, ErrUnauthenticated
+}
+
+//Chain tries each Authenticator in turn and returns the first principal found.
+type Chain []Authenticator
+
+//Authenticate returns the first principal any authenticator accepts.
+func (c Chain) Authenticate(r *http.Request) (*Principal, error) {
+	for _, a := range c {
+		if p, err := a.Authenticate(r); err == nil {
+			return p, nil
+		}
+	}
+	return nil, ErrUnauthenticated
+}
+
+type principalKey struct{}
+
+//WithPrincipal returns a copy of ctx carrying p.
+func WithPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+//FromContext returns the principal attached to ctx, if any.
+func FromContext(ctx context.Context) (*Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(*Principal)
+	return p, ok && p != nil
+}
+
+//Middleware rejects unauthenticated requests with 401 and attaches the principal to the others.
+func Middleware(a Authenticator, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p, err := a.Authenticate(r)
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="go-cloud"`)
+			cloud.WriteError(w, http.StatusUnauthorized, err)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(WithPrincipal(r.Context(), p)))
+	})
+}
@@ -0,0 +1,182 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+)
+
+//JWK object is a single RSA key of a JSON Web Key Set.
+type JWK struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Alg string `json:"alg,omitempty"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+//JWKS object is a JSON Web Key Set.
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+//LoadJWKS reads the RSA keys of the JWKS file at path, keyed by kid.
+func LoadJWKS(path string) (map[string]*rsa.PublicKey, error) {
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	set := JWKS{}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, err
+	}
+	keys := make(map[string]*rsa.PublicKey)
+	for _, k := range set.Keys {
+		if k.Kty != "RSA" {
+			continue
+		}
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("invalid modulus of key %s: %w", k.Kid, err)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, fmt.Errorf("invalid exponent of key %s: %w", k.Kid, err)
+		}
+		keys[k.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no RSA keys found in %s", path)
+	}
+	return keys, nil
+}
+
+//JWTVerifier authenticates RS256 bearer tokens signed by a key of a local JWKS.
+type JWTVerifier struct {
+	Keys       map[string]*rsa.PublicKey
+	Issuer     string
+	Audience   string
+	RolesClaim string
+	Now        func() time.Time
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+//Authenticate verifies the bearer token of r.
+func (v *JWTVerifier) Authenticate(r *http.Request) (*Principal, error) {
+
+	token, ok := BearerToken(r)
+	if !ok {
+		return nil, ErrUnauthenticated
+	}
+	return v.Verify(token)
+}
+
+//Verify checks the signature and standard claims of token and returns its principal.
+func (v *JWTVerifier) Verify(token string) (*Principal, error) {
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed JWT")
+	}
+	header := jwtHeader{}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, err
+	}
+	if header.Alg != "RS256" {
+		return nil, fmt.Errorf("unsupported JWT algorithm %q", header.Alg)
+	}
+	key, ok := v.Keys[header.Kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown JWT key id %q", header.Kid)
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, sum[:], sig); err != nil {
+		return nil, errors.New("invalid JWT signature")
+	}
+	claims := make(map[string]interface{})
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, err
+	}
+	if err := v.checkClaims(claims); err != nil {
+		return nil, err
+	}
+	sub, _ := claims["sub"].(string)
+	rolesClaim := v.RolesClaim
+	if rolesClaim == "" {
+		rolesClaim = "roles"
+	}
+	return &Principal{Subject: sub, Roles: stringList(claims[rolesClaim])}, nil
+}
+
+func (v *JWTVerifier) checkClaims(claims map[string]interface{}) error {
+
+	now := time.Now
+	if v.Now != nil {
+		now = v.Now
+	}
+	unix := float64(now().Unix())
+	exp, ok := claims["exp"].(float64)
+	if !ok || unix >= exp {
+		return errors.New("JWT is expired")
+	}
+	if nbf, ok := claims["nbf"].(float64); ok && unix < nbf {
+		return errors.New("JWT is not valid yet")
+	}
+	if v.Issuer != "" {
+		if iss, _ := claims["iss"].(string); iss != v.Issuer {
+			return errors.New("JWT issuer is not trusted")
+		}
+	}
+	if v.Audience != "" {
+		for _, aud := range stringList(claims["aud"]) {
+			if aud == v.Audience {
+				return nil
+			}
+		}
+		return errors.New("JWT audience does not match")
+	}
+	return nil
+}
+
+func decodeSegment(seg string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+//stringList accepts a claim holding a string, a space separated string or a list of strings.
+func stringList(claim interface{}) []string {
+	switch c := claim.(type) {
+	case string:
+		return strings.Fields(c)
+	case []interface{}:
+		list := make([]string, 0, len(c))
+		for _, v := range c {
+			if s, ok := v.(string); ok {
+				list = append(list, s)
+			}
+		}
+		return list
+	}
+	return nil
+}
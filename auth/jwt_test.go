@@ -0,0 +1,130 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+//sign returns an RS256 JWT with the given header and claims signed by key.
+func sign(t *testing.T, key *rsa.PrivateKey, header, claims interface{}) string {
+
+	segment := func(v interface{}) string {
+		data, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return base64.RawURLEncoding.EncodeToString(data)
+	}
+	signed := segment(header) + "." + segment(claims)
+	sum := sha256.Sum256([]byte(signed))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, sum[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func TestJWTVerifier(t *testing.T) {
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Unix(1600000000, 0)
+	v := &JWTVerifier{
+		Keys:     map[string]*rsa.PublicKey{"k1": &key.PublicKey},
+		Issuer:   "https://idp.example",
+		Audience: "go-cloud",
+		Now:      func() time.Time { return now },
+	}
+	header := map[string]string{"alg": "RS256", "kid": "k1"}
+	claims := func(change func(map[string]interface{})) map[string]interface{} {
+		c := map[string]interface{}{
+			"sub":   "alice",
+			"iss":   "https://idp.example",
+			"aud":   []string{"other", "go-cloud"},
+			"exp":   now.Add(time.Hour).Unix(),
+			"roles": []string{"dev", "viewer"},
+		}
+		if change != nil {
+			change(c)
+		}
+		return c
+	}
+	valid := sign(t, key, header, claims(nil))
+	parts := strings.Split(valid, ".")
+	admin := sign(t, key, header, claims(func(c map[string]interface{}) { c["roles"] = []string{"admin"} }))
+	tampered := parts[0] + "." + strings.Split(admin, ".")[1] + "." + parts[2]
+	tests := []struct {
+		name    string
+		token   string
+		want    *Principal
+		wantErr bool
+	}{
+		{name: "valid", token: valid, want: &Principal{Subject: "alice", Roles: []string{"dev", "viewer"}}},
+		{name: "audience as a string and roles space separated",
+			token: sign(t, key, header, claims(func(c map[string]interface{}) { c["aud"], c["roles"] = "go-cloud", "dev viewer" })),
+			want:  &Principal{Subject: "alice", Roles: []string{"dev", "viewer"}}},
+		{name: "not before in the past", token: sign(t, key, header, claims(func(c map[string]interface{}) { c["nbf"] = now.Add(-time.Minute).Unix() })),
+			want: &Principal{Subject: "alice", Roles: []string{"dev", "viewer"}}},
+		{name: "malformed", token: "abc.def", wantErr: true},
+		{name: "bad header", token: "!!." + parts[1] + "." + parts[2], wantErr: true},
+		{name: "unsupported algorithm", token: sign(t, key, map[string]string{"alg": "HS256", "kid": "k1"}, claims(nil)), wantErr: true},
+		{name: "unknown key id", token: sign(t, key, map[string]string{"alg": "RS256", "kid": "k2"}, claims(nil)), wantErr: true},
+		{name: "signed by another key", token: sign(t, other, header, claims(nil)), wantErr: true},
+		{name: "tampered claims", token: tampered, wantErr: true},
+		{name: "expired", token: sign(t, key, header, claims(func(c map[string]interface{}) { c["exp"] = now.Unix() })), wantErr: true},
+		{name: "no expiry", token: sign(t, key, header, claims(func(c map[string]interface{}) { delete(c, "exp") })), wantErr: true},
+		{name: "not valid yet", token: sign(t, key, header, claims(func(c map[string]interface{}) { c["nbf"] = now.Add(time.Minute).Unix() })), wantErr: true},
+		{name: "untrusted issuer", token: sign(t, key, header, claims(func(c map[string]interface{}) { c["iss"] = "https://evil.example" })), wantErr: true},
+		{name: "wrong audience", token: sign(t, key, header, claims(func(c map[string]interface{}) { c["aud"] = "other" })), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := v.Verify(tt.token)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Verify() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Verify() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestJWTVerifierRolesClaim(t *testing.T) {
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v := &JWTVerifier{Keys: map[string]*rsa.PublicKey{"k1": &key.PublicKey}, RolesClaim: "groups"}
+	token := sign(t, key, map[string]string{"alg": "RS256", "kid": "k1"},
+		map[string]interface{}{"sub": "bob", "exp": time.Now().Add(time.Hour).Unix(), "groups": []string{"admin"}, "roles": []string{"viewer"}})
+	r, _ := http.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Authorization", "Bearer "+token)
+	got, err := v.Authenticate(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (&Principal{Subject: "bob", Roles: []string{"admin"}}); !reflect.DeepEqual(got, want) {
+		t.Errorf("Authenticate() = %+v, want %+v", got, want)
+	}
+	r.Header.Del("Authorization")
+	if _, err := v.Authenticate(r); err != ErrUnauthenticated {
+		t.Errorf("Authenticate() without token error = %v, want %v", err, ErrUnauthenticated)
+	}
+}
@@ -0,0 +1,118 @@
+package auth
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"strings"
+)
+
+//Actions checked by the Policy.
+const (
+	ActionRead      = "read"
+	ActionPlan      = "plan"
+	ActionProvision = "provision"
+	ActionDelete    = "delete"
+)
+
+//Rule object grants actions on providers and environments, "*" matching everything.
+type Rule struct {
+	Actions      []string `json:"actions"`
+	Providers    []string `json:"providers,omitempty"`
+	Environments []string `json:"environments,omitempty"`
+}
+
+func (r Rule) allows(action, provider, env string) bool {
+	return contains(r.Actions, action) &&
+		(len(r.Providers) == 0 || contains(r.Providers, provider)) &&
+		(len(r.Environments) == 0 || contains(r.Environments, env))
+}
+
+func contains(list []string, v string) bool {
+	for _, item := range list {
+		if item == "*" || strings.EqualFold(item, v) {
+			return true
+		}
+	}
+	return false
+}
+
+//Policy maps role names to the rules they grant.
+type Policy struct {
+	Roles map[string][]Rule `json:"roles"`
+}
+
+//Allowed reports whether any role of p grants action on provider and env.
+func (pol Policy) Allowed(p *Principal, action, provider, env string) bool {
+	if p == nil {
+		return false
+	}
+	for _, role := range p.Roles {
+		for _, rule := range pol.Roles[role] {
+			if rule.allows(action, provider, env) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+//AllowedAnywhere reports whether any role of p grants action on provider in at least one environment,
+//for checks made before the environment of what a request targets is known.
+func (pol Policy) AllowedAnywhere(p *Principal, action, provider string) bool {
+	if p == nil {
+		return false
+	}
+	for _, role := range p.Roles {
+		for _, rule := range pol.Roles[role] {
+			if contains(rule.Actions, action) && (len(rule.Providers) == 0 || contains(rule.Providers, provider)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+//JWTConfig object configures JWT verification against a local JWKS file.
+type JWTConfig struct {
+	JWKSFile   string `json:"jwksFile"`
+	Issuer     string `json:"issuer,omitempty"`
+	Audience   string `json:"audience,omitempty"`
+	RolesClaim string `json:"rolesClaim,omitempty"`
+}
+
+//Config object is the authentication and authorization file.
+type Config struct {
+	Tokens StaticTokens      `json:"tokens,omitempty"`
+	JWT    *JWTConfig        `json:"jwt,omitempty"`
+	Roles  map[string][]Rule `json:"roles"`
+}
+
+//Load reads the config at path and returns its Authenticator and Policy.
+func Load(path string) (Authenticator, Policy, error) {
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, Policy{}, err
+	}
+	cfg := Config{}
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, Policy{}, err
+	}
+	chain := make(Chain, 0, 2)
+	if len(cfg.Tokens) > 0 {
+		chain = append(chain, cfg.Tokens)
+	}
+	if cfg.JWT != nil {
+		keys, err := LoadJWKS(cfg.JWT.JWKSFile)
+		if err != nil {
+			return nil, Policy{}, err
+		}
+		chain = append(chain, &JWTVerifier{
+			Keys:       keys,
+			Issuer:     cfg.JWT.Issuer,
+			Audience:   cfg.JWT.Audience,
+			RolesClaim: cfg.JWT.RolesClaim,
+		})
+	}
+	return chain, Policy{Roles: cfg.Roles}, nil
+}
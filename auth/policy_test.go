@@ -0,0 +1,69 @@
+package auth
+
+import "testing"
+
+func TestPolicyAllowed(t *testing.T) {
+
+	pol := Policy{Roles: map[string][]Rule{
+		"viewer":   {{Actions: []string{ActionRead}}},
+		"dev":      {{Actions: []string{ActionPlan, ActionProvision, ActionDelete}, Providers: []string{"gcp", "AWS"}, Environments: []string{"dev"}}},
+		"admin":    {{Actions: []string{"*"}, Providers: []string{"*"}, Environments: []string{"*"}}},
+		"prod-ops": {{Actions: []string{ActionDelete}, Environments: []string{"prod"}}, {Actions: []string{ActionRead}, Providers: []string{"azure"}}},
+	}}
+	tests := []struct {
+		name                  string
+		principal             *Principal
+		action, provider, env string
+		want                  bool
+	}{
+		{name: "no principal", action: ActionRead, provider: "gcp", env: "dev"},
+		{name: "no roles", principal: &Principal{Subject: "bob"}, action: ActionRead, provider: "gcp", env: "dev"},
+		{name: "unknown role", principal: &Principal{Roles: []string{"intern"}}, action: ActionRead, provider: "gcp", env: "dev"},
+		{name: "empty lists match any provider and env", principal: &Principal{Roles: []string{"viewer"}}, action: ActionRead, provider: "azure", env: "prod", want: true},
+		{name: "action not granted", principal: &Principal{Roles: []string{"viewer"}}, action: ActionDelete, provider: "gcp", env: "dev"},
+		{name: "provider and env granted", principal: &Principal{Roles: []string{"dev"}}, action: ActionProvision, provider: "gcp", env: "dev", want: true},
+		{name: "provider is case insensitive", principal: &Principal{Roles: []string{"dev"}}, action: ActionPlan, provider: "aws", env: "DEV", want: true},
+		{name: "provider not granted", principal: &Principal{Roles: []string{"dev"}}, action: ActionProvision, provider: "azure", env: "dev"},
+		{name: "env not granted", principal: &Principal{Roles: []string{"dev"}}, action: ActionProvision, provider: "gcp", env: "prod"},
+		{name: "wildcards", principal: &Principal{Roles: []string{"admin"}}, action: ActionDelete, provider: "azure", env: "prod", want: true},
+		{name: "any rule of a role", principal: &Principal{Roles: []string{"prod-ops"}}, action: ActionRead, provider: "azure", env: "dev", want: true},
+		{name: "rules are not merged", principal: &Principal{Roles: []string{"prod-ops"}}, action: ActionRead, provider: "gcp", env: "prod"},
+		{name: "any role of the principal", principal: &Principal{Roles: []string{"viewer", "dev"}}, action: ActionDelete, provider: "gcp", env: "dev", want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := pol.Allowed(tt.principal, tt.action, tt.provider, tt.env); got != tt.want {
+				t.Errorf("Allowed(%s, %s, %s) = %v, want %v", tt.action, tt.provider, tt.env, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPolicyAllowedAnywhere(t *testing.T) {
+
+	pol := Policy{Roles: map[string][]Rule{
+		"viewer":  {{Actions: []string{ActionRead}}},
+		"dev":     {{Actions: []string{ActionRead, ActionDelete}, Providers: []string{"gcp"}, Environments: []string{"dev"}}},
+		"any-env": {{Actions: []string{ActionRead}, Providers: []string{"gcp"}, Environments: []string{}}},
+	}}
+	tests := []struct {
+		name             string
+		principal        *Principal
+		action, provider string
+		want             bool
+	}{
+		{name: "no principal", action: ActionRead, provider: "gcp"},
+		{name: "any provider", principal: &Principal{Roles: []string{"viewer"}}, action: ActionRead, provider: "aws", want: true},
+		{name: "limited to one environment", principal: &Principal{Roles: []string{"dev"}}, action: ActionDelete, provider: "GCP", want: true},
+		{name: "other provider", principal: &Principal{Roles: []string{"dev"}}, action: ActionRead, provider: "aws"},
+		{name: "action not granted", principal: &Principal{Roles: []string{"dev"}}, action: ActionProvision, provider: "gcp"},
+		{name: "empty environment list matches any", principal: &Principal{Roles: []string{"any-env"}}, action: ActionRead, provider: "gcp", want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := pol.AllowedAnywhere(tt.principal, tt.action, tt.provider); got != tt.want {
+				t.Errorf("AllowedAnywhere(%s, %s) = %v, want %v", tt.action, tt.provider, got, tt.want)
+			}
+		})
+	}
+}
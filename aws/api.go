@@ -2,17 +2,22 @@ package aws
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
-	"math/rand"
 	"sort"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/awserr"
 	"github.com/aws/aws-sdk-go-v2/aws/external"
 	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/shakilbd009/go-cloud/bootstrap"
+	"github.com/shakilbd009/go-cloud/cloud"
+	"github.com/shakilbd009/go-cloud/naming"
 )
 
 //GetNewSession return a aws.Config or an error
@@ -25,122 +30,124 @@ func GetNewSession(region string) (aws.Config, error) {
 	return cfg, nil
 }
 
-//GetSubnet retruns a subnetID with given tier name or an error if any
+//tagFilter returns an EC2 filter on tag key, "Name" if key is empty. value may use the * and ? wildcards.
+func tagFilter(key, value string) ec2.Filter {
+	if key == "" {
+		key = "Name"
+	}
+	return ec2.Filter{Name: aws.String("tag:" + key), Values: []string{value}}
+}
+
+//oneMatch returns an error unless ids holds exactly one resource.
+func oneMatch(kind, name string, ids []string) error {
+	switch len(ids) {
+	case 0:
+		return fmt.Errorf("%s not found with name %s", kind, name)
+	case 1:
+		return nil
+	}
+	return fmt.Errorf("%s name %s is ambiguous, it matches %s", kind, name, strings.Join(ids, ", "))
+}
+
+//GetSubnet retruns a subnetID matching the configured subnet name or an error if any
 func (r *AWSrequest) GetSubnet() error {
 
 	subnet := ec2.New(r.Config)
-	req := subnet.DescribeSubnetsRequest(nil)
-	resp, err := req.Send(r.Ctx)
-	if err != nil {
+	req := subnet.DescribeSubnetsRequest(&ec2.DescribeSubnetsInput{
+		Filters: []ec2.Filter{
+			{Name: aws.String("vpc-id"), Values: []string{*r.VPCid}},
+			tagFilter(r.Network.SubnetTag, r.Network.Subnet),
+		},
+	})
+	subnets := make([]ec2.Subnet, 0)
+	pages := ec2.NewDescribeSubnetsPaginator(req)
+	for pages.Next(r.Ctx) {
+		subnets = append(subnets, pages.CurrentPage().Subnets...)
+	}
+	if err := pages.Err(); err != nil {
 		return err
 	}
-	for _, sub := range resp.Subnets {
-		if *sub.VpcId == *r.VPCid {
-			switch r.Tier {
-			case "app":
-				if strings.Contains(*sub.Tags[0].Value, r.Tier) {
-					r.SubnetID = sub.SubnetId
-					return nil
-				}
-			case "web":
-				if strings.Contains(*sub.Tags[0].Value, r.Tier) {
-					r.SubnetID = sub.SubnetId
-					return nil
-				}
-			case "db":
-				if strings.Contains(*sub.Tags[0].Value, r.Tier) {
-					r.SubnetID = sub.SubnetId
-					return nil
-				}
-			}
-		}
+	ids := make([]string, 0, len(subnets))
+	for _, sub := range subnets {
+		ids = append(ids, *sub.SubnetId)
 	}
-	return errors.New("Subnet not found with given tier name")
+	if err := oneMatch("Subnet", r.Network.Subnet, ids); err != nil {
+		return err
+	}
+	r.SubnetID = subnets[0].SubnetId
+	r.AvailabilityZone = subnets[0].AvailabilityZone
+	return nil
 }
 
-//GetVPCs returns all vpcs in the region.
-func getVPCs(ctx context.Context, cfg aws.Config) ([]ec2.Vpc, error) {
+//getVPCs returns the vpcs in the region matching filters.
+func getVPCs(ctx context.Context, cfg aws.Config, filters ...ec2.Filter) ([]ec2.Vpc, error) {
 
 	vpc := ec2.New(cfg)
-	input := &ec2.DescribeVpcsInput{}
-	req := vpc.DescribeVpcsRequest(input)
-	resp, err := req.Send(ctx)
-	if err != nil {
+	input := &ec2.DescribeVpcsInput{Filters: filters}
+	vpcs := make([]ec2.Vpc, 0)
+	pages := ec2.NewDescribeVpcsPaginator(vpc.DescribeVpcsRequest(input))
+	for pages.Next(ctx) {
+		vpcs = append(vpcs, pages.CurrentPage().Vpcs...)
+	}
+	if err := pages.Err(); err != nil {
 		return nil, err
 	}
-	return resp.Vpcs, nil
+	return vpcs, nil
 }
 
-//GetSecurityGroup returns the SG id for the given tier or an error if any.
+//GetSecurityGroup returns the SG id matching the configured security group by group name, or by tag when a securityGroupTag is configured, or an error if any.
 func (r *AWSrequest) GetSecurityGroup() error {
 
-	tier := strings.ToLower(r.Tier)
 	sg := ec2.New(r.Config)
-	input := &ec2.DescribeSecurityGroupsInput{}
-	req := sg.DescribeSecurityGroupsRequest(input)
-	reps, err := req.Send(r.Ctx)
-	if err != nil {
+	byName := ec2.Filter{Name: aws.String("group-name"), Values: []string{r.Network.SecurityGroup}}
+	if r.Network.SecurityGroupTag != "" {
+		byName = tagFilter(r.Network.SecurityGroupTag, r.Network.SecurityGroup)
+	}
+	input := &ec2.DescribeSecurityGroupsInput{
+		Filters: []ec2.Filter{
+			{Name: aws.String("vpc-id"), Values: []string{*r.VPCid}},
+			byName,
+		},
+	}
+	groups := make([]ec2.SecurityGroup, 0)
+	pages := ec2.NewDescribeSecurityGroupsPaginator(sg.DescribeSecurityGroupsRequest(input))
+	for pages.Next(r.Ctx) {
+		groups = append(groups, pages.CurrentPage().SecurityGroups...)
+	}
+	if err := pages.Err(); err != nil {
 		return err
 	}
-	for _, sg := range reps.SecurityGroups {
-		if *sg.VpcId == *r.VPCid {
-			switch tier {
-			case "app":
-				if strings.Contains(*sg.GroupName, tier) {
-					r.SecurityGID = sg.GroupId
-					return nil
-				}
-			case "db":
-				if strings.Contains(*sg.GroupName, tier) {
-					r.SecurityGID = sg.GroupId
-					return nil
-				}
-			case "web":
-				if strings.Contains(*sg.GroupName, tier) {
-					r.SecurityGID = sg.GroupId
-					return nil
-				}
-			}
-		}
+	ids := make([]string, 0, len(groups))
+	for _, sg := range groups {
+		ids = append(ids, *sg.GroupId)
+	}
+	if err := oneMatch("SecurityGroup", r.Network.SecurityGroup, ids); err != nil {
+		return err
 	}
-	return errors.New("SecurityGroup not found with the tier provided")
+	r.SecurityGID = groups[0].GroupId
+	return nil
 }
 
-//GetVpcID returns VPCid for a specific environment.
+//GetVpcID returns VPCid matching the configured network of the environment.
 func (r *AWSrequest) GetVpcID() error {
 
-	env := strings.ToLower(r.Environment)
-	vpcs, err := getVPCs(r.Ctx, r.Config)
+	vpcs, err := getVPCs(r.Ctx, r.Config, tagFilter(r.Network.NetworkTag, r.Network.Network))
 	if err != nil {
 		return err
 	}
-
+	ids := make([]string, 0, len(vpcs))
 	for _, vpc := range vpcs {
-
-		switch env {
-		case "nonprod":
-			if strings.Contains(*vpc.Tags[0].Value, "nonProd") {
-				r.VPCid = vpc.VpcId
-				return nil
-			}
-		case "prod":
-			if strings.Contains(*vpc.Tags[0].Value, "prod") {
-				r.VPCid = vpc.VpcId
-				return nil
-			}
-		case "base":
-			if strings.Contains(*vpc.Tags[0].Value, "base") {
-				r.VPCid = vpc.VpcId
-				return nil
-			}
-		}
+		ids = append(ids, *vpc.VpcId)
 	}
-
-	return errors.New("only dev, prod, base is allowed as enviroment")
+	if err := oneMatch("VPC", r.Network.Network, ids); err != nil {
+		return err
+	}
+	r.VPCid = vpcs[0].VpcId
+	return nil
 }
 
-//CreateSG creates a new Security group.
-func CreateSG(cfg aws.Config, sgn, vpcID, sgDesc string) (*ec2.CreateSecurityGroupResponse, error) {
+//CreateSG creates a new Security group and returns its ID.
+func CreateSG(ctx context.Context, cfg aws.Config, sgn, vpcID, sgDesc string) (string, error) {
 
 	input := &ec2.CreateSecurityGroupInput{
 		Description: aws.String(sgDesc),
@@ -149,60 +156,138 @@ func CreateSG(cfg aws.Config, sgn, vpcID, sgDesc string) (*ec2.CreateSecurityGro
 	}
 	SG := ec2.New(cfg)
 	req := SG.CreateSecurityGroupRequest(input)
-	res, err := req.Send(context.Background())
+	res, err := req.Send(ctx)
 	if err != nil {
-		return nil, err
+		return "", fmt.Errorf("could not create security group %s: %w", sgn, err)
 	}
-	return res, nil
+	return *res.GroupId, nil
+}
+
+//AuthorizeIngress adds inbound rules to a security group.
+func AuthorizeIngress(ctx context.Context, cfg aws.Config, groupID string, perms []ec2.IpPermission) error {
+
+	input := &ec2.AuthorizeSecurityGroupIngressInput{
+		GroupId:       aws.String(groupID),
+		IpPermissions: perms,
+	}
+	if _, err := ec2.New(cfg).AuthorizeSecurityGroupIngressRequest(input).Send(ctx); err != nil {
+		return fmt.Errorf("could not add rules to security group %s: %w", groupID, err)
+	}
+	return nil
+}
+
+//DeleteSG deletes a security group.
+func DeleteSG(ctx context.Context, cfg aws.Config, groupID string) error {
+	_, err := ec2.New(cfg).DeleteSecurityGroupRequest(&ec2.DeleteSecurityGroupInput{GroupId: aws.String(groupID)}).Send(ctx)
+	return err
 }
 
 //CreateVPC creates a new VPC.
-func CreateVPC(cfg aws.Config, block string) (ec2.CreateVpcResponse, error) {
+func CreateVPC(ctx context.Context, cfg aws.Config, block string) (ec2.Vpc, error) {
 
 	input := &ec2.CreateVpcInput{
 		CidrBlock: aws.String(block),
 	}
 	VPC := ec2.New(cfg)
 	req := VPC.CreateVpcRequest(input)
-	res, err := req.Send(context.TODO())
+	res, err := req.Send(ctx)
 	if err != nil {
-		return ec2.CreateVpcResponse{}, err
+		return ec2.Vpc{}, fmt.Errorf("could not create VPC %s: %w", block, err)
 	}
-	return *res, nil
+	return *res.Vpc, nil
 }
 
-//CreateSubnet creates a new subnet.
-func CreateSubnet(ctx context.Context, cfg aws.Config, vpc *string, az []ec2.AvailabilityZone, cidr string) (*ec2.Subnet, error) {
+//DeleteVPC deletes a VPC.
+func DeleteVPC(ctx context.Context, cfg aws.Config, vpcID string) error {
+	_, err := ec2.New(cfg).DeleteVpcRequest(&ec2.DeleteVpcInput{VpcId: aws.String(vpcID)}).Send(ctx)
+	return err
+}
+
+//CreateSubnet creates a new subnet in the given AZ.
+func CreateSubnet(ctx context.Context, cfg aws.Config, vpc, az, cidr string) (ec2.Subnet, error) {
 
 	sub := ec2.New(cfg)
 	input := &ec2.CreateSubnetInput{
-		AvailabilityZone: az[rand.Intn(len(az)-1)].ZoneName,
-		VpcId:            vpc,
+		AvailabilityZone: aws.String(az),
+		VpcId:            aws.String(vpc),
 		CidrBlock:        aws.String(cidr),
 	}
 	req := sub.CreateSubnetRequest(input)
 	res, err := req.Send(ctx)
 	if err != nil {
-		return &ec2.Subnet{}, err
+		return ec2.Subnet{}, fmt.Errorf("could not create subnet %s: %w", cidr, err)
+	}
+	return *res.Subnet, nil
+}
+
+//DeleteSubnet deletes a subnet.
+func DeleteSubnet(ctx context.Context, cfg aws.Config, subnetID string) error {
+	_, err := ec2.New(cfg).DeleteSubnetRequest(&ec2.DeleteSubnetInput{SubnetId: aws.String(subnetID)}).Send(ctx)
+	return err
+}
+
+//TagResource adds tags to an EC2 resource.
+func TagResource(ctx context.Context, cfg aws.Config, id string, tags map[string]string) error {
+
+	input := &ec2.CreateTagsInput{Resources: []string{id}}
+	for k, v := range tags {
+		input.Tags = append(input.Tags, ec2.Tag{Key: aws.String(k), Value: aws.String(v)})
+	}
+	if _, err := ec2.New(cfg).CreateTagsRequest(input).Send(ctx); err != nil {
+		return fmt.Errorf("could not tag %s: %w", id, err)
 	}
-	return res.Subnet, nil
+	return nil
 }
 
-//GetAZs gets the AZs for a region.
-func GetAZs(cfg aws.Config) ([]ec2.AvailabilityZone, error) {
+//GetAZs gets the available AZs for a region.
+func GetAZs(ctx context.Context, cfg aws.Config) ([]string, error) {
 
 	az := ec2.New(cfg)
-	input := &ec2.DescribeAvailabilityZonesInput{}
+	input := &ec2.DescribeAvailabilityZonesInput{
+		Filters: []ec2.Filter{{Name: aws.String("state"), Values: []string{"available"}}},
+	}
 	req := az.DescribeAvailabilityZonesRequest(input)
-	res, err := req.Send(context.TODO())
+	res, err := req.Send(ctx)
 	if err != nil {
 		return nil, err
 	}
-	return res.AvailabilityZones, nil
+	zones := make([]string, 0, len(res.AvailabilityZones))
+	for _, zone := range res.AvailabilityZones {
+		zones = append(zones, aws.StringValue(zone.ZoneName))
+	}
+	return zones, nil
+}
+
+//ErrKeyPairExists is returned when creating or importing a key pair whose name is taken in the region.
+var ErrKeyPairExists = errors.New("key pair already exists")
+
+//ErrKeyPairNotFound is returned when looking up a key pair the region does not have.
+var ErrKeyPairNotFound = errors.New("key pair not found")
+
+//KeyPair object describes an EC2 key pair.
+type KeyPair struct {
+	Name        string `json:"name"`
+	ID          string `json:"id,omitempty"`
+	Fingerprint string `json:"fingerprint,omitempty"`
+	Region      string `json:"region"`
+	//Environment is read from the env tag of the key pair.
+	Environment string `json:"env,omitempty"`
+	//PrivateKeyRef is the secret reference of the private key of key pairs created by the API.
+	PrivateKeyRef string `json:"privateKeyRef,omitempty"`
+}
+
+//privateKeyTag is the key pair tag the secret reference of its private key is kept in.
+const privateKeyTag = "PrivateKeyRef"
+
+func keyPairError(name string, err error) error {
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == "InvalidKeyPair.Duplicate" {
+		return fmt.Errorf("%w: %s", ErrKeyPairExists, name)
+	}
+	return err
 }
 
-//CreateKey creates a new keypair for login.
-func CreateKey(ctx context.Context, cfg aws.Config, keyPair string) (string, error) {
+//CreateKey creates a new keypair for login and returns it with its private key.
+func CreateKey(ctx context.Context, cfg aws.Config, keyPair string) (KeyPair, string, error) {
 
 	key := ec2.New(cfg)
 	input := &ec2.CreateKeyPairInput{
@@ -211,29 +296,123 @@ func CreateKey(ctx context.Context, cfg aws.Config, keyPair string) (string, err
 	req := key.CreateKeyPairRequest(input)
 	res, err := req.Send(ctx)
 	if err != nil {
-		return "", err
+		return KeyPair{}, "", keyPairError(keyPair, err)
 	}
-	return *res.KeyName, nil
+	return KeyPair{
+		Name:        aws.StringValue(res.KeyName),
+		ID:          aws.StringValue(res.KeyPairId),
+		Fingerprint: aws.StringValue(res.KeyFingerprint),
+		Region:      cfg.Region,
+	}, aws.StringValue(res.KeyMaterial), nil
 }
 
-//GetAllKeys returns a ssh keypair for login or an error if any.
-func GetAllKeys(ctx context.Context, cfg aws.Config, keyPair string) ([]ec2.KeyPairInfo, error) {
+//ImportKey imports an authorized_keys public key as a keypair.
+func ImportKey(ctx context.Context, cfg aws.Config, keyPair, publicKey string) (KeyPair, error) {
 
 	key := ec2.New(cfg)
-	input := &ec2.DescribeKeyPairsInput{
-		Filters: []ec2.Filter{
+	input := &ec2.ImportKeyPairInput{
+		KeyName:           aws.String(keyPair),
+		PublicKeyMaterial: []byte(publicKey),
+	}
+	req := key.ImportKeyPairRequest(input)
+	res, err := req.Send(ctx)
+	if err != nil {
+		return KeyPair{}, keyPairError(keyPair, err)
+	}
+	return KeyPair{
+		Name:        aws.StringValue(res.KeyName),
+		ID:          aws.StringValue(res.KeyPairId),
+		Fingerprint: aws.StringValue(res.KeyFingerprint),
+		Region:      cfg.Region,
+	}, nil
+}
+
+//GetAllKeys returns the ssh keypairs named keyPair, every keypair of the region if it is empty, or an error if any.
+//DescribeKeyPairs is not paginated by EC2, it returns every key pair of the region in one response.
+func GetAllKeys(ctx context.Context, cfg aws.Config, keyPair string) ([]KeyPair, error) {
+
+	key := ec2.New(cfg)
+	input := &ec2.DescribeKeyPairsInput{}
+	if keyPair != "" {
+		input.Filters = []ec2.Filter{
 			{
-				Name:   aws.String("name"),
+				Name:   aws.String("key-name"),
 				Values: []string{keyPair},
 			},
-		},
+		}
 	}
 	req := key.DescribeKeyPairsRequest(input)
 	res, err := req.Send(ctx)
 	if err != nil {
 		return nil, err
 	}
-	return res.KeyPairs, nil
+	keys := make([]KeyPair, 0, len(res.KeyPairs))
+	for _, kp := range res.KeyPairs {
+		info := KeyPair{
+			Name:        aws.StringValue(kp.KeyName),
+			ID:          aws.StringValue(kp.KeyPairId),
+			Fingerprint: aws.StringValue(kp.KeyFingerprint),
+			Region:      cfg.Region,
+		}
+		for _, tag := range kp.Tags {
+			switch aws.StringValue(tag.Key) {
+			case privateKeyTag:
+				info.PrivateKeyRef = aws.StringValue(tag.Value)
+			case "env":
+				info.Environment = aws.StringValue(tag.Value)
+			}
+		}
+		keys = append(keys, info)
+	}
+	return keys, nil
+}
+
+//DeleteKey deletes a keypair, deleting one that does not exist is not an error.
+func DeleteKey(ctx context.Context, cfg aws.Config, keyPair string) error {
+
+	input := &ec2.DeleteKeyPairInput{
+		KeyName: aws.String(keyPair),
+	}
+	_, err := ec2.New(cfg).DeleteKeyPairRequest(input).Send(ctx)
+	return err
+}
+
+//ImportKeyPair imports the public key of r.SSHKey as an EC2 key pair of the same name, unless the region has it already, and launches with it.
+func (r *AWSrequest) ImportKeyPair() error {
+
+	if r.SSHKey == "" {
+		return nil
+	}
+	existing, err := GetAllKeys(r.Ctx, r.Config, r.SSHKey)
+	if err != nil {
+		return err
+	}
+	if len(existing) == 0 {
+		if _, err := ImportKey(r.Ctx, r.Config, r.SSHKey, r.SSHPublicKey); err != nil && !errors.Is(err, ErrKeyPairExists) {
+			return fmt.Errorf("could not import key pair %s: %w", r.SSHKey, err)
+		}
+	}
+	r.Key = aws.String(r.SSHKey)
+	return nil
+}
+
+//CheckKeyPair returns an error if the key pair the request launches with does not exist in its region.
+func (r *AWSrequest) CheckKeyPair() error {
+
+	if r.Key == nil || r.SSHKey != "" {
+		return nil
+	}
+	existing, err := GetAllKeys(r.Ctx, r.Config, *r.Key)
+	if err != nil {
+		return err
+	}
+	if len(existing) == 0 {
+		return fmt.Errorf("key pair %s does not exist in %s", *r.Key, r.Config.Region)
+	}
+	if r.SSHKeyRef == "" {
+		r.SSHKeyRef = existing[0].PrivateKeyRef
+	}
+	return nil
 }
 
 //PrepareDisks returns a slice of disks of type ec2.BlockDeviceMapping or an error if any.
@@ -265,51 +444,83 @@ func (r *AWSrequest) PrepareDisks() error {
 //GetInstanceName returns instance name following naming standard and error if any.
 func (r *AWSrequest) GetInstanceName() error {
 
-	env := strings.ToLower(r.Environment)
-	os := strings.ToLower(r.Osname)
-	b := "b"
-	d := "d"
-	p := "p"
-	w := "w"
-	x := "x"
-	s := "s"
-	switch {
-	case env == "base":
-		if os == "windows" {
-			r.InstanceName = fmt.Sprintf("%s%s%se%s%s", r.Provider, b, w, d, r.AppCode)
-			return nil
-		}
-		if os == "redhat" || os == "centos" || os == "suse" || os == "debian" || os == "ubuntu" || os == "amazon" {
-			r.InstanceName = fmt.Sprintf("%s%s%sw%s%s", r.Provider, b, x, d, r.AppCode)
-			return nil
-		}
-	case env == "prod":
-		if os == "windows" {
-			r.InstanceName = fmt.Sprintf("%s%s%se%s%s", r.Provider, p, w, p, r.AppCode)
-			return nil
-		}
-		if os == "redhat" || os == "centos" || os == "suse" || os == "debian" || os == "ubuntu" || os == "amazon" {
-			r.InstanceName = fmt.Sprintf("%s%s%se%s%s", r.Provider, p, x, p, r.AppCode)
-			return nil
-		}
-	case env == "dev":
-		if os == "windows" {
-			r.InstanceName = fmt.Sprintf("%s%s%se%s%s", r.Provider, s, w, d, r.AppCode)
-			return nil
-		}
-		if os == "redhat" || os == "centos" || os == "suse" || os == "debian" || os == "ubuntu" || os == "amazon" {
-			r.InstanceName = fmt.Sprintf("%s%s%se%s%s", r.Provider, s, x, d, r.AppCode)
-			return nil
+	namer := r.Namer
+	if namer == nil {
+		namer = naming.Default()
+	}
+	name, err := namer.Prefix(r.Provider, r.Environment, r.Osname, r.AppCode)
+	if err != nil {
+		return err
+	}
+	if err := namer.Validate(r.Provider, r.Osname, name); err != nil {
+		return err
+	}
+	r.InstanceName = name
+	return nil
+}
+
+//InstanceNames returns the Name tags of the live instances whose Name matches pattern, which may use the * and ? wildcards.
+func InstanceNames(ctx context.Context, cfg aws.Config, pattern string) ([]string, error) {
+
+	Ec2 := ec2.New(cfg)
+	input := &ec2.DescribeInstancesInput{
+		Filters: []ec2.Filter{
+			tagFilter("Name", pattern),
+			{
+				Name:   aws.String("instance-state-name"),
+				Values: []string{"pending", "running", "stopping", "stopped", "shutting-down"},
+			},
+		},
+	}
+	names := make([]string, 0)
+	pages := ec2.NewDescribeInstancesPaginator(Ec2.DescribeInstancesRequest(input))
+	for pages.Next(ctx) {
+		for _, res := range pages.CurrentPage().Reservations {
+			for _, inst := range res.Instances {
+				for _, tag := range inst.Tags {
+					if aws.StringValue(tag.Key) == "Name" {
+						names = append(names, aws.StringValue(tag.Value))
+					}
+				}
+			}
 		}
 	}
+	if err := pages.Err(); err != nil {
+		return nil, err
+	}
+	return names, nil
+}
 
-	return errors.New("Instance name could not be generated with given OS details")
+//InstanceExists reports whether a live EC2 instance carries the given Name tag.
+func InstanceExists(ctx context.Context, cfg aws.Config, name string) (bool, error) {
+
+	Ec2 := ec2.New(cfg)
+	input := &ec2.DescribeInstancesInput{
+		Filters: []ec2.Filter{
+			{
+				Name:   aws.String("tag:Name"),
+				Values: []string{name},
+			},
+			{
+				Name:   aws.String("instance-state-name"),
+				Values: []string{"pending", "running", "stopping", "stopped", "shutting-down"},
+			},
+		},
+	}
+	pages := ec2.NewDescribeInstancesPaginator(Ec2.DescribeInstancesRequest(input))
+	for pages.Next(ctx) {
+		for _, res := range pages.CurrentPage().Reservations {
+			if len(res.Instances) > 0 {
+				return true, nil
+			}
+		}
+	}
+	return false, pages.Err()
 }
 
-//BuildTheDamnThingAlready() creates a new EC2 instance
-func (r *AWSrequest) BuildEC2() ([]AWSresponse, error) {
+//runInstancesInput returns the RunInstances input for the resolved request.
+func (r *AWSrequest) runInstancesInput() *ec2.RunInstancesInput {
 
-	Ec2 := ec2.New(r.Config)
 	input := &ec2.RunInstancesInput{
 		BlockDeviceMappings: r.DisksF,
 		ImageId:             r.AmiID,
@@ -317,7 +528,8 @@ func (r *AWSrequest) BuildEC2() ([]AWSresponse, error) {
 		SubnetId:            r.SubnetID,
 		MaxCount:            &r.Max,
 		MinCount:            &r.Min,
-		InstanceType:        ec2.InstanceTypeT2Micro,
+		InstanceType:        ec2.InstanceType(r.InstanceType),
+		ClientToken:         r.clientToken(),
 		SecurityGroupIds:    []string{*r.SecurityGID},
 		TagSpecifications: []ec2.TagSpecification{
 			{
@@ -326,6 +538,9 @@ func (r *AWSrequest) BuildEC2() ([]AWSresponse, error) {
 					{Key: aws.String("env"),
 						Value: &r.Environment,
 					},
+					{Key: aws.String("appcode"),
+						Value: &r.AppCode,
+					},
 					{Key: aws.String("ChangeNum"),
 						Value: &r.ChangeNum,
 					},
@@ -336,26 +551,167 @@ func (r *AWSrequest) BuildEC2() ([]AWSresponse, error) {
 			},
 		},
 	}
+	if r.UserData != "" {
+		input.UserData = aws.String(bootstrap.EC2(r.UserData, r.Osname))
+	}
+	return input
+}
+
+//clientToken returns the RunInstances idempotency token of the request, nil if it has no change number.
+func (r *AWSrequest) clientToken() *string {
+
+	if r.ChangeNum == "" {
+		return nil
+	}
+	sum := sha256.Sum256([]byte(strings.Join([]string{
+		r.Environment, r.Tier, r.AppCode, r.ChangeNum, r.InstanceName, strconv.FormatInt(r.Min, 10), strconv.FormatInt(r.Max, 10),
+	}, "/")))
+	return aws.String(hex.EncodeToString(sum[:]))
+}
+
+//DryRunEC2 checks the RunInstances call with the EC2 DryRun flag, it returns nil if it would have succeeded.
+func (r *AWSrequest) DryRunEC2() error {
+
+	Ec2 := ec2.New(r.Config)
+	input := r.runInstancesInput()
+	input.DryRun = aws.Bool(true)
 	req := Ec2.RunInstancesRequest(input)
+	_, err := req.Send(r.Ctx)
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == "DryRunOperation" {
+		return nil
+	}
+	if err == nil {
+		return errors.New("EC2 dry run returned no DryRunOperation response")
+	}
+	return err
+}
+
+//BuildTheDamnThingAlready() creates a new EC2 instance
+func (r *AWSrequest) BuildEC2() ([]AWSresponse, error) {
+
+	Ec2 := ec2.New(r.Config)
+	req := Ec2.RunInstancesRequest(r.runInstancesInput())
 	status, err := req.Send(r.Ctx)
 	if err != nil {
 		return nil, err
 	}
 	responses := make([]AWSresponse, 0)
-	for _, v := range status.Instances {
+	for i, v := range status.Instances {
 		state, err := v.State.Name.MarshalValue()
 		if err != nil {
 			return nil, err
 		}
-		responses = append(responses, AWSresponse{
-			InstanceName:      *v.InstanceId,
+		resp := AWSresponse{
+			Provider:          r.Provider,
+			InstanceName:      r.InstanceName,
+			ID:                *v.InstanceId,
 			Status:            state,
 			NetworkInterfaces: *v.NetworkInterfaces[0].PrivateIpAddress,
+			Zone:              *v.Placement.AvailabilityZone,
+			CredentialRef:     r.SSHKeyRef,
+		}
+		if err := r.nameInstance(Ec2, v, i, &resp); err != nil {
+			resp.Error = err.Error()
+		}
+		id := *v.InstanceId
+		cloud.Record(r.Ctx, resp.InstanceName, "instance", id, func(ctx context.Context) error {
+			_, err := TerminateEC2(ctx, r.Config, []string{id}, false)
+			return err
 		})
+		responses = append(responses, resp)
+		cloud.ReportProgress(r.Ctx, resp)
+	}
+	for _, resp := range responses {
+		if resp.Error != "" {
+			return responses, errors.New(resp.Error)
+		}
+	}
+	if r.Wait {
+		if err := r.waitRunning(responses); err != nil {
+			return responses, err
+		}
 	}
 	return responses, nil
 }
 
+//nameInstance tags the i-th launched instance with the i-th allocated name, unless a previous attempt already named it.
+func (r *AWSrequest) nameInstance(Ec2 *ec2.Client, inst ec2.Instance, i int, resp *AWSresponse) error {
+
+	for _, tag := range inst.Tags {
+		if aws.StringValue(tag.Key) == "Name" && aws.StringValue(tag.Value) != r.InstanceName {
+			resp.InstanceName = aws.StringValue(tag.Value)
+			return nil
+		}
+	}
+	if i >= len(r.Names) {
+		return nil
+	}
+	req := Ec2.CreateTagsRequest(&ec2.CreateTagsInput{
+		Resources: []string{*inst.InstanceId},
+		Tags:      []ec2.Tag{{Key: aws.String("Name"), Value: aws.String(r.Names[i])}},
+	})
+	if _, err := req.Send(r.Ctx); err != nil {
+		return fmt.Errorf("could not name instance %s %s: %w", *inst.InstanceId, r.Names[i], err)
+	}
+	resp.InstanceName = r.Names[i]
+	return nil
+}
+
+//waitRunning waits until the instances in responses are running and fills in their state, private IPs and launch time.
+func (r *AWSrequest) waitRunning(responses []AWSresponse) error {
+
+	timeout, err := r.Request().Timeout()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(r.Ctx, timeout)
+	defer cancel()
+	ids := make([]string, 0, len(responses))
+	for _, resp := range responses {
+		ids = append(ids, resp.ID)
+	}
+	Ec2 := ec2.New(r.Config)
+	input := &ec2.DescribeInstancesInput{InstanceIds: ids}
+	attempts := int(timeout/(15*time.Second)) + 1
+	if err := Ec2.WaitUntilInstanceRunning(ctx, input, aws.WithWaiterMaxAttempts(attempts)); err != nil {
+		return fmt.Errorf("instances did not reach running within %s: %w", timeout, err)
+	}
+	instances := make(map[string]ec2.Instance, len(ids))
+	pages := ec2.NewDescribeInstancesPaginator(Ec2.DescribeInstancesRequest(input))
+	for pages.Next(ctx) {
+		for _, res := range pages.CurrentPage().Reservations {
+			for _, inst := range res.Instances {
+				instances[*inst.InstanceId] = inst
+			}
+		}
+	}
+	if err := pages.Err(); err != nil {
+		return err
+	}
+	for i := range responses {
+		inst, ok := instances[responses[i].ID]
+		if !ok {
+			continue
+		}
+		state, err := inst.State.Name.MarshalValue()
+		if err != nil {
+			return err
+		}
+		responses[i].Status = state
+		responses[i].PrivateIPs = make([]string, 0, len(inst.NetworkInterfaces))
+		for _, nic := range inst.NetworkInterfaces {
+			if nic.PrivateIpAddress != nil {
+				responses[i].PrivateIPs = append(responses[i].PrivateIPs, *nic.PrivateIpAddress)
+			}
+		}
+		if inst.LaunchTime != nil {
+			responses[i].LaunchTime = inst.LaunchTime.UTC().Format(time.RFC3339)
+		}
+		cloud.ReportProgress(r.Ctx, responses[i])
+	}
+	return nil
+}
+
 //GetOSami returns
 func GetOSami(os, version string) (string, error) {
 
@@ -387,7 +743,8 @@ func (a awsAMIs) Len() int           { return len(a) }
 func (a awsAMIs) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
 func (a awsAMIs) Less(i, j int) bool { return a[i].CreationTime.After(a[j].CreationTime) }
 
-//GetAMI return the latest AMI or error if any
+//GetAMI return the latest AMI or error if any.
+//DescribeImages has no NextToken in this API version and returns every match at once, so there is no page to follow.
 func (r *AWSrequest) GetAMI() error {
 
 	ami := ec2.New(r.Config)
@@ -422,7 +779,181 @@ func (r *AWSrequest) GetAMI() error {
 			CreationTime: amiCreationTime,
 		})
 	}
+	if len(amiToSort) == 0 {
+		return fmt.Errorf("no AMI found matching %s", amiS)
+	}
 	sort.Sort(awsAMIs(amiToSort))
 	r.AmiID = amiToSort[0].ID
 	return nil
 }
+
+//TerminateEC2 terminates the given instances, removing their non auto-delete volumes unless keepDisks is set.
+func TerminateEC2(ctx context.Context, cfg aws.Config, ids []string, keepDisks bool) ([]AWSresponse, error) {
+
+	Ec2 := ec2.New(cfg)
+	names := make(map[string]string)
+	volumes := make([]string, 0)
+	descReq := Ec2.DescribeInstancesRequest(&ec2.DescribeInstancesInput{InstanceIds: ids})
+	desc, err := descReq.Send(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, res := range desc.Reservations {
+		for _, inst := range res.Instances {
+			for _, tag := range inst.Tags {
+				if *tag.Key == "Name" {
+					names[*inst.InstanceId] = *tag.Value
+				}
+			}
+			for _, bd := range inst.BlockDeviceMappings {
+				if bd.Ebs == nil || bd.Ebs.DeleteOnTermination == nil || *bd.Ebs.DeleteOnTermination {
+					continue
+				}
+				volumes = append(volumes, *bd.Ebs.VolumeId)
+			}
+		}
+	}
+	req := Ec2.TerminateInstancesRequest(&ec2.TerminateInstancesInput{InstanceIds: ids})
+	status, err := req.Send(ctx)
+	if err != nil {
+		return nil, err
+	}
+	responses := make([]AWSresponse, 0)
+	for _, v := range status.TerminatingInstances {
+		state, err := v.CurrentState.Name.MarshalValue()
+		if err != nil {
+			return nil, err
+		}
+		responses = append(responses, AWSresponse{
+			Provider:     providerName,
+			InstanceName: names[*v.InstanceId],
+			ID:           *v.InstanceId,
+			Status:       state,
+		})
+	}
+	if keepDisks || len(volumes) == 0 {
+		return responses, nil
+	}
+	if err := Ec2.WaitUntilInstanceTerminated(ctx, &ec2.DescribeInstancesInput{InstanceIds: ids}); err != nil {
+		return responses, err
+	}
+	for _, vol := range volumes {
+		volReq := Ec2.DeleteVolumeRequest(&ec2.DeleteVolumeInput{VolumeId: aws.String(vol)})
+		if _, err := volReq.Send(ctx); err != nil {
+			return responses, fmt.Errorf("could not delete volume %s: %w", vol, err)
+		}
+	}
+	return responses, nil
+}
+
+//DescribeEC2 returns the instances with the given IDs, Name tag or ChangeNum tag, empty values are not filtered on.
+func DescribeEC2(ctx context.Context, cfg aws.Config, ids []string, name, changeNum string) ([]AWSresponse, error) {
+
+	Ec2 := ec2.New(cfg)
+	input := &ec2.DescribeInstancesInput{}
+	//a filter rather than InstanceIds, which fails for IDs of other regions.
+	if len(ids) > 0 {
+		input.Filters = append(input.Filters, ec2.Filter{Name: aws.String("instance-id"), Values: ids})
+	}
+	if name != "" {
+		input.Filters = append(input.Filters, tagFilter("Name", name))
+	}
+	if changeNum != "" {
+		input.Filters = append(input.Filters, tagFilter("ChangeNum", changeNum))
+	}
+	responses := make([]AWSresponse, 0)
+	pages := ec2.NewDescribeInstancesPaginator(Ec2.DescribeInstancesRequest(input))
+	for pages.Next(ctx) {
+		for _, res := range pages.CurrentPage().Reservations {
+			for _, inst := range res.Instances {
+				resp, err := instanceResponse(inst)
+				if err != nil {
+					return nil, err
+				}
+				responses = append(responses, resp)
+			}
+		}
+	}
+	if err := pages.Err(); err != nil {
+		return nil, err
+	}
+	return responses, nil
+}
+
+//instanceResponse maps an EC2 instance into an AWSresponse.
+func instanceResponse(inst ec2.Instance) (AWSresponse, error) {
+
+	state, err := inst.State.Name.MarshalValue()
+	if err != nil {
+		return AWSresponse{}, err
+	}
+	resp := AWSresponse{
+		Provider:   providerName,
+		ID:         aws.StringValue(inst.InstanceId),
+		Status:     state,
+		Image:      aws.StringValue(inst.ImageId),
+		PrivateIPs: make([]string, 0, len(inst.NetworkInterfaces)),
+		Volumes:    make([]string, 0, len(inst.BlockDeviceMappings)),
+	}
+	for _, tag := range inst.Tags {
+		switch aws.StringValue(tag.Key) {
+		case "Name":
+			resp.InstanceName = aws.StringValue(tag.Value)
+		case "env":
+			resp.Environment = aws.StringValue(tag.Value)
+		}
+	}
+	if inst.Placement != nil {
+		resp.Zone = aws.StringValue(inst.Placement.AvailabilityZone)
+	}
+	if inst.PrivateIpAddress != nil {
+		resp.NetworkInterfaces = *inst.PrivateIpAddress
+	}
+	for _, nic := range inst.NetworkInterfaces {
+		if nic.PrivateIpAddress != nil {
+			resp.PrivateIPs = append(resp.PrivateIPs, *nic.PrivateIpAddress)
+		}
+	}
+	for _, bd := range inst.BlockDeviceMappings {
+		if bd.Ebs != nil && bd.Ebs.VolumeId != nil {
+			resp.Volumes = append(resp.Volumes, fmt.Sprintf("%s %s", aws.StringValue(bd.DeviceName), *bd.Ebs.VolumeId))
+		}
+	}
+	if inst.LaunchTime != nil {
+		resp.LaunchTime = inst.LaunchTime.UTC().Format(time.RFC3339)
+	}
+	return resp, nil
+}
+
+//ListEC2 returns the instances tagged with the env, appcode and ChangeNum of filter, empty values are not filtered on.
+func ListEC2(ctx context.Context, cfg aws.Config, filter cloud.Filter) ([]AWSresponse, error) {
+
+	Ec2 := ec2.New(cfg)
+	input := &ec2.DescribeInstancesInput{
+		Filters: []ec2.Filter{
+			{Name: aws.String("instance-state-name"), Values: []string{"pending", "running", "stopping", "stopped"}},
+		},
+	}
+	for key, value := range map[string]string{"env": filter.Environment, "appcode": filter.AppCode, "ChangeNum": filter.ChangeNum} {
+		if value != "" {
+			input.Filters = append(input.Filters, tagFilter(key, value))
+		}
+	}
+	responses := make([]AWSresponse, 0)
+	pages := ec2.NewDescribeInstancesPaginator(Ec2.DescribeInstancesRequest(input))
+	for pages.Next(ctx) {
+		for _, res := range pages.CurrentPage().Reservations {
+			for _, inst := range res.Instances {
+				resp, err := instanceResponse(inst)
+				if err != nil {
+					return nil, err
+				}
+				responses = append(responses, resp)
+			}
+		}
+	}
+	if err := pages.Err(); err != nil {
+		return nil, err
+	}
+	return responses, nil
+}
@@ -0,0 +1,195 @@
+package aws
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/shakilbd009/go-cloud/cloud"
+	"github.com/shakilbd009/go-cloud/config"
+)
+
+//paged returns a fakeEC2 handler serving pages of action one NextToken at a time.
+func paged(action string, pages ...string) func(call ec2Call) (int, string) {
+	return func(call ec2Call) (int, string) {
+		i := 0
+		if token := call.Form.Get("NextToken"); token != "" {
+			fmt.Sscanf(token, "p%d", &i)
+		}
+		if call.Action != action || i >= len(pages) {
+			return http.StatusBadRequest, ec2Error("InvalidParameterValue", "unexpected "+call.Action+" call")
+		}
+		inner := pages[i]
+		if i+1 < len(pages) {
+			inner += fmt.Sprintf("<nextToken>p%d</nextToken>", i+1)
+		}
+		return http.StatusOK, ec2Response(action, inner)
+	}
+}
+
+//instancesXML returns a DescribeInstances reservation holding one running instance per name.
+func instancesXML(names ...string) string {
+	var b strings.Builder
+	b.WriteString("<reservationSet><item><reservationId>r-1</reservationId><instancesSet>")
+	for _, name := range names {
+		fmt.Fprintf(&b, "<item><instanceId>i-%s</instanceId><instanceState><code>16</code><name>running</name></instanceState>"+
+			"<tagSet><item><key>Name</key><value>%s</value></item><item><key>env</key><value>dev</value></item></tagSet></item>", name, name)
+	}
+	b.WriteString("</instancesSet></item></reservationSet>")
+	return b.String()
+}
+
+func TestLookupsWalkEveryPage(t *testing.T) {
+
+	vpcs := func(ids ...string) string {
+		var b strings.Builder
+		b.WriteString("<vpcSet>")
+		for _, id := range ids {
+			fmt.Fprintf(&b, "<item><vpcId>%s</vpcId></item>", id)
+		}
+		b.WriteString("</vpcSet>")
+		return b.String()
+	}
+	subnets := func(ids ...string) string {
+		var b strings.Builder
+		b.WriteString("<subnetSet>")
+		for _, id := range ids {
+			fmt.Fprintf(&b, "<item><subnetId>%s</subnetId><availabilityZone>us-east-2b</availabilityZone></item>", id)
+		}
+		b.WriteString("</subnetSet>")
+		return b.String()
+	}
+	groups := func(ids ...string) string {
+		var b strings.Builder
+		b.WriteString("<securityGroupInfo>")
+		for _, id := range ids {
+			fmt.Fprintf(&b, "<item><groupId>%s</groupId></item>", id)
+		}
+		b.WriteString("</securityGroupInfo>")
+		return b.String()
+	}
+	vpc := func(r *AWSrequest) (string, error) {
+		err := r.GetVpcID()
+		return aws.StringValue(r.VPCid), err
+	}
+	subnet := func(r *AWSrequest) (string, error) {
+		err := r.GetSubnet()
+		return aws.StringValue(r.SubnetID) + " " + aws.StringValue(r.AvailabilityZone), err
+	}
+	group := func(r *AWSrequest) (string, error) {
+		err := r.GetSecurityGroup()
+		return aws.StringValue(r.SecurityGID), err
+	}
+	tests := []struct {
+		name    string
+		action  string
+		pages   []string
+		lookup  func(r *AWSrequest) (string, error)
+		want    string
+		wantErr string
+	}{
+		{name: "vpc on page two", action: "DescribeVpcs", pages: []string{vpcs(), vpcs("vpc-2")}, lookup: vpc, want: "vpc-2"},
+		{name: "vpc not found", action: "DescribeVpcs", pages: []string{vpcs(), vpcs()}, lookup: vpc, wantErr: "VPC not found with name base"},
+		{name: "vpc across pages", action: "DescribeVpcs", pages: []string{vpcs("vpc-1"), vpcs("vpc-2")}, lookup: vpc,
+			wantErr: "VPC name base is ambiguous, it matches vpc-1, vpc-2"},
+		{name: "subnet on page three", action: "DescribeSubnets", pages: []string{subnets(), subnets(), subnets("subnet-3")}, lookup: subnet,
+			want: "subnet-3 us-east-2b"},
+		{name: "subnet not found", action: "DescribeSubnets", pages: []string{subnets()}, lookup: subnet, wantErr: "Subnet not found with name app"},
+		{name: "subnet across pages", action: "DescribeSubnets", pages: []string{subnets("subnet-1"), subnets("subnet-2")}, lookup: subnet,
+			wantErr: "Subnet name app is ambiguous, it matches subnet-1, subnet-2"},
+		{name: "security group on page two", action: "DescribeSecurityGroups", pages: []string{groups(), groups("sg-2")}, lookup: group, want: "sg-2"},
+		{name: "security group not found", action: "DescribeSecurityGroups", pages: []string{groups(), groups()}, lookup: group,
+			wantErr: "SecurityGroup not found with name web"},
+		{name: "security group across pages", action: "DescribeSecurityGroups", pages: []string{groups("sg-1"), groups("sg-2")}, lookup: group,
+			wantErr: "SecurityGroup name web is ambiguous, it matches sg-1, sg-2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, cfg, stop := newFakeEC2(t, "us-east-2", paged(tt.action, tt.pages...))
+			defer stop()
+			r := &AWSrequest{
+				Config:  cfg,
+				Ctx:     context.Background(),
+				VPCid:   aws.String("vpc-2"),
+				Network: config.Network{Network: "base", Subnet: "app", SecurityGroup: "web"},
+			}
+			got, err := tt.lookup(r)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("error = %v, want %q", err, tt.wantErr)
+				}
+			} else if err != nil {
+				t.Fatal(err)
+			} else if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+			if calls := len(f.actions()); calls != len(tt.pages) {
+				t.Errorf("%d %s calls, want one per page (%d)", calls, tt.action, len(tt.pages))
+			}
+		})
+	}
+}
+
+func TestInstanceListsWalkEveryPage(t *testing.T) {
+
+	names := func(list []AWSresponse) []string {
+		found := make([]string, 0, len(list))
+		for _, inst := range list {
+			found = append(found, inst.InstanceName)
+		}
+		return found
+	}
+	tests := []struct {
+		name string
+		list func(ctx context.Context, cfg aws.Config) ([]string, error)
+	}{
+		{name: "InstanceNames", list: func(ctx context.Context, cfg aws.Config) ([]string, error) {
+			return InstanceNames(ctx, cfg, "web*")
+		}},
+		{name: "DescribeEC2", list: func(ctx context.Context, cfg aws.Config) ([]string, error) {
+			found, err := DescribeEC2(ctx, cfg, nil, "", "CHG1")
+			return names(found), err
+		}},
+		{name: "ListEC2", list: func(ctx context.Context, cfg aws.Config) ([]string, error) {
+			found, err := ListEC2(ctx, cfg, cloud.Filter{Environment: "dev"})
+			return names(found), err
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, cfg, stop := newFakeEC2(t, "us-east-2", paged("DescribeInstances", instancesXML("web1", "web2"), instancesXML(), instancesXML("web3")))
+			defer stop()
+			got, err := tt.list(context.Background(), cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := []string{"web1", "web2", "web3"}; !reflect.DeepEqual(got, want) {
+				t.Errorf("got %v, want %v", got, want)
+			}
+			if calls := len(f.actions()); calls != 3 {
+				t.Errorf("%d DescribeInstances calls, want 3", calls)
+			}
+		})
+	}
+}
+
+func TestInstanceListsReturnPageErrors(t *testing.T) {
+
+	f, cfg, stop := newFakeEC2(t, "us-east-2", func(call ec2Call) (int, string) {
+		if call.Form.Get("NextToken") == "" {
+			return http.StatusOK, ec2Response("DescribeInstances", instancesXML("web1")+"<nextToken>p1</nextToken>")
+		}
+		return http.StatusForbidden, ec2Error("UnauthorizedOperation", "not allowed")
+	})
+	defer stop()
+	if _, err := ListEC2(context.Background(), cfg, cloud.Filter{AppCode: "app"}); err == nil || !strings.Contains(err.Error(), "UnauthorizedOperation") {
+		t.Errorf("ListEC2 error = %v, want the error of the second page", err)
+	}
+	if calls := len(f.actions()); calls != 2 {
+		t.Errorf("%d DescribeInstances calls, want 2", calls)
+	}
+}
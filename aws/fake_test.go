@@ -0,0 +1,82 @@
+package aws
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/defaults"
+)
+
+//fakeEC2 answers EC2 query API calls with the XML its handler returns for the region and form of each call.
+type fakeEC2 struct {
+	mu     sync.Mutex
+	calls  []ec2Call
+	handle func(call ec2Call) (status int, body string)
+}
+
+//ec2Call object is a call fakeEC2 received.
+type ec2Call struct {
+	Region string
+	Action string
+	Form   url.Values
+}
+
+//newFakeEC2 starts a fakeEC2 and returns it with a config whose clients call it, in region.
+//Each region is served under its own path so calls can be told apart.
+func newFakeEC2(t *testing.T, region string, handle func(call ec2Call) (int, string)) (*fakeEC2, aws.Config, func()) {
+
+	f := &fakeEC2{handle: handle}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		form, err := url.ParseQuery(string(body))
+		if err != nil {
+			t.Errorf("could not parse EC2 call: %v", err)
+		}
+		call := ec2Call{Region: strings.Trim(r.URL.Path, "/"), Action: form.Get("Action"), Form: form}
+		f.mu.Lock()
+		f.calls = append(f.calls, call)
+		f.mu.Unlock()
+		status, resp := f.handle(call)
+		w.Header().Set("Content-Type", "text/xml")
+		w.WriteHeader(status)
+		w.Write([]byte(resp))
+	}))
+	cfg := defaults.Config()
+	cfg.Region = region
+	cfg.Credentials = aws.NewStaticCredentialsProvider("AKID", "SECRET", "")
+	cfg.EndpointResolver = aws.EndpointResolverFunc(func(service, region string) (aws.Endpoint, error) {
+		return aws.Endpoint{URL: server.URL + "/" + region, SigningRegion: region}, nil
+	})
+	cfg.Retryer = aws.NoOpRetryer{}
+	cfg.Logger = nil
+	return f, cfg, server.Close
+}
+
+//actions returns the region and action of every call received, in order.
+func (f *fakeEC2) actions() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	list := make([]string, 0, len(f.calls))
+	for _, call := range f.calls {
+		list = append(list, call.Region+":"+call.Action)
+	}
+	return list
+}
+
+//ec2Response wraps inner in the response element of action.
+func ec2Response(action, inner string) string {
+	return `<?xml version="1.0" encoding="UTF-8"?><` + action + `Response xmlns="http://ec2.amazonaws.com/doc/2016-11-15/"><requestId>r</requestId>` +
+		inner + `</` + action + `Response>`
+}
+
+//ec2Error returns an EC2 error body.
+func ec2Error(code, message string) string {
+	return `<?xml version="1.0" encoding="UTF-8"?><Response><Errors><Error><Code>` + code + `</Code><Message>` + message +
+		`</Message></Error></Errors><RequestID>r</RequestID></Response>`
+}
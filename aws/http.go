@@ -2,43 +2,148 @@ package aws
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
-	"net/http"
+	"log"
+	"strings"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/shakilbd009/go-cloud/cloud"
+	"github.com/shakilbd009/go-cloud/config"
+	"github.com/shakilbd009/go-cloud/landingzone"
+	"github.com/shakilbd009/go-cloud/naming"
+	"github.com/shakilbd009/go-cloud/secrets"
+	"github.com/shakilbd009/go-cloud/validate"
 )
 
+const providerName = "aws"
+
 //AWSrequest object
 type AWSrequest struct {
-	Environment  string `json:"env"`
-	Tier         string `json:"tier"`
-	Osname       string `json:"os"`
-	OsFlavor     string `json:"flavor"`
-	Disks        string `json:"disks"`
-	Min          int64  `json:"min"`
-	Max          int64  `json:"max"`
-	AppCode      string `json:"appCode"`
-	ChangeNum    string `json:"requestNum"`
-	InstanceType string `json:"instanceType"`
-	InstanceName string
-	Provider     string
-	VPCid        *string
-	SubnetID     *string
-	SecurityGID  *string
-	AmiID        *string
-	Key          *string
-	DisksF       []ec2.BlockDeviceMapping
-	Config       aws.Config
-	Ctx          context.Context
+	Environment      string `json:"env"`
+	Tier             string `json:"tier"`
+	Osname           string `json:"os"`
+	OsFlavor         string `json:"flavor"`
+	Disks            string `json:"disks"`
+	Min              int64  `json:"min"`
+	Max              int64  `json:"max"`
+	AppCode          string `json:"appCode"`
+	ChangeNum        string `json:"requestNum"`
+	InstanceType     string `json:"instanceType"`
+	Wait             bool   `json:"wait"`
+	WaitTimeout      string `json:"waitTimeout"`
+	UserData         string `json:"userData"`
+	SSHKey           string `json:"sshKey"`
+	SSHPublicKey     string
+	SSHKeyRef        string
+	KeyName          string `json:"keyName"`
+	InstanceName     string
+	Names            []string
+	Provider         string
+	VPCid            *string
+	SubnetID         *string
+	AvailabilityZone *string
+	SecurityGID      *string
+	AmiID            *string
+	Key              *string
+	DisksF           []ec2.BlockDeviceMapping
+	Namer            *naming.Namer
+	Network          config.Network
+	Config           aws.Config
+	Ctx              context.Context
 }
 
 //AWSresponse object
-type AWSresponse struct {
-	InstanceName      string `json:"InstanceName"`
-	Status            string `json:"status"`
-	NetworkInterfaces string `json:"networkInterfaces,omitempty"`
+type AWSresponse = cloud.Instance
+
+//Provider implements cloud.Provider for aws.
+type Provider struct {
+	Config   aws.Config
+	Namer    *naming.Namer
+	Settings config.Source
+	//Secrets stores the private keys of the key pairs the provider creates.
+	Secrets secrets.Store
+}
+
+//NewProvider returns a Provider for the default region in settings or an error if any.
+func NewProvider(settings config.Source) (*Provider, error) {
+
+	cfg, err := GetNewSession(settings.Current().Provider(providerName).Region)
+	if err != nil {
+		return nil, err
+	}
+	return &Provider{Config: cfg, Namer: naming.Default(), Settings: settings}, nil
+}
+
+//newRequest maps req into an AWSrequest for the region and network configured for its environment and tier.
+func (p *Provider) newRequest(ctx context.Context, req cloud.Request) (AWSrequest, error) {
+
+	net, err := p.Settings.Current().Network(providerName, req.Environment, req.Tier)
+	if err != nil {
+		return AWSrequest{}, err
+	}
+	cfg := p.Config.Copy()
+	cfg.Region = net.Region
+	payload := NewAWSrequest(ctx, cfg, req)
+	payload.Namer = p.Namer
+	payload.Network = net
+	if payload.KeyName != "" {
+		payload.Key = aws.String(payload.KeyName)
+	}
+	if payload.InstanceType == "" {
+		payload.InstanceType = p.Settings.Current().Provider(providerName).InstanceType
+	}
+	return payload, nil
+}
+
+//NewAWSrequest maps a cloud.Request into an AWSrequest.
+func NewAWSrequest(ctx context.Context, cfg aws.Config, req cloud.Request) AWSrequest {
+	return AWSrequest{
+		Environment:  req.Environment,
+		Tier:         req.Tier,
+		Osname:       req.Osname,
+		OsFlavor:     req.OsFlavor,
+		Disks:        req.Disks,
+		Min:          req.Min,
+		Max:          req.Max,
+		AppCode:      req.AppCode,
+		ChangeNum:    req.ChangeNum,
+		InstanceType: req.InstanceType,
+		Wait:         req.Wait,
+		WaitTimeout:  req.WaitTimeout,
+		UserData:     req.UserData,
+		SSHKey:       req.SSHKey,
+		SSHPublicKey: req.SSHPublicKey,
+		SSHKeyRef:    req.SSHKeyRef,
+		KeyName:      req.KeyName,
+		Provider:     providerName,
+		Config:       cfg,
+		Ctx:          ctx,
+	}
+}
+
+//Request maps an AWSrequest into a cloud.Request.
+func (r AWSrequest) Request() cloud.Request {
+	return cloud.Request{
+		Provider:     providerName,
+		Environment:  r.Environment,
+		Tier:         r.Tier,
+		Osname:       r.Osname,
+		OsFlavor:     r.OsFlavor,
+		Disks:        r.Disks,
+		Min:          r.Min,
+		Max:          r.Max,
+		AppCode:      r.AppCode,
+		ChangeNum:    r.ChangeNum,
+		InstanceType: r.InstanceType,
+		Instance:     r.InstanceName,
+		Wait:         r.Wait,
+		WaitTimeout:  r.WaitTimeout,
+		UserData:     r.UserData,
+		SSHKey:       r.SSHKey,
+		KeyName:      r.KeyName,
+	}
 }
 
 type BuildFunc func() error
@@ -52,9 +157,48 @@ func Builder(fns ...BuildFunc) error {
 	return nil
 }
 
-//Post makes a POST request to aws api.
-func Post(w http.ResponseWriter, payload AWSrequest) {
+//Name returns the provider name.
+func (p *Provider) Name() string { return providerName }
 
+//Provision builds the EC2 instances described by req.
+func (p *Provider) Provision(ctx context.Context, req cloud.Request) ([]cloud.Instance, error) {
+
+	payload, err := p.newRequest(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	if err := Builder(
+		payload.GetVpcID,
+		payload.GetSubnet,
+		payload.GetAMI,
+		payload.GetSecurityGroup,
+		payload.PrepareDisks,
+		payload.GetInstanceName,
+		payload.CheckKeyPair,
+		payload.ImportKeyPair,
+	); err != nil {
+		return nil, fmt.Errorf("could not prepare EC2 request: %w", err)
+	}
+	names, release, err := p.instanceNames(ctx, req, payload)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	//a retried request relies on the client token to get back the instances it already launched.
+	if _, _, err := naming.Available(ctx, p, req.Resume, names...); err != nil {
+		return nil, err
+	}
+	payload.Names = names
+	return payload.BuildEC2()
+}
+
+//Plan resolves the VPC, subnet, AMI, security group, disks and name for req and dry-runs the launch.
+func (p *Provider) Plan(ctx context.Context, req cloud.Request) (cloud.Plan, error) {
+
+	payload, err := p.newRequest(ctx, req)
+	if err != nil {
+		return cloud.Plan{}, err
+	}
 	if err := Builder(
 		payload.GetVpcID,
 		payload.GetSubnet,
@@ -62,23 +206,357 @@ func Post(w http.ResponseWriter, payload AWSrequest) {
 		payload.GetSecurityGroup,
 		payload.PrepareDisks,
 		payload.GetInstanceName,
-	); err == nil {
-		responses, err := payload.BuildEC2()
+		payload.CheckKeyPair,
+	); err != nil {
+		return cloud.Plan{}, fmt.Errorf("could not prepare EC2 request: %w", err)
+	}
+	names, release, err := p.instanceNames(ctx, req, payload)
+	if err != nil {
+		return cloud.Plan{}, err
+	}
+	release()
+	if err := naming.Check(ctx, p, names...); err != nil {
+		return cloud.Plan{}, err
+	}
+	plan := cloud.Plan{
+		Provider:      providerName,
+		Names:         names,
+		Image:         *payload.AmiID,
+		Network:       *payload.VPCid,
+		Subnet:        *payload.SubnetID,
+		SecurityGroup: *payload.SecurityGID,
+		InstanceType:  payload.InstanceType,
+		Disks:         make([]string, 0, len(payload.DisksF)),
+		Zones:         []string{*payload.AvailabilityZone},
+	}
+	for _, disk := range payload.DisksF {
+		plan.Disks = append(plan.Disks, fmt.Sprintf("%s %dGB", *disk.DeviceName, *disk.Ebs.VolumeSize))
+	}
+	if err := payload.DryRunEC2(); err != nil {
+		return plan, err
+	}
+	plan.DryRunPassed = true
+	return plan, nil
+}
+
+//Rules returns what aws accepts in a request.
+func (p *Provider) Rules() validate.Rules {
+	return validate.Rules{
+		Provider: providerName,
+		OS: map[string][]string{
+			"windows": {},
+			"redhat":  {},
+			"suse":    {},
+			"amazon":  {},
+		},
+		MaxDisks:  4,
+		MaxDiskGB: 16384,
+		CountMode: validate.CountMinMax,
+		MaxCount:  20,
+		Identity:  []string{"instanceIds"},
+		Lookup:    []string{"instanceIds", "instanceName", "requestNum"},
+	}
+}
+
+//NamesWithPrefix returns the Name tags starting with prefix of the live instances in every configured region.
+func (p *Provider) NamesWithPrefix(ctx context.Context, prefix string) ([]string, error) {
+
+	names := make([]string, 0)
+	for _, region := range p.Settings.Current().Regions(providerName) {
+		cfg := p.Config.Copy()
+		cfg.Region = region
+		found, err := InstanceNames(ctx, cfg, prefix+"*")
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, found...)
+	}
+	return names, nil
+}
+
+//instanceNames returns the names of a retried request, topped up with the next free names up to its max count.
+//release frees the allocated names once the instances are tagged.
+func (p *Provider) instanceNames(ctx context.Context, req cloud.Request, payload AWSrequest) (names []string, release func(), err error) {
+
+	if int64(len(req.Names)) >= payload.Max {
+		return req.Names, func() {}, nil
+	}
+	names, release, err = p.Namer.Allocate(ctx, p, providerName, payload.Environment, payload.Osname, payload.AppCode, int(payload.Max)-len(req.Names))
+	if err != nil {
+		return nil, nil, err
+	}
+	return append(append([]string{}, req.Names...), names...), release, nil
+}
+
+//Exists reports whether an EC2 instance with the given Name tag exists.
+func (p *Provider) Exists(ctx context.Context, name string) (bool, error) {
+
+	for _, region := range p.regions() {
+		found, err := InstanceExists(ctx, p.regionConfig(region), name)
+		if err != nil || found {
+			return found, err
+		}
+	}
+	return false, nil
+}
+
+//Describe returns the EC2 instances with the IDs in req, or tagged with its instance name or request number, in every configured region.
+func (p *Provider) Describe(ctx context.Context, req cloud.Request) ([]cloud.Instance, error) {
+
+	if len(req.InstanceIDs) == 0 && req.Instance == "" && req.ChangeNum == "" {
+		return nil, errors.New("instanceIds, instanceName or requestNum must be passed to describe EC2 instances")
+	}
+	instances := make([]cloud.Instance, 0)
+	for _, region := range p.regions() {
+		found, err := DescribeEC2(ctx, p.regionConfig(region), req.InstanceIDs, req.Instance, req.ChangeNum)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
+			return nil, fmt.Errorf("could not describe instances in %s: %w", region, err)
 		}
-		data, err := json.MarshalIndent(responses, "", "  ")
+		instances = append(instances, found...)
+	}
+	return instances, nil
+}
+
+//Delete terminates the EC2 instances listed in req in whichever configured region they run.
+func (p *Provider) Delete(ctx context.Context, req cloud.Request) ([]cloud.Instance, error) {
+
+	if len(req.InstanceIDs) == 0 {
+		return nil, errors.New("instanceIds must be passed to delete EC2 instances")
+	}
+	pending := make(map[string]bool, len(req.InstanceIDs))
+	for _, id := range req.InstanceIDs {
+		pending[id] = true
+	}
+	instances := make([]cloud.Instance, 0, len(req.InstanceIDs))
+	for _, region := range p.regions() {
+		if len(pending) == 0 {
+			break
+		}
+		cfg := p.regionConfig(region)
+		found, err := DescribeEC2(ctx, cfg, req.InstanceIDs, "", "")
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusCreated)
-		w.Write(data)
-	} else {
-		fmt.Println("error happend here")
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+			return instances, fmt.Errorf("could not describe instances in %s: %w", region, err)
+		}
+		ids := make([]string, 0, len(found))
+		for _, inst := range found {
+			if pending[inst.ID] {
+				delete(pending, inst.ID)
+				ids = append(ids, inst.ID)
+			}
+		}
+		if len(ids) == 0 {
+			continue
+		}
+		terminated, err := TerminateEC2(ctx, cfg, ids, req.KeepDisks)
+		instances = append(instances, terminated...)
+		if err != nil {
+			return instances, fmt.Errorf("could not terminate instances in %s: %w", region, err)
+		}
+	}
+	for _, id := range req.InstanceIDs {
+		if pending[id] {
+			return instances, fmt.Errorf("instance %s not found in %s", id, strings.Join(p.regions(), ", "))
+		}
+	}
+	return instances, nil
+}
+
+//List returns the EC2 instances matching filter in every configured region.
+func (p *Provider) List(ctx context.Context, filter cloud.Filter) ([]cloud.Instance, error) {
+
+	instances := make([]cloud.Instance, 0)
+	for _, region := range p.regions() {
+		found, err := ListEC2(ctx, p.regionConfig(region), filter)
+		if err != nil {
+			return nil, fmt.Errorf("could not list instances in %s: %w", region, err)
+		}
+		instances = append(instances, found...)
+	}
+	return instances, nil
+}
+
+//regions returns the regions of the config, the default region if it has none.
+func (p *Provider) regions() []string {
+
+	regions := p.Settings.Current().Regions(providerName)
+	if len(regions) == 0 {
+		regions = []string{p.Config.Region}
+	}
+	return regions
+}
+
+//regionConfig returns the config of region, the default region if empty.
+func (p *Provider) regionConfig(region string) aws.Config {
+
+	cfg := p.Config.Copy()
+	if region != "" {
+		cfg.Region = region
+	}
+	return cfg
+}
+
+//CreateKeyPair creates a key pair of env in region and stores its private key, which AWS only returns once.
+func (p *Provider) CreateKeyPair(ctx context.Context, region, env, name string) (KeyPair, error) {
+
+	if p.Secrets == nil {
+		return KeyPair{}, errors.New("no secret backend is configured to keep the private key")
+	}
+	cfg := p.regionConfig(region)
+	kp, private, err := CreateKey(ctx, cfg, name)
+	if err != nil {
+		return KeyPair{}, err
+	}
+	kp.PrivateKeyRef, err = p.Secrets.Put(ctx, fmt.Sprintf("aws/%s/keys/%s", cfg.Region, name), []byte(private))
+	if err != nil {
+		//nobody could ever log in with it, so the key pair is not kept.
+		if derr := DeleteKey(ctx, cfg, name); derr != nil {
+			log.Printf("could not delete key pair %s after failing to store it: %v\n", name, derr)
+		}
+		return KeyPair{}, fmt.Errorf("could not store private key of %s: %w", name, err)
+	}
+	tagKeyPair(ctx, cfg, &kp, env)
+	return kp, nil
+}
+
+//ImportKeyPair imports an authorized_keys public key as a key pair of env in region.
+func (p *Provider) ImportKeyPair(ctx context.Context, region, env, name, publicKey string) (KeyPair, error) {
+
+	cfg := p.regionConfig(region)
+	kp, err := ImportKey(ctx, cfg, name, publicKey)
+	if err != nil {
+		return KeyPair{}, err
+	}
+	tagKeyPair(ctx, cfg, &kp, env)
+	return kp, nil
+}
+
+//tagKeyPair tags kp with env and the reference of its private key, an untagged key pair can only be managed by roles not limited to environments.
+func tagKeyPair(ctx context.Context, cfg aws.Config, kp *KeyPair, env string) {
+
+	tags := make(map[string]string)
+	if env != "" {
+		tags["env"] = env
+	}
+	if kp.PrivateKeyRef != "" {
+		tags[privateKeyTag] = kp.PrivateKeyRef
+	}
+	if len(tags) == 0 {
 		return
 	}
+	if err := TagResource(ctx, cfg, kp.ID, tags); err != nil {
+		log.Printf("could not tag key pair %s: %v\n", kp.Name, err)
+		return
+	}
+	kp.Environment = env
+}
+
+//KeyPairs returns the key pairs of region.
+func (p *Provider) KeyPairs(ctx context.Context, region string) ([]KeyPair, error) {
+	return GetAllKeys(ctx, p.regionConfig(region), "")
+}
+
+//KeyPair returns the key pair of region with the given name.
+func (p *Provider) KeyPair(ctx context.Context, region, name string) (KeyPair, error) {
+
+	found, err := GetAllKeys(ctx, p.regionConfig(region), name)
+	if err != nil {
+		return KeyPair{}, err
+	}
+	if len(found) == 0 {
+		return KeyPair{}, fmt.Errorf("%w: %s", ErrKeyPairNotFound, name)
+	}
+	return found[0], nil
+}
+
+//DeleteKeyPair deletes a key pair of region, its stored private key is left in the secret backend.
+func (p *Provider) DeleteKeyPair(ctx context.Context, region, name string) error {
+	return DeleteKey(ctx, p.regionConfig(region), name)
+}
+
+//LandingZone creates the VPC of req with a subnet and security group per tier, the subnets spread over the AZs of the region.
+//Everything is named and tagged so the config it returns finds it, and recorded on the saga of ctx.
+func (p *Provider) LandingZone(ctx context.Context, req landingzone.Request) (landingzone.Zone, error) {
+
+	cfg := p.regionConfig(req.Region)
+	cidrs, err := landingzone.Carve(req.CIDR, len(landingzone.Tiers))
+	if err != nil {
+		return landingzone.Zone{}, err
+	}
+	zones, err := GetAZs(ctx, cfg)
+	if err != nil {
+		return landingzone.Zone{}, err
+	}
+	if len(zones) == 0 {
+		return landingzone.Zone{}, fmt.Errorf("no availability zones found in %s", cfg.Region)
+	}
+	env, vpcName := req.Environment, landingzone.Name(req.Environment, "", "vpc")
+	existing, err := getVPCs(ctx, cfg, tagFilter("Name", vpcName))
+	if err != nil {
+		return landingzone.Zone{}, err
+	}
+	if len(existing) > 0 {
+		return landingzone.Zone{}, fmt.Errorf("%w: VPC %s", landingzone.ErrExists, vpcName)
+	}
+	vpc, err := CreateVPC(ctx, cfg, req.CIDR)
+	if err != nil {
+		return landingzone.Zone{}, err
+	}
+	vpcID := *vpc.VpcId
+	cloud.Record(ctx, "", "vpc", vpcID, func(ctx context.Context) error { return DeleteVPC(ctx, cfg, vpcID) })
+	if err := TagResource(ctx, cfg, vpcID, map[string]string{"Name": vpcName, "env": env}); err != nil {
+		return landingzone.Zone{}, err
+	}
+	zone := landingzone.Zone{Provider: providerName, Environment: env, Region: cfg.Region, Network: vpcName, NetworkID: vpcID, CIDR: req.CIDR}
+	groups := make(map[string]string, len(landingzone.Tiers))
+	for i, tier := range landingzone.Tiers {
+		s := landingzone.Subnet{Tier: tier, Name: landingzone.Name(env, tier, "subnet"), CIDR: cidrs[i], Zone: zones[i%len(zones)]}
+		subnet, err := CreateSubnet(ctx, cfg, vpcID, s.Zone, s.CIDR)
+		if err != nil {
+			return landingzone.Zone{}, err
+		}
+		s.ID = *subnet.SubnetId
+		cloud.Record(ctx, "", "subnet", s.ID, func(ctx context.Context) error { return DeleteSubnet(ctx, cfg, s.ID) })
+		if err := TagResource(ctx, cfg, s.ID, map[string]string{"Name": s.Name, "env": env, "tier": tier}); err != nil {
+			return landingzone.Zone{}, err
+		}
+		s.SecurityGroup = landingzone.Name(env, tier, "sg")
+		if s.SecurityGroupID, err = CreateSG(ctx, cfg, s.SecurityGroup, vpcID, fmt.Sprintf("%s tier of %s", tier, env)); err != nil {
+			return landingzone.Zone{}, err
+		}
+		groupID := s.SecurityGroupID
+		cloud.Record(ctx, "", "securityGroup", groupID, func(ctx context.Context) error { return DeleteSG(ctx, cfg, groupID) })
+		if err := TagResource(ctx, cfg, groupID, map[string]string{"Name": s.SecurityGroup, "env": env, "tier": tier}); err != nil {
+			return landingzone.Zone{}, err
+		}
+		groups[tier] = groupID
+		zone.Subnets = append(zone.Subnets, s)
+	}
+	//rules go in once every group exists, as app and db allow traffic from the group of another tier.
+	for _, s := range zone.Subnets {
+		if err := AuthorizeIngress(ctx, cfg, s.SecurityGroupID, ipPermissions(landingzone.Rules(s.Tier, req.CIDR), groups)); err != nil {
+			return landingzone.Zone{}, err
+		}
+	}
+	zone.Config = landingzone.Config(providerName, cfg.Region, "", vpcName, zone.Subnets)
+	return zone, nil
+}
+
+//ipPermissions maps landing zone rules to TCP permissions, groups holding the security group of each tier.
+func ipPermissions(rules []landingzone.Rule, groups map[string]string) []ec2.IpPermission {
+
+	perms := make([]ec2.IpPermission, 0, len(rules))
+	for _, rule := range rules {
+		perm := ec2.IpPermission{
+			IpProtocol: aws.String("tcp"),
+			FromPort:   aws.Int64(rule.FromPort),
+			ToPort:     aws.Int64(rule.ToPort),
+		}
+		if rule.Tier != "" {
+			perm.UserIdGroupPairs = []ec2.UserIdGroupPair{{GroupId: aws.String(groups[rule.Tier])}}
+		} else {
+			perm.IpRanges = []ec2.IpRange{{CidrIp: aws.String(rule.CIDR)}}
+		}
+		perms = append(perms, perm)
+	}
+	return perms
 }
@@ -0,0 +1,342 @@
+package aws
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/shakilbd009/go-cloud/cloud"
+	"github.com/shakilbd009/go-cloud/config"
+	"github.com/shakilbd009/go-cloud/naming"
+	"github.com/shakilbd009/go-cloud/secrets"
+)
+
+//allocationProvider returns a Provider whose regions report instances named after the prefix of its requests
+//followed by the given suffixes, and that prefix.
+func allocationProvider(t *testing.T, existing map[string][]string) (*Provider, string, func()) {
+
+	namer := naming.Default()
+	prefix, err := namer.Prefix(providerName, "base", "redhat", "abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, cfg, stop := newFakeEC2(t, "us-east-1", func(call ec2Call) (int, string) {
+		if call.Action != "DescribeInstances" || call.Form.Get("Filter.1.Value.1") != prefix+"*" {
+			return http.StatusBadRequest, ec2Error("InvalidParameterValue", "unexpected "+call.Action+" call")
+		}
+		names := make([]string, 0)
+		for _, suffix := range existing[call.Region] {
+			names = append(names, prefix+suffix)
+		}
+		return http.StatusOK, ec2Response("DescribeInstances", instancesXML(names...))
+	})
+	settings := config.Static{Config: &config.Config{
+		Providers:    map[string]config.ProviderDefaults{providerName: {Region: "us-east-1"}},
+		Environments: map[string]config.Environment{"base": {"web": {providerName: {Region: "us-west-2"}}}},
+	}}
+	return &Provider{Config: cfg, Namer: namer, Settings: settings}, prefix, stop
+}
+
+func TestInstanceNamesAllocateAfterEveryRegion(t *testing.T) {
+
+	p, prefix, stop := allocationProvider(t, map[string][]string{
+		"us-east-1": {"03"},
+		"us-west-2": {"07", "-old99"},
+	})
+	defer stop()
+	payload := AWSrequest{Environment: "base", Osname: "redhat", AppCode: "abc", Max: 3}
+	names, release, err := p.instanceNames(context.Background(), cloud.Request{Names: []string{prefix + "05"}}, payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer release()
+	//a retried request keeps its recorded name and is topped up past the highest name of any region.
+	want := []string{prefix + "05", prefix + "08", prefix + "09"}
+	if fmt.Sprint(names) != fmt.Sprint(want) {
+		t.Errorf("names = %v, want %v", names, want)
+	}
+	if names, _, err := p.instanceNames(context.Background(), cloud.Request{Names: want}, payload); err != nil || fmt.Sprint(names) != fmt.Sprint(want) {
+		t.Errorf("names of a complete retry = %v, %v, want %v", names, err, want)
+	}
+}
+
+func TestInstanceNamesConcurrentRequests(t *testing.T) {
+
+	p, prefix, stop := allocationProvider(t, map[string][]string{"us-east-1": {"02"}})
+	defer stop()
+	const requests = 8
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		all      []string
+		releases []func()
+	)
+	for i := 0; i < requests; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			payload := AWSrequest{Environment: "base", Osname: "redhat", AppCode: "abc", Max: 2}
+			names, release, err := p.instanceNames(context.Background(), cloud.Request{}, payload)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			all = append(all, names...)
+			releases = append(releases, release)
+		}()
+	}
+	wg.Wait()
+	for _, release := range releases {
+		release()
+	}
+	sort.Strings(all)
+	want := make([]string, 0, 2*requests)
+	for seq := 3; seq < 3+2*requests; seq++ {
+		want = append(want, fmt.Sprintf("%s%02d", prefix, seq))
+	}
+	if fmt.Sprint(all) != fmt.Sprint(want) {
+		t.Errorf("concurrent requests got %v, want disjoint names %v", all, want)
+	}
+}
+
+//memorySecrets is a secrets.Store keeping secrets in a map, putErr fails every Put.
+type memorySecrets struct {
+	mu     sync.Mutex
+	values map[string]string
+	putErr error
+}
+
+func (s *memorySecrets) Put(ctx context.Context, name string, value []byte) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.putErr != nil {
+		return "", s.putErr
+	}
+	s.values[name] = string(value)
+	return "mem:" + name, nil
+}
+
+func (s *memorySecrets) Get(ctx context.Context, ref string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	value, ok := s.values[strings.TrimPrefix(ref, "mem:")]
+	if !ok {
+		return nil, secrets.ErrNotFound
+	}
+	return []byte(value), nil
+}
+
+func (s *memorySecrets) Delete(ctx context.Context, ref string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.values, strings.TrimPrefix(ref, "mem:"))
+	return nil
+}
+
+func TestCreateKeyPair(t *testing.T) {
+
+	tests := []struct {
+		name        string
+		putErr      error
+		wantErr     bool
+		wantActions []string
+	}{
+		{name: "stored and tagged", wantActions: []string{"us-west-2:CreateKeyPair", "us-west-2:CreateTags"}},
+		{name: "not stored", putErr: errors.New("vault sealed"), wantErr: true, wantActions: []string{"us-west-2:CreateKeyPair", "us-west-2:DeleteKeyPair"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, cfg, stop := newFakeEC2(t, "us-east-1", func(call ec2Call) (int, string) {
+				switch call.Action {
+				case "CreateKeyPair":
+					return http.StatusOK, ec2Response(call.Action, `<keyName>`+call.Form.Get("KeyName")+`</keyName><keyPairId>key-1</keyPairId>`+
+						`<keyFingerprint>aa:bb</keyFingerprint><keyMaterial>PRIVATE</keyMaterial>`)
+				case "CreateTags", "DeleteKeyPair":
+					return http.StatusOK, ec2Response(call.Action, `<return>true</return>`)
+				}
+				return http.StatusBadRequest, ec2Error("InvalidAction", call.Action)
+			})
+			defer stop()
+			store := &memorySecrets{values: make(map[string]string), putErr: tt.putErr}
+			p := &Provider{Config: cfg, Secrets: store}
+			kp, err := p.CreateKeyPair(context.Background(), "us-west-2", "dev", "deploy")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("CreateKeyPair() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got := f.actions(); !reflect.DeepEqual(got, tt.wantActions) {
+				t.Fatalf("calls = %v, want %v", got, tt.wantActions)
+			}
+			f.mu.Lock()
+			last := f.calls[1].Form
+			f.mu.Unlock()
+			if tt.wantErr {
+				//nobody could log in with a key pair whose private key is lost, so it is deleted.
+				if last.Get("KeyName") != "deploy" {
+					t.Errorf("deleted key pair %q, want deploy", last.Get("KeyName"))
+				}
+				return
+			}
+			if kp.PrivateKeyRef != "mem:aws/us-west-2/keys/deploy" || kp.Environment != "dev" || kp.ID != "key-1" {
+				t.Errorf("key pair = %+v", kp)
+			}
+			if private, err := store.Get(context.Background(), kp.PrivateKeyRef); err != nil || string(private) != "PRIVATE" {
+				t.Errorf("stored private key = %q, %v", private, err)
+			}
+			if last.Get("ResourceId.1") != "key-1" {
+				t.Errorf("tagged %q, want key-1", last.Get("ResourceId.1"))
+			}
+		})
+	}
+}
+
+//filters returns the values of every filter of an EC2 call by filter name.
+func filters(form url.Values) map[string][]string {
+
+	found := make(map[string][]string)
+	for i := 1; form.Get(fmt.Sprintf("Filter.%d.Name", i)) != ""; i++ {
+		values := make([]string, 0)
+		for j := 1; form.Get(fmt.Sprintf("Filter.%d.Value.%d", i, j)) != ""; j++ {
+			values = append(values, form.Get(fmt.Sprintf("Filter.%d.Value.%d", i, j)))
+		}
+		found[form.Get(fmt.Sprintf("Filter.%d.Name", i))] = values
+	}
+	return found
+}
+
+//regionalProvider returns a Provider placing instances in us-east-1 and us-west-2, whose regions answer DescribeInstances
+//with the instances named in found or the error in failed.
+func regionalProvider(t *testing.T, found map[string][]string, failed map[string]string) (*Provider, *fakeEC2, func()) {
+
+	f, cfg, stop := newFakeEC2(t, "us-east-1", func(call ec2Call) (int, string) {
+		if msg, ok := failed[call.Region]; ok {
+			return http.StatusForbidden, ec2Error("UnauthorizedOperation", msg)
+		}
+		return http.StatusOK, ec2Response("DescribeInstances", instancesXML(found[call.Region]...))
+	})
+	settings := config.Static{Config: &config.Config{
+		Providers:    map[string]config.ProviderDefaults{providerName: {Region: "us-east-1"}},
+		Environments: map[string]config.Environment{"dev": {"web": {providerName: {Region: "us-west-2"}}}},
+	}}
+	return &Provider{Config: cfg, Settings: settings}, f, stop
+}
+
+func TestDescribeAcrossRegions(t *testing.T) {
+
+	tests := []struct {
+		name        string
+		req         cloud.Request
+		failed      map[string]string
+		wantFilters map[string][]string
+		want        []string
+		wantErr     string
+	}{
+		{name: "by ids", req: cloud.Request{InstanceIDs: []string{"i-web1", "i-web3"}},
+			wantFilters: map[string][]string{"instance-id": {"i-web1", "i-web3"}}, want: []string{"web1", "web2", "web3"}},
+		{name: "by name", req: cloud.Request{Instance: "web*"},
+			wantFilters: map[string][]string{"tag:Name": {"web*"}}, want: []string{"web1", "web2", "web3"}},
+		{name: "by name and change", req: cloud.Request{Instance: "web1", ChangeNum: "CHG1"},
+			wantFilters: map[string][]string{"tag:Name": {"web1"}, "tag:ChangeNum": {"CHG1"}}, want: []string{"web1", "web2", "web3"}},
+		{name: "nothing to describe by", wantErr: "instanceIds, instanceName or requestNum must be passed to describe EC2 instances"},
+		{name: "failing region", req: cloud.Request{ChangeNum: "CHG1"}, failed: map[string]string{"us-west-2": "denied"},
+			wantErr: "could not describe instances in us-west-2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, f, stop := regionalProvider(t, map[string][]string{"us-east-1": {"web1", "web2"}, "us-west-2": {"web3"}}, tt.failed)
+			defer stop()
+			found, err := p.Describe(context.Background(), tt.req)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Describe() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			names := make([]string, 0, len(found))
+			for _, inst := range found {
+				names = append(names, inst.InstanceName)
+			}
+			if !reflect.DeepEqual(names, tt.want) {
+				t.Errorf("described %v, want %v", names, tt.want)
+			}
+			if want := []string{"us-east-1:DescribeInstances", "us-west-2:DescribeInstances"}; !reflect.DeepEqual(f.actions(), want) {
+				t.Errorf("calls = %v, want %v", f.actions(), want)
+			}
+			f.mu.Lock()
+			defer f.mu.Unlock()
+			for _, call := range f.calls {
+				if got := filters(call.Form); !reflect.DeepEqual(got, tt.wantFilters) {
+					t.Errorf("%s filters = %v, want %v", call.Region, got, tt.wantFilters)
+				}
+			}
+		})
+	}
+}
+
+func TestListAcrossRegions(t *testing.T) {
+
+	live := []string{"pending", "running", "stopping", "stopped"}
+	tests := []struct {
+		name        string
+		filter      cloud.Filter
+		failed      map[string]string
+		wantFilters map[string][]string
+		want        []string
+		wantErr     string
+	}{
+		{name: "by env", filter: cloud.Filter{Environment: "dev"},
+			wantFilters: map[string][]string{"instance-state-name": live, "tag:env": {"dev"}}, want: []string{"web1", "web2", "web3"}},
+		{name: "by everything", filter: cloud.Filter{Environment: "dev", AppCode: "abc", ChangeNum: "CHG1"},
+			wantFilters: map[string][]string{"instance-state-name": live, "tag:env": {"dev"}, "tag:appcode": {"abc"}, "tag:ChangeNum": {"CHG1"}},
+			want:        []string{"web1", "web2", "web3"}},
+		{name: "failing region", filter: cloud.Filter{AppCode: "abc"}, failed: map[string]string{"us-east-1": "denied"},
+			wantErr: "could not list instances in us-east-1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, f, stop := regionalProvider(t, map[string][]string{"us-east-1": {"web1", "web2"}, "us-west-2": {"web3"}}, tt.failed)
+			defer stop()
+			found, err := p.List(context.Background(), tt.filter)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("List() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			names := make([]string, 0, len(found))
+			for _, inst := range found {
+				names = append(names, inst.InstanceName)
+				if inst.Provider != providerName || inst.Environment != "dev" || inst.Status != "running" {
+					t.Errorf("instance %+v", inst)
+				}
+			}
+			if !reflect.DeepEqual(names, tt.want) {
+				t.Errorf("listed %v, want %v", names, tt.want)
+			}
+			f.mu.Lock()
+			defer f.mu.Unlock()
+			if len(f.calls) != 2 {
+				t.Errorf("%d calls, want one per region", len(f.calls))
+			}
+			for _, call := range f.calls {
+				if got := filters(call.Form); !reflect.DeepEqual(got, tt.wantFilters) {
+					t.Errorf("%s filters = %v, want %v", call.Region, got, tt.wantFilters)
+				}
+			}
+		})
+	}
+}
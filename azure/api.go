@@ -4,13 +4,18 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2019-07-01/compute"
 	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2019-09-01/network"
+	"github.com/Azure/go-autorest/autorest"
+	autorestazure "github.com/Azure/go-autorest/autorest/azure"
 	"github.com/Azure/go-autorest/autorest/azure/auth"
 	"github.com/Azure/go-autorest/autorest/to"
+	"github.com/shakilbd009/go-cloud/bootstrap"
 )
 
 //OS object
@@ -21,10 +26,8 @@ type OS struct {
 }
 
 var (
-	provider  = "az"
-	avSku     = "aligned"
-	azRegion  = "eastus"
-	rgNetwork = "az-nonProd-rg-001"
+	provider = "az"
+	avSku    = "aligned"
 )
 
 //GetVM returns a VM object and error of any
@@ -43,7 +46,49 @@ func GetImageVersion(ctx context.Context, pubnoffer OS, os, region, subscription
 	if err != nil {
 		return "", "", err
 	}
-	return pubnoffer.Sku, *(*versn)[len(*versn)-1].Name, nil
+	if versn == nil || len(*versn) == 0 {
+		return "", "", fmt.Errorf("no %s %s %s image found in %s", pubnoffer.Publisher, pubnoffer.Offer, pubnoffer.Sku, region)
+	}
+	names := make([]string, 0, len(*versn))
+	for _, v := range *versn {
+		names = append(names, to.String(v.Name))
+	}
+	return pubnoffer.Sku, latestVersion(names), nil
+}
+
+//latestVersion returns the highest of dotted image versions, comparing each part as a number
+//since the service orders them as strings, where 7.10 comes before 7.9.
+func latestVersion(versions []string) string {
+
+	latest := ""
+	for _, v := range versions {
+		if latest == "" || compareVersions(v, latest) > 0 {
+			latest = v
+		}
+	}
+	return latest
+}
+
+//compareVersions returns -1, 0 or 1 as dotted version a is lower, equal or higher than b.
+func compareVersions(a, b string) int {
+
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(as) || i < len(bs); i++ {
+		var x, y int
+		if i < len(as) {
+			x, _ = strconv.Atoi(as[i])
+		}
+		if i < len(bs) {
+			y, _ = strconv.Atoi(bs[i])
+		}
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		}
+	}
+	return 0
 }
 
 //GetImagePubOfferSku returns Publisher and Offer
@@ -73,15 +118,15 @@ func GetImagePubOfferSku(name, version string) (os OS, e error) {
 	return
 }
 
-//GetDisks with return []compute.DataDisk.
-func GetDisks(disklist *string, vmname string) []compute.DataDisk {
+//GetDisks returns the data disks of vmname for a comma separated list of sizes and error if any.
+func GetDisks(disklist *string, vmname string) ([]compute.DataDisk, error) {
 	sizes := strings.Split(*disklist, ",")
 	disks := make([]compute.DataDisk, 0)
 	for i, v := range sizes {
 		v = strings.TrimSuffix(strings.ToLower(v), "gb")
 		size, err := strconv.Atoi(v)
 		if err != nil {
-			panic(err)
+			return nil, fmt.Errorf("invalid disk size %q: %w", sizes[i], err)
 		}
 		disks = append(disks, compute.DataDisk{
 			Lun:          to.Int32Ptr(int32(i)),
@@ -94,7 +139,7 @@ func GetDisks(disklist *string, vmname string) []compute.DataDisk {
 			},
 		})
 	}
-	return disks
+	return disks, nil
 }
 
 //GetAVS returns an Availability set if exist.
@@ -111,47 +156,39 @@ func GetAVS(ctx context.Context, rg, name, subscription string) (string, error)
 	return *resp.Name, nil
 }
 
-//GetVMname returns VM name.
-func GetVMname(envname, os, app string) string {
-	env := strings.ToLower(envname)
-	os = strings.ToLower(os)
-	b := "b"
-	d := "d"
-	p := "p"
-	w := "w"
-	x := "x"
-	s := "s"
-	switch {
-	case env == "base" && os == "windows":
-		return fmt.Sprintf("az%s%sw%s%s", b, w, d, app)
-	case env == "base" && os == "redhat":
-		return fmt.Sprintf("az%s%sw%s%s", b, x, d, app)
-	case env == "base" && os == "suse":
-		return fmt.Sprintf("az%s%sw%s%s", b, x, d, app)
-	case env == "prod" && os == "windows":
-		return fmt.Sprintf("az%s%sw%s%s", p, w, p, app)
-	case env == "prod" && os == "redhat":
-		return fmt.Sprintf("az%s%sw%s%s", p, x, p, app)
-	case env == "prod" && os == "suse":
-		return fmt.Sprintf("az%s%sw%s%s", p, x, p, app)
-	case env == "nonprod" && os == "windows":
-		return fmt.Sprintf("az%s%sw%s%s", s, w, d, app)
-	case env == "nonprod" && os == "redhat":
-		return fmt.Sprintf("az%s%sw%s%s", s, x, d, app)
-	case env == "nonprod" && os == "suse":
-		return fmt.Sprintf("az%s%sw%s%s", s, x, d, app)
-	}
-	return ""
+//VMExists reports whether a VM with the given name exists in the resource group rg, anywhere in the subscription if rg is empty.
+func VMExists(ctx context.Context, subscription, rg, name string) (bool, error) {
+
+	client := vmClient(subscription)
+	if rg != "" {
+		_, err := client.Get(ctx, rg, name, "")
+		if IsNotFound(err) {
+			return false, nil
+		}
+		return err == nil, err
+	}
+	iter, err := client.ListAllComplete(ctx, "")
+	if err != nil {
+		return false, err
+	}
+	for iter.NotDone() {
+		if vm := iter.Value(); vm.Name != nil && strings.EqualFold(*vm.Name, name) {
+			return true, nil
+		}
+		if err := iter.NextWithContext(ctx); err != nil {
+			return false, err
+		}
+	}
+	return false, nil
 }
 
-//CreateNIC creates a NIC and returns its ID over a chan.
-func CreateNIC(ctx context.Context, rg, nicname, subscription, loc, subid string, ch chan string) {
+//CreateNIC creates a NIC and returns its ID and error if any.
+func CreateNIC(ctx context.Context, rg, nicname, subscription, loc, subid string) (string, error) {
 	client := network.NewInterfacesClient(subscription)
 	authorizer, err := auth.NewAuthorizerFromCLI()
 	if err == nil {
 		client.Authorizer = authorizer
 	}
-	//defer errRecover()
 	resp, err := client.CreateOrUpdate(ctx,
 		rg,
 		nicname,
@@ -174,12 +211,17 @@ func CreateNIC(ctx context.Context, rg, nicname, subscription, loc, subid string
 			},
 		},
 	)
-	//time.Sleep(time.Second * 5)
+	if err != nil {
+		return "", fmt.Errorf("could not create NIC %s: %w", nicname, err)
+	}
+	if err := resp.WaitForCompletionRef(ctx, client.Client); err != nil {
+		return "", fmt.Errorf("could not create NIC %s: %w", nicname, err)
+	}
 	inter, err := resp.Result(client)
 	if err != nil {
-		panic(err)
+		return "", fmt.Errorf("could not create NIC %s: %w", nicname, err)
 	}
-	ch <- *inter.ID
+	return *inter.ID, nil
 }
 
 func vmClient(subscription string) compute.VirtualMachinesClient {
@@ -191,18 +233,62 @@ func vmClient(subscription string) compute.VirtualMachinesClient {
 	return vmClient
 }
 
-//CreateVM create a VM.
-func CreateVM(ctx context.Context, rg, vmname, username, passwd, nic, avsID, region, publisher, offer, sku, version, subscription string, crq *string, datadisks *[]compute.DataDisk, ch chan string) {
-	client := vmClient(subscription)
-	//defer errRecover()
+//VMParams object describes the VM CreateVM builds, Password is only set on the VM when SSHKey is empty.
+type VMParams struct {
+	Subscription    string
+	RG              string
+	Name            string
+	Size            string
+	Region          string
+	Username        string
+	Password        string
+	SSHKey          string
+	NIC             string
+	AvailabilitySet string
+	Publisher       string
+	Offer           string
+	Sku             string
+	Version         string
+	CustomData      string
+	Tags            map[string]*string
+	DataDisks       *[]compute.DataDisk
+}
+
+//CreateVM creates the VM of params and waits for it, logging in with its ssh key only if set, else with its password. It returns the VM and error if any.
+func CreateVM(ctx context.Context, params VMParams) (compute.VirtualMachine, error) {
+
+	client := vmClient(params.Subscription)
+	vmname, username := params.Name, params.Username
+	osProfile := &compute.OSProfile{
+		ComputerName:  to.StringPtr(vmname),
+		AdminUsername: to.StringPtr(username),
+	}
+	if params.SSHKey != "" {
+		osProfile.LinuxConfiguration = &compute.LinuxConfiguration{
+			DisablePasswordAuthentication: to.BoolPtr(true),
+			SSH: &compute.SSHConfiguration{
+				PublicKeys: &[]compute.SSHPublicKey{
+					{
+						Path:    to.StringPtr(fmt.Sprintf("/home/%s/.ssh/authorized_keys", username)),
+						KeyData: to.StringPtr(params.SSHKey),
+					},
+				},
+			},
+		}
+	} else {
+		osProfile.AdminPassword = to.StringPtr(params.Password)
+	}
+	if params.CustomData != "" {
+		osProfile.CustomData = to.StringPtr(bootstrap.CustomData(params.CustomData))
+	}
 	resp, err := client.CreateOrUpdate(ctx,
-		rg,
+		params.RG,
 		vmname,
 		compute.VirtualMachine{
-			Location: to.StringPtr(region),
+			Location: to.StringPtr(params.Region),
 			VirtualMachineProperties: &compute.VirtualMachineProperties{
 				HardwareProfile: &compute.HardwareProfile{
-					VMSize: compute.VirtualMachineSizeTypesStandardB1s,
+					VMSize: compute.VirtualMachineSizeTypes(params.Size),
 				},
 				StorageProfile: &compute.StorageProfile{
 					OsDisk: &compute.OSDisk{
@@ -214,57 +300,45 @@ func CreateVM(ctx context.Context, rg, vmname, username, passwd, nic, avsID, reg
 						},
 					},
 					ImageReference: &compute.ImageReference{
-						Publisher: to.StringPtr(publisher),
-						Offer:     to.StringPtr(offer),
-						Sku:       to.StringPtr(sku),
-						Version:   to.StringPtr(version),
+						Publisher: to.StringPtr(params.Publisher),
+						Offer:     to.StringPtr(params.Offer),
+						Sku:       to.StringPtr(params.Sku),
+						Version:   to.StringPtr(params.Version),
 					},
-					DataDisks: datadisks,
-				},
-				OsProfile: &compute.OSProfile{
-					ComputerName:  to.StringPtr(vmname),
-					AdminUsername: to.StringPtr(username),
-					AdminPassword: to.StringPtr(passwd),
+					DataDisks: params.DataDisks,
 				},
+				OsProfile: osProfile,
 				NetworkProfile: &compute.NetworkProfile{
 					NetworkInterfaces: &[]compute.NetworkInterfaceReference{
 						{
-							ID: to.StringPtr(nic),
+							ID: to.StringPtr(params.NIC),
 						},
 					},
 				},
 				AvailabilitySet: &compute.SubResource{
-					ID: to.StringPtr(avsID),
+					ID: to.StringPtr(params.AvailabilitySet),
 				},
 			},
-			Tags: map[string]*string{"Request#": crq},
+			Tags: params.Tags,
 		},
 	)
 	if err != nil {
-		panic(err)
+		return compute.VirtualMachine{}, fmt.Errorf("could not create VM %s: %w", vmname, err)
 	}
 	err = resp.WaitForCompletionRef(ctx, client.Client)
 	if err != nil {
-		panic(err)
+		return compute.VirtualMachine{}, fmt.Errorf("could not create VM %s: %w", vmname, err)
 	}
-	inter, err := resp.Result(client)
-	if err != nil {
-		panic(err)
-	}
-	if err != nil {
-		panic(err)
-	}
-	ch <- *inter.Name
+	return resp.Result(client)
 }
 
-//CreateAVS creates an AVset and returns ID over a chan
-func CreateAVS(ctx context.Context, name, rg, sku, loc, subscription string, ch chan string) {
+//CreateAVS creates an AVset and returns its ID and error if any.
+func CreateAVS(ctx context.Context, name, rg, sku, loc, subscription string) (string, error) {
 	client := compute.NewAvailabilitySetsClient(subscription)
 	authorizer, err := auth.NewAuthorizerFromCLI()
 	if err == nil {
 		client.Authorizer = authorizer
 	}
-	//defer errRecover()
 	avSet, err := client.CreateOrUpdate(ctx,
 		rg,
 		name,
@@ -281,20 +355,19 @@ func CreateAVS(ctx context.Context, name, rg, sku, loc, subscription string, ch
 		},
 	)
 	if err != nil {
-		panic(err)
+		return "", fmt.Errorf("could not create availability set %s: %w", name, err)
 	}
-	ch <- *avSet.ID
-	close(ch)
+	return *avSet.ID, nil
 }
 
-//GetVMimages makes a call to azure and sends image details over a chan
+//GetVMimages returns the image versions of a publisher, offer and sku in region.
+//The List operation is not paged, without $top it returns every version in a single response, so nothing is left behind.
 func GetVMimages(ctx context.Context, region, publisher, offer, skus, subscription string) (*[]compute.VirtualMachineImageResource, error) {
 	client := compute.NewVirtualMachineImagesClient(subscription)
 	authorizer, err := auth.NewAuthorizerFromCLI()
 	if err == nil {
 		client.Authorizer = authorizer
 	}
-	//defer errRecover()
 	result, err := client.List(ctx, region, publisher, offer, skus, "", nil, "")
 	if err != nil {
 		return nil, err
@@ -302,98 +375,339 @@ func GetVMimages(ctx context.Context, region, publisher, offer, skus, subscripti
 	return result.Value, nil
 }
 
-//GetSubnetName returns subnet name and an error.
-func GetSubnetName(tier, envname string) (string, error) {
-	baseAppSub := []string{"az-base-sub-001", "az-base-app-sub-002"}
-	ProdAppSub := []string{"az-Prod-sub-001", "az-Prod-app-sub-002"}
-	nonProdAppSub := []string{"az-nonProd-sub-001", "az-nonProd-app-sub-002"}
-	envname = strings.TrimSpace(strings.ToLower(envname))
-	tiername := strings.TrimSpace(strings.ToLower(tier))
-	switch {
-	case envname == "nonprod" && tiername == "app":
-		return nonProdAppSub[1], nil
-	case envname == "nonprod" && tiername == "web":
-		return nonProdAppSub[0], nil
-	case envname == "prod" && tiername == "app":
-		return ProdAppSub[1], nil
-	case envname == "prod" && tiername == "web":
-		return ProdAppSub[0], nil
-	case envname == "base" && tiername == "app":
-		return baseAppSub[1], nil
-	case envname == "base" && tiername == "web":
-		return baseAppSub[0], nil
-	}
-	err := errors.New("please pass an env as prod, base or nonprod. And tier can only be app or web")
-	return "", err
+//GetSubnet returns the subnet ID and error if any.
+func GetSubnet(ctx context.Context, rg, sname, vname, subscription string) (string, error) {
+	client := network.NewSubnetsClient(subscription)
+	authorizer, err := auth.NewAuthorizerFromCLI()
+	if err == nil {
+		client.Authorizer = authorizer
+	}
+	resp, err := client.Get(ctx, rg, vname, sname, "")
+	if err != nil {
+		return "", fmt.Errorf("could not get subnet %s of %s: %w", sname, vname, err)
+	}
+	return *resp.ID, nil
 }
 
-//GetNetwork returns a vnet name or an error.
-func GetNetwork(envname string) (string, error) {
-	network := []string{"az-base-vnet-001", "az-nonProd-vnet-001", "az-Prod-vnet-001"}
-	envname = strings.TrimSpace(strings.ToLower(envname))
-	switch {
-	case envname == "base":
-		return network[0], nil
-	case envname == "nonprod":
-		return network[1], nil
-	case envname == "prod":
-		return network[2], nil
-	}
-	err := errors.New("provide a network envname, i.e base, dev, prod")
-	return "", err
+//DeleteVM deletes a VM along with its NICs and OS disk, and its data disks unless keepDisks is set.
+//It returns the resource ID of the deleted VM.
+func DeleteVM(ctx context.Context, rg, vmname, subscription string, keepDisks bool) (string, error) {
+
+	client := vmClient(subscription)
+	vm, err := client.Get(ctx, rg, vmname, "")
+	if err != nil {
+		return "", err
+	}
+	disks := make([]string, 0)
+	if vm.StorageProfile != nil {
+		if vm.StorageProfile.OsDisk != nil && vm.StorageProfile.OsDisk.ManagedDisk != nil {
+			disks = append(disks, *vm.StorageProfile.OsDisk.ManagedDisk.ID)
+		}
+		if vm.StorageProfile.DataDisks != nil && !keepDisks {
+			for _, disk := range *vm.StorageProfile.DataDisks {
+				if disk.ManagedDisk != nil {
+					disks = append(disks, *disk.ManagedDisk.ID)
+				}
+			}
+		}
+	}
+	nics := make([]string, 0)
+	if vm.NetworkProfile != nil && vm.NetworkProfile.NetworkInterfaces != nil {
+		for _, nic := range *vm.NetworkProfile.NetworkInterfaces {
+			nics = append(nics, *nic.ID)
+		}
+	}
+	future, err := client.Delete(ctx, rg, vmname)
+	if err != nil {
+		return "", err
+	}
+	if err := future.WaitForCompletionRef(ctx, client.Client); err != nil {
+		return "", err
+	}
+	for _, id := range nics {
+		if err := DeleteNIC(ctx, id, subscription); err != nil {
+			return "", err
+		}
+	}
+	for _, id := range disks {
+		if err := DeleteDisk(ctx, id, subscription); err != nil {
+			return "", err
+		}
+	}
+	return to.String(vm.ID), nil
 }
 
-//GetSubnet sends the subnet ID over a chan
-func GetSubnet(ctx context.Context, rg, sname, vname, subscription string, ch chan string) {
-	client := network.NewSubnetsClient(subscription)
+//DeleteNIC deletes a NIC given its resource ID.
+func DeleteNIC(ctx context.Context, id, subscription string) error {
+	resource, err := autorestazure.ParseResourceID(id)
+	if err != nil {
+		return err
+	}
+	client := network.NewInterfacesClient(subscription)
 	authorizer, err := auth.NewAuthorizerFromCLI()
-	//defer errRecover()
 	if err == nil {
 		client.Authorizer = authorizer
 	}
-	resp, err := client.Get(ctx, rg, vname, sname, "")
+	future, err := client.Delete(ctx, resource.ResourceGroup, resource.ResourceName)
+	if err != nil {
+		return err
+	}
+	return future.WaitForCompletionRef(ctx, client.Client)
+}
+
+//DeleteDisk deletes a managed disk given its resource ID.
+func DeleteDisk(ctx context.Context, id, subscription string) error {
+	resource, err := autorestazure.ParseResourceID(id)
+	if err != nil {
+		return err
+	}
+	client := compute.NewDisksClient(subscription)
+	authorizer, err := auth.NewAuthorizerFromCLI()
+	if err == nil {
+		client.Authorizer = authorizer
+	}
+	future, err := client.Delete(ctx, resource.ResourceGroup, resource.ResourceName)
 	if err != nil {
-		panic(err)
+		return err
 	}
-	ch <- *resp.ID
-	close(ch)
+	return future.WaitForCompletionRef(ctx, client.Client)
 }
 
-func errRecover() {
-	if r := recover(); r != nil {
-		fmt.Println("An error has occured:")
-		fmt.Printf("%s\n\n", strings.Repeat("💀", 20))
-		fmt.Println(r)
-		fmt.Printf("\n")
-		fmt.Println(strings.Repeat("💀", 20))
-		//os.Exit(1) //optional, if you want to stop the excution if error occurs.
+//WaitVMRunning polls the instance view of a VM until its power state is running, returns the time it was provisioned and error if any.
+func WaitVMRunning(ctx context.Context, rg, vmname, subscription string) (string, error) {
+
+	client := vmClient(subscription)
+	for {
+		view, err := client.InstanceView(ctx, rg, vmname)
+		if err != nil {
+			return "", err
+		}
+		running, booted := false, ""
+		if view.Statuses != nil {
+			for _, status := range *view.Statuses {
+				code := to.String(status.Code)
+				switch {
+				case code == "PowerState/running":
+					running = true
+				case strings.HasPrefix(code, "ProvisioningState/failed"):
+					return "", fmt.Errorf("VM %s %s", vmname, to.String(status.DisplayStatus))
+				case code == "ProvisioningState/succeeded" && status.Time != nil:
+					booted = status.Time.UTC().Format(time.RFC3339)
+				}
+			}
+		}
+		if running {
+			return booted, nil
+		}
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-time.After(10 * time.Second):
+		}
 	}
 }
 
-func getImageVersion(ctx context.Context, pubnoffer OS, ch chan *[]compute.VirtualMachineImageResource, subscription, region string) []AZimages {
-	go getVMimages(ctx, region, pubnoffer.Publisher, pubnoffer.Offer, pubnoffer.Sku, subscription, ch)
-	versn := (*<-ch)
-	img := AZimages{}
-	versions := make([]AZimages, len(versn))
-	for i, v := range versn {
-		img.Name = *v.Name
-		img.Ver = pubnoffer.Sku
-		versions[i] = img
-	}
-	return versions
+//NICPrivateIPs returns the private IPs of the NIC with the given ID and error if any.
+func NICPrivateIPs(ctx context.Context, id, subscription string) ([]string, error) {
+	resource, err := autorestazure.ParseResourceID(id)
+	if err != nil {
+		return nil, err
+	}
+	client := network.NewInterfacesClient(subscription)
+	authorizer, err := auth.NewAuthorizerFromCLI()
+	if err == nil {
+		client.Authorizer = authorizer
+	}
+	nic, err := client.Get(ctx, resource.ResourceGroup, resource.ResourceName, "")
+	if err != nil {
+		return nil, err
+	}
+	ips := make([]string, 0)
+	if nic.InterfacePropertiesFormat == nil || nic.IPConfigurations == nil {
+		return ips, nil
+	}
+	for _, cfg := range *nic.IPConfigurations {
+		if cfg.InterfaceIPConfigurationPropertiesFormat != nil && cfg.PrivateIPAddress != nil {
+			ips = append(ips, *cfg.PrivateIPAddress)
+		}
+	}
+	return ips, nil
 }
 
-func getVMimages(ctx context.Context, region, publisher, offer, skus, subscription string, ch chan *[]compute.VirtualMachineImageResource) {
-	client := compute.NewVirtualMachineImagesClient(subscription)
+//ListVMs returns the VMs of the resource group rg, of the whole subscription if rg is empty, carrying every tag in tags.
+//Empty tag values are not filtered on.
+func ListVMs(ctx context.Context, subscription, rg string, tags map[string]string) ([]compute.VirtualMachine, error) {
+
+	client := vmClient(subscription)
+	var (
+		iter compute.VirtualMachineListResultIterator
+		err  error
+	)
+	if rg != "" {
+		iter, err = client.ListComplete(ctx, rg)
+	} else {
+		iter, err = client.ListAllComplete(ctx, "")
+	}
+	if err != nil {
+		return nil, err
+	}
+	vms := make([]compute.VirtualMachine, 0)
+	for iter.NotDone() {
+		vm := iter.Value()
+		match := true
+		for key, value := range tags {
+			if value != "" && !strings.EqualFold(to.String(vm.Tags[key]), value) {
+				match = false
+			}
+		}
+		if match {
+			vms = append(vms, vm)
+		}
+		if err := iter.NextWithContext(ctx); err != nil {
+			return nil, err
+		}
+	}
+	return vms, nil
+}
+
+//ListNICPrivateIPs returns the private IPs of every NIC of the resource group rg, of the whole subscription if rg is empty,
+//keyed by the lower cased NIC ID.
+func ListNICPrivateIPs(ctx context.Context, subscription, rg string) (map[string][]string, error) {
+
+	client := network.NewInterfacesClient(subscription)
 	authorizer, err := auth.NewAuthorizerFromCLI()
 	if err == nil {
 		client.Authorizer = authorizer
 	}
-	defer errRecover()
-	result, err := client.List(ctx, region, publisher, offer, skus, "", nil, "")
+	var iter network.InterfaceListResultIterator
+	if rg != "" {
+		iter, err = client.ListComplete(ctx, rg)
+	} else {
+		iter, err = client.ListAllComplete(ctx)
+	}
+	if err != nil {
+		return nil, err
+	}
+	ips := make(map[string][]string)
+	for iter.NotDone() {
+		nic := iter.Value()
+		id := strings.ToLower(to.String(nic.ID))
+		ips[id] = make([]string, 0)
+		if nic.InterfacePropertiesFormat != nil && nic.IPConfigurations != nil {
+			for _, cfg := range *nic.IPConfigurations {
+				if cfg.InterfaceIPConfigurationPropertiesFormat != nil && cfg.PrivateIPAddress != nil {
+					ips[id] = append(ips[id], *cfg.PrivateIPAddress)
+				}
+			}
+		}
+		if err := iter.NextWithContext(ctx); err != nil {
+			return nil, err
+		}
+	}
+	return ips, nil
+}
+
+//IsNotFound reports whether err is a 404 from the Azure API.
+func IsNotFound(err error) bool {
+	var derr autorest.DetailedError
+	return errors.As(err, &derr) && derr.StatusCode == http.StatusNotFound
+}
+
+//DeleteAVS deletes an availability set.
+func DeleteAVS(ctx context.Context, rg, name, subscription string) error {
+	client := compute.NewAvailabilitySetsClient(subscription)
+	authorizer, err := auth.NewAuthorizerFromCLI()
+	if err == nil {
+		client.Authorizer = authorizer
+	}
+	_, err = client.Delete(ctx, rg, name)
+	return err
+}
+
+func networkClients(subscription string) (network.VirtualNetworksClient, network.SecurityGroupsClient) {
+	vnets, nsgs := network.NewVirtualNetworksClient(subscription), network.NewSecurityGroupsClient(subscription)
+	authorizer, err := auth.NewAuthorizerFromCLI()
+	if err == nil {
+		vnets.Authorizer, nsgs.Authorizer = authorizer, authorizer
+	}
+	return vnets, nsgs
+}
+
+//GetVNet returns the ID of a virtual network and error if any.
+func GetVNet(ctx context.Context, rg, name, subscription string) (string, error) {
+	client, _ := networkClients(subscription)
+	vnet, err := client.Get(ctx, rg, name, "")
+	if err != nil {
+		return "", err
+	}
+	return to.String(vnet.ID), nil
+}
+
+//CreateVNet creates a virtual network of cidr with the given subnets, waits for it and returns its ID and error if any.
+func CreateVNet(ctx context.Context, rg, name, loc, cidr, subscription string, subnets []network.Subnet, tags map[string]*string) (string, error) {
+
+	client, _ := networkClients(subscription)
+	future, err := client.CreateOrUpdate(ctx, rg, name, network.VirtualNetwork{
+		Location: to.StringPtr(loc),
+		Tags:     tags,
+		VirtualNetworkPropertiesFormat: &network.VirtualNetworkPropertiesFormat{
+			AddressSpace: &network.AddressSpace{AddressPrefixes: &[]string{cidr}},
+			Subnets:      &subnets,
+		},
+	})
+	if err != nil {
+		return "", fmt.Errorf("could not create virtual network %s: %w", name, err)
+	}
+	if err := future.WaitForCompletionRef(ctx, client.Client); err != nil {
+		return "", fmt.Errorf("could not create virtual network %s: %w", name, err)
+	}
+	vnet, err := future.Result(client)
+	if err != nil {
+		return "", fmt.Errorf("could not create virtual network %s: %w", name, err)
+	}
+	return to.String(vnet.ID), nil
+}
+
+//DeleteVNet deletes a virtual network and waits for it.
+func DeleteVNet(ctx context.Context, rg, name, subscription string) error {
+	client, _ := networkClients(subscription)
+	future, err := client.Delete(ctx, rg, name)
+	if err != nil {
+		return err
+	}
+	return future.WaitForCompletionRef(ctx, client.Client)
+}
+
+//CreateNSG creates a network security group with the given rules, waits for it and returns its ID and error if any.
+func CreateNSG(ctx context.Context, rg, name, loc, subscription string, rules []network.SecurityRule, tags map[string]*string) (string, error) {
+
+	_, client := networkClients(subscription)
+	future, err := client.CreateOrUpdate(ctx, rg, name, network.SecurityGroup{
+		Location: to.StringPtr(loc),
+		Tags:     tags,
+		SecurityGroupPropertiesFormat: &network.SecurityGroupPropertiesFormat{
+			SecurityRules: &rules,
+		},
+	})
+	if err != nil {
+		return "", fmt.Errorf("could not create network security group %s: %w", name, err)
+	}
+	if err := future.WaitForCompletionRef(ctx, client.Client); err != nil {
+		return "", fmt.Errorf("could not create network security group %s: %w", name, err)
+	}
+	nsg, err := future.Result(client)
+	if err != nil {
+		return "", fmt.Errorf("could not create network security group %s: %w", name, err)
+	}
+	return to.String(nsg.ID), nil
+}
+
+//DeleteNSG deletes a network security group and waits for it.
+func DeleteNSG(ctx context.Context, rg, name, subscription string) error {
+	_, client := networkClients(subscription)
+	future, err := client.Delete(ctx, rg, name)
 	if err != nil {
-		panic(err)
+		return err
 	}
-	ch <- result.Value
-	close(ch)
+	return future.WaitForCompletionRef(ctx, client.Client)
 }
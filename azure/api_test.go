@@ -0,0 +1,25 @@
+package azure
+
+import "testing"
+
+func TestLatestVersion(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		versions []string
+		want     string
+	}{
+		{name: "service order", versions: []string{"7.4.2020", "7.5.2021", "7.6.2021"}, want: "7.6.2021"},
+		{name: "numeric not lexical", versions: []string{"7.10.1", "7.9.20", "7.2.100"}, want: "7.10.1"},
+		{name: "longer wins a tie", versions: []string{"8.1", "8.1.1", "8.0.9"}, want: "8.1.1"},
+		{name: "single", versions: []string{"2019.0.20190410"}, want: "2019.0.20190410"},
+		{name: "none", versions: nil, want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := latestVersion(tt.versions); got != tt.want {
+				t.Errorf("latestVersion(%v) = %q, want %q", tt.versions, got, tt.want)
+			}
+		})
+	}
+}
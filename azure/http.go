@@ -1,32 +1,41 @@
 package azure
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
-	"io"
-	"log"
-	"net/http"
-	"os"
-	"strconv"
 	"strings"
 	"sync"
-	"time"
 
-	"github.com/Azure/azure-sdk-for-go/services/compute/mgmt/2019-07-01/compute"
+	"github.com/Azure/azure-sdk-for-go/services/network/mgmt/2019-09-01/network"
+	"github.com/Azure/go-autorest/autorest/to"
+	"github.com/shakilbd009/go-cloud/cloud"
+	"github.com/shakilbd009/go-cloud/config"
+	"github.com/shakilbd009/go-cloud/landingzone"
+	"github.com/shakilbd009/go-cloud/naming"
+	"github.com/shakilbd009/go-cloud/secrets"
+	"github.com/shakilbd009/go-cloud/validate"
 )
 
+const providerName = "azure"
+
 //AZrequest object
 type AZrequest struct {
-	Environment string `json:"env"`
-	Tier        string `json:"tier"`
-	Osname      string `json:"os"`
-	OsFlavor    string `json:"flavor"`
-	Disks       string `json:"disks"`
-	CountTO     string `json:"countTO"`
-	AppCode     string `json:"appCode"`
-	ChangeNum   string `json:"requestNum"`
-	RG          string `json:"resourceGroup"`
-	VMname      string `json:"vmName"`
+	Environment  string `json:"env"`
+	Tier         string `json:"tier"`
+	Osname       string `json:"os"`
+	OsFlavor     string `json:"flavor"`
+	Disks        string `json:"disks"`
+	CountTO      string `json:"countTO"`
+	Count        int    `json:"count"`
+	AppCode      string `json:"appCode"`
+	ChangeNum    string `json:"requestNum"`
+	InstanceType string `json:"instanceType"`
+	RG           string `json:"resourceGroup"`
+	VMname       string `json:"vmName"`
+	Wait         bool   `json:"wait"`
+	WaitTimeout  string `json:"waitTimeout"`
+	UserData     string `json:"userData"`
+	SSHKey       string `json:"sshKey"`
 }
 
 //AZimages object
@@ -36,110 +45,613 @@ type AZimages struct {
 }
 
 //AZresponse object
-type AZresponse struct {
-	VMname string                 `json:"VirtualMachine"`
-	Status string                 `json:"status"`
-	NIC    compute.VirtualMachine `json:"networkInterfaces,omitempty"`
+type AZresponse = cloud.Instance
+
+//Provider implements cloud.Provider for azure.
+type Provider struct {
+	Subscription string
+	Username     string
+	Secrets      secrets.Store
+	Namer        *naming.Namer
+	Settings     config.Source
+}
+
+//NewProvider returns a Provider for the given subscription, VM admin passwords are generated and kept in store.
+func NewProvider(subscription, username string, store secrets.Store, settings config.Source) *Provider {
+	return &Provider{
+		Subscription: subscription,
+		Username:     username,
+		Secrets:      store,
+		Namer:        naming.Default(),
+		Settings:     settings,
+	}
+}
+
+//credential object holds the admin password or ssh public key of a VM and the reference of its secret.
+type credential struct {
+	passwd string
+	sshKey string
+	ref    string
+}
+
+//credentials returns the admin credential of every VM name.
+//Linux VMs get the ssh key of req, or a generated one each, windows VMs a generated password. Generated secrets are stored.
+func (p *Provider) credentials(ctx context.Context, req cloud.Request, names []string) (map[string]credential, error) {
+
+	creds := make(map[string]credential, len(names))
+	windows := strings.EqualFold(req.Osname, "windows")
+	for _, name := range names {
+		if !windows && req.SSHPublicKey != "" {
+			creds[name] = credential{sshKey: req.SSHPublicKey, ref: req.SSHKeyRef}
+			continue
+		}
+		if !windows {
+			private, public, err := secrets.GenerateSSHKey(2048)
+			if err != nil {
+				return nil, err
+			}
+			ref, err := p.Secrets.Put(ctx, fmt.Sprintf("azure/%s/%s/ssh", req.RG, name), []byte(private))
+			if err != nil {
+				return nil, fmt.Errorf("could not store ssh key of %s: %w", name, err)
+			}
+			p.recordSecret(ctx, name, ref)
+			creds[name] = credential{sshKey: public, ref: ref}
+			continue
+		}
+		passwd, err := secrets.GeneratePassword(24)
+		if err != nil {
+			return nil, err
+		}
+		ref, err := p.Secrets.Put(ctx, fmt.Sprintf("azure/%s/%s/admin", req.RG, name), []byte(passwd))
+		if err != nil {
+			return nil, fmt.Errorf("could not store admin password of %s: %w", name, err)
+		}
+		p.recordSecret(ctx, name, ref)
+		creds[name] = credential{passwd: passwd, ref: ref}
+	}
+	return creds, nil
+}
+
+//recordSecret records the secret generated for VM name on the saga of ctx, so it goes away with the VM.
+func (p *Provider) recordSecret(ctx context.Context, name, ref string) {
+	cloud.Record(ctx, name, "secret", ref, func(ctx context.Context) error { return p.Secrets.Delete(ctx, ref) })
+}
+
+//NewAZrequest maps a cloud.Request into an AZrequest.
+func NewAZrequest(req cloud.Request) AZrequest {
+
+	vmName := req.VMname
+	if vmName == "" {
+		vmName = req.Instance
+	}
+	return AZrequest{
+		Environment:  req.Environment,
+		Tier:         req.Tier,
+		Osname:       req.Osname,
+		OsFlavor:     req.OsFlavor,
+		Disks:        req.Disks,
+		CountTO:      req.CountTO,
+		Count:        req.Count,
+		AppCode:      req.AppCode,
+		ChangeNum:    req.ChangeNum,
+		InstanceType: req.InstanceType,
+		RG:           req.RG,
+		VMname:       vmName,
+		Wait:         req.Wait,
+		WaitTimeout:  req.WaitTimeout,
+		UserData:     req.UserData,
+		SSHKey:       req.SSHKey,
+	}
+}
+
+//newRequest maps req into an AZrequest, using the configured default VM size if none is passed.
+func (p *Provider) newRequest(req cloud.Request) AZrequest {
+
+	payload := NewAZrequest(req)
+	if payload.InstanceType == "" {
+		payload.InstanceType = p.Settings.Current().Provider(providerName).InstanceType
+	}
+	return payload
+}
+
+//Request maps an AZrequest into a cloud.Request.
+func (r AZrequest) Request() cloud.Request {
+	return cloud.Request{
+		Provider:     providerName,
+		Environment:  r.Environment,
+		Tier:         r.Tier,
+		Osname:       r.Osname,
+		OsFlavor:     r.OsFlavor,
+		Disks:        r.Disks,
+		CountTO:      r.CountTO,
+		Count:        r.Count,
+		AppCode:      r.AppCode,
+		ChangeNum:    r.ChangeNum,
+		InstanceType: r.InstanceType,
+		RG:           r.RG,
+		VMname:       r.VMname,
+		Wait:         r.Wait,
+		WaitTimeout:  r.WaitTimeout,
+		UserData:     r.UserData,
+		SSHKey:       r.SSHKey,
+	}
+}
+
+//Name returns the provider name.
+func (p *Provider) Name() string { return providerName }
+
+//Rules returns what azure accepts in a request.
+func (p *Provider) Rules() validate.Rules {
+	return validate.Rules{
+		Provider: providerName,
+		OS: map[string][]string{
+			"windows": {},
+			"redhat":  {},
+			"suse":    {},
+		},
+		MaxDiskGB: 32767,
+		CountMode: validate.CountRange,
+		MaxCount:  20,
+		Identity:  []string{"resourceGroup", "vmName"},
+	}
 }
 
-//Get makes GET method to azure.
-func Get(w http.ResponseWriter, r *http.Request, subscription string, payload AZrequest) {
+//resourceGroups returns the configured resource groups VMs are placed in, or a single empty one standing for the whole subscription.
+func (p *Provider) resourceGroups() []string {
 
-	vm, err := GetVM(r.Context(), subscription, payload)
+	if rgs := p.Settings.Current().Provider(providerName).ResourceGroups; len(rgs) > 0 {
+		return rgs
+	}
+	return []string{""}
+}
+
+//checkResourceGroup returns an error if VMs can't be placed in rg.
+func (p *Provider) checkResourceGroup(rg string) error {
+
+	rgs := p.Settings.Current().Provider(providerName).ResourceGroups
+	if len(rgs) == 0 {
+		return nil
+	}
+	for _, allowed := range rgs {
+		if strings.EqualFold(allowed, rg) {
+			return nil
+		}
+	}
+	return fmt.Errorf("resource group %q is not configured for VMs, use one of %s", rg, strings.Join(rgs, ", "))
+}
+
+//Exists reports whether a VM with the given name exists in a configured resource group.
+func (p *Provider) Exists(ctx context.Context, name string) (bool, error) {
+
+	for _, rg := range p.resourceGroups() {
+		found, err := VMExists(ctx, p.Subscription, rg, name)
+		if err != nil || found {
+			return found, err
+		}
+	}
+	return false, nil
+}
+
+//NamesWithPrefix returns the names of the VMs of the configured resource groups starting with prefix.
+func (p *Provider) NamesWithPrefix(ctx context.Context, prefix string) ([]string, error) {
+
+	names := make([]string, 0)
+	for _, rg := range p.resourceGroups() {
+		vms, err := ListVMs(ctx, p.Subscription, rg, nil)
+		if err != nil {
+			return nil, err
+		}
+		for _, vm := range vms {
+			if name := to.String(vm.Name); len(name) >= len(prefix) && strings.EqualFold(name[:len(prefix)], prefix) {
+				names = append(names, name)
+			}
+		}
+	}
+	return names, nil
+}
+
+//vmNames returns the names covered by the countTO range of a request, or for its count the names of a retried request
+//topped up with the next free names l does not report. release frees names allocated for count once they are created.
+func (p *Provider) vmNames(ctx context.Context, l naming.Lister, req cloud.Request, payload AZrequest) (names []string, release func(), err error) {
+
+	if payload.CountTO == "" {
+		if len(req.Names) >= payload.Count {
+			return req.Names, func() {}, nil
+		}
+		names, release, err = p.Namer.Allocate(ctx, l, providerName, payload.Environment, payload.Osname, payload.AppCode, payload.Count-len(req.Names))
+		if err != nil {
+			return nil, nil, err
+		}
+		return append(append([]string{}, req.Names...), names...), release, nil
+	}
+	start, end, err := cloud.ParseCount(payload.CountTO)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+		return nil, nil, err
+	}
+	names = make([]string, 0, (end-start)+1)
+	for i := start; i <= end; i++ {
+		name, err := p.Namer.Name(providerName, payload.Environment, payload.Osname, payload.AppCode, i)
+		if err != nil {
+			return nil, nil, err
+		}
+		names = append(names, name)
 	}
-	resp := AZresponse{*vm.Name, *vm.VirtualMachineProperties.ProvisioningState, vm}
-	data, err := json.MarshalIndent(resp, "", " ")
+	return names, func() {}, nil
+}
+
+//Describe returns the VM named in req.
+func (p *Provider) Describe(ctx context.Context, req cloud.Request) ([]cloud.Instance, error) {
+
+	vm, err := GetVM(ctx, p.Subscription, NewAZrequest(req))
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+		return nil, err
 	}
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	w.Write(data)
+	return []cloud.Instance{{
+		Provider:     providerName,
+		InstanceName: *vm.Name,
+		ID:           *vm.ID,
+		Status:       *vm.VirtualMachineProperties.ProvisioningState,
+		Zone:         *vm.Location,
+		Environment:  to.String(vm.Tags["env"]),
+	}}, nil
 }
 
-//Post does a POST method on azure
-func Post(w http.ResponseWriter, r *http.Request, subscription, username, passwd string, payload AZrequest) {
+//Plan resolves the VM names, image, vnet, subnet and disks for req.
+func (p *Provider) Plan(ctx context.Context, req cloud.Request) (cloud.Plan, error) {
 
-	now := time.Now()
-	avch, sbch, nich, cmch := make(chan string), make(chan string), make(chan string), make(chan string)
-	rdr := io.TeeReader(r.Body, os.Stdout)
-	json.NewDecoder(rdr).Decode(&payload)
-	AVsetname := fmt.Sprintf("%s-%s-avs-001", provider, payload.Environment)
-	//imch := make(chan []compute.VirtualMachineImageResource)
+	payload := p.newRequest(req)
+	if err := p.checkResourceGroup(payload.RG); err != nil {
+		return cloud.Plan{}, err
+	}
+	net, err := p.Settings.Current().Network(providerName, payload.Environment, payload.Tier)
+	if err != nil {
+		return cloud.Plan{}, err
+	}
 	image, err := GetImagePubOfferSku(payload.Osname, payload.OsFlavor)
 	if err != nil {
-		log.Println(err)
+		return cloud.Plan{}, err
+	}
+	imageName, version, err := GetImageVersion(ctx, image, payload.Osname, net.Region, p.Subscription)
+	if err != nil {
+		return cloud.Plan{}, err
+	}
+	names, release, err := p.vmNames(ctx, p, req, payload)
+	if err != nil {
+		return cloud.Plan{}, err
+	}
+	defer release()
+	if err := naming.Check(ctx, p, names...); err != nil {
+		return cloud.Plan{}, err
+	}
+	plan := cloud.Plan{
+		Provider:     providerName,
+		Names:        names,
+		Image:        fmt.Sprintf("%s:%s:%s:%s", image.Publisher, image.Offer, imageName, version),
+		Network:      net.Network,
+		Subnet:       net.Subnet,
+		InstanceType: payload.InstanceType,
+		Disks:        make([]string, 0),
+		Zones:        []string{net.Region},
+	}
+	for _, vmName := range names {
+		disks, err := GetDisks(&payload.Disks, vmName)
+		if err != nil {
+			return cloud.Plan{}, err
+		}
+		for _, disk := range disks {
+			plan.Disks = append(plan.Disks, fmt.Sprintf("%s %dGB", *disk.Name, *disk.DiskSizeGB))
+		}
+	}
+	return plan, nil
+}
+
+//Provision deploys the VMs described by req, every VM is reported as succeeded or failed with the cause.
+func (p *Provider) Provision(ctx context.Context, req cloud.Request) ([]cloud.Instance, error) {
+
+	subscription, username := p.Subscription, p.Username
+	payload := p.newRequest(req)
+	if err := p.checkResourceGroup(payload.RG); err != nil {
+		return nil, err
 	}
-	go CreateAVS(r.Context(), AVsetname, payload.RG, avSku, azRegion, subscription, avch)
-	imageName, version, _ := GetImageVersion(r.Context(), image, payload.Osname, azRegion, subscription)
-	vmname := GetVMname(payload.Environment, payload.Osname, payload.AppCode)
-	subnetName, err := GetSubnetName(payload.Tier, payload.Environment)
+	names, release, err := p.vmNames(ctx, p, req, payload)
 	if err != nil {
-		log.Println(err)
+		return nil, err
 	}
-	vNetname, err := GetNetwork(payload.Environment)
+	defer release()
+	names, existing, err := naming.Available(ctx, p, req.Resume, names...)
 	if err != nil {
-		log.Println(err)
-	}
-	go GetSubnet(r.Context(), rgNetwork, subnetName, vNetname, subscription, sbch)
-	subnet := <-sbch
-	avsnm := <-avch
-	count := strings.Split(payload.CountTO, "-")
-	var wg sync.WaitGroup
-	var mx sync.Mutex
-	start, err := strconv.Atoi(count[0])
+		return nil, err
+	}
+	net, err := p.Settings.Current().Network(providerName, payload.Environment, payload.Tier)
 	if err != nil {
-		log.Fatalln(err)
+		return nil, err
 	}
-	end, err := strconv.Atoi(count[1])
-	vmch := make(chan string, (end-start)+1)
+	azRegion := net.Region
+	image, err := GetImagePubOfferSku(payload.Osname, payload.OsFlavor)
 	if err != nil {
-		log.Fatalln(err)
-	}
-	resp := make([]AZresponse, 0)
-	go func(vmch, ch chan string) {
-		for i := start; i <= end; i++ {
-			wg.Add(1)
-			vmName := fmt.Sprintf("%s%02d", vmname, i)
-			nicname := fmt.Sprintf("%s-nic-01", vmName)
-			disks := GetDisks(&payload.Disks, vmName)
-			go func(vmname, nic string, disks *[]compute.DataDisk) {
-				mx.Lock()
-				go CreateNIC(r.Context(), payload.RG, nic, subscription, azRegion, subnet, nich)
-				go CreateVM(r.Context(), payload.RG, vmname, username, passwd, <-nich, avsnm, azRegion, image.Publisher,
-					image.Offer, imageName, version, subscription, &payload.ChangeNum, disks, vmch)
-				mx.Unlock()
-				resp = append(resp, AZresponse{<-vmch, "Deployed", compute.VirtualMachine{}})
-				wg.Done()
-			}(vmName, nicname, &disks)
-		}
-		wg.Wait()
-		close(vmch)
-		ch <- "Success"
-	}(vmch, cmch)
-	for {
-		select {
-		case complete := <-cmch:
-			fmt.Printf("deployment completed 🎉🎉🎉, %s\n", complete)
-			data, err := json.MarshalIndent(resp, "", "  ")
+		return nil, err
+	}
+	imageName, version, err := GetImageVersion(ctx, image, payload.Osname, azRegion, subscription)
+	if err != nil {
+		return nil, err
+	}
+	timeout, err := payload.Request().Timeout()
+	if err != nil {
+		return nil, err
+	}
+	var (
+		avsID, subnet   string
+		avsErr, snetErr error
+		wg              sync.WaitGroup
+	)
+	AVsetname := fmt.Sprintf("%s-%s-avs-001", provider, payload.Environment)
+	_, err = GetAVS(ctx, payload.RG, AVsetname, subscription)
+	avsExisted := err == nil
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		avsID, avsErr = CreateAVS(ctx, AVsetname, payload.RG, avSku, azRegion, subscription)
+	}()
+	go func() {
+		defer wg.Done()
+		subnet, snetErr = GetSubnet(ctx, net.ResourceGroup, net.Subnet, net.Network, subscription)
+	}()
+	wg.Wait()
+	if avsErr != nil {
+		return nil, avsErr
+	}
+	if !avsExisted {
+		cloud.Record(ctx, "", "availabilitySet", avsID, func(ctx context.Context) error {
+			return DeleteAVS(ctx, payload.RG, AVsetname, subscription)
+		})
+	}
+	if snetErr != nil {
+		return nil, snetErr
+	}
+	creds, err := p.credentials(ctx, req, names)
+	if err != nil {
+		return nil, err
+	}
+	tags := map[string]*string{
+		"Request#": to.StringPtr(payload.ChangeNum),
+		"change":   to.StringPtr(payload.ChangeNum),
+		"appcode":  to.StringPtr(payload.AppCode),
+		"env":      to.StringPtr(payload.Environment),
+		"os":       to.StringPtr(payload.Osname),
+	}
+	resp := make([]AZresponse, len(names))
+	for i, vmName := range names {
+		wg.Add(1)
+		go func(i int, vmName string) {
+			defer wg.Done()
+			result := AZresponse{Provider: providerName, InstanceName: vmName, Zone: azRegion, CredentialRef: creds[vmName].ref}
+			defer func() {
+				resp[i] = result
+				cloud.ReportProgress(ctx, result)
+			}()
+			disks, err := GetDisks(&payload.Disks, vmName)
+			if err != nil {
+				result.Status, result.Error = "Failed", err.Error()
+				return
+			}
+			nic, err := CreateNIC(ctx, payload.RG, fmt.Sprintf("%s-nic-01", vmName), subscription, azRegion, subnet)
+			if err != nil {
+				result.Status, result.Error = "Failed", err.Error()
+				return
+			}
+			cloud.Record(ctx, vmName, "nic", nic, func(ctx context.Context) error {
+				if err := DeleteNIC(ctx, nic, subscription); err != nil && !IsNotFound(err) {
+					return err
+				}
+				return nil
+			})
+			//a failed deployment can leave the VM and its disks behind, so it is recorded before it is created.
+			cloud.Record(ctx, vmName, "vm", vmName, func(ctx context.Context) error {
+				if _, err := DeleteVM(ctx, payload.RG, vmName, subscription, false); err != nil && !IsNotFound(err) {
+					return err
+				}
+				return nil
+			})
+			vm, err := CreateVM(ctx, VMParams{
+				Subscription:    subscription,
+				RG:              payload.RG,
+				Name:            vmName,
+				Size:            payload.InstanceType,
+				Region:          azRegion,
+				Username:        username,
+				Password:        creds[vmName].passwd,
+				SSHKey:          creds[vmName].sshKey,
+				NIC:             nic,
+				AvailabilitySet: avsID,
+				Publisher:       image.Publisher,
+				Offer:           image.Offer,
+				Sku:             imageName,
+				Version:         version,
+				CustomData:      payload.UserData,
+				Tags:            tags,
+				DataDisks:       &disks,
+			})
 			if err != nil {
-				w.WriteHeader(http.StatusInternalServerError)
-				w.Write([]byte("something went wrong, please try again later"))
+				result.Status, result.Error = "Failed", err.Error()
+				return
+			}
+			result.ID, result.Status = to.String(vm.ID), "Succeeded"
+			if vm.VirtualMachineProperties != nil {
+				result.Status = to.String(vm.ProvisioningState)
+			}
+			if !payload.Wait {
+				return
+			}
+			cloud.ReportProgress(ctx, result)
+			waitCtx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+			booted, err := WaitVMRunning(waitCtx, payload.RG, vmName, subscription)
+			if err != nil {
+				result.Error = fmt.Sprintf("VM did not reach running within %s: %v", timeout, err)
+				return
+			}
+			result.Status, result.LaunchTime = "Running", booted
+			if result.PrivateIPs, err = NICPrivateIPs(ctx, nic, subscription); err != nil {
+				result.Error = err.Error()
 				return
 			}
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusCreated)
-			w.Write(data)
-			done := time.Since(now)
-			fmt.Printf("Time took: %.2f minutes", done.Minutes())
-			return
-		default:
-			log.Println("Deploying VM...")
-			time.Sleep(time.Millisecond * 1000)
+			if len(result.PrivateIPs) > 0 {
+				result.NetworkInterfaces = result.PrivateIPs[0]
+			}
+		}(i, vmName)
+	}
+	wg.Wait()
+	for _, name := range existing {
+		result := cloud.Instance{Provider: providerName, InstanceName: name, Status: "Exists"}
+		resp = append(resp, result)
+		cloud.ReportProgress(ctx, result)
+	}
+	failed := 0
+	for _, result := range resp {
+		if result.Error != "" {
+			failed++
 		}
 	}
+	if failed > 0 {
+		return resp, fmt.Errorf("%d of %d VMs failed to deploy", failed, len(resp))
+	}
+	return resp, nil
+}
+
+//Delete deletes the VM named in req with its NIC and disks.
+func (p *Provider) Delete(ctx context.Context, req cloud.Request) ([]cloud.Instance, error) {
+
+	payload := NewAZrequest(req)
+	id, err := DeleteVM(ctx, payload.RG, payload.VMname, p.Subscription, req.KeepDisks)
+	if err != nil {
+		return nil, err
+	}
+	return []cloud.Instance{{
+		Provider:     providerName,
+		InstanceName: payload.VMname,
+		ID:           id,
+		Status:       "Deleted",
+	}}, nil
+}
+
+//List returns the VMs of the configured resource groups whose appcode, env and change tags match filter.
+func (p *Provider) List(ctx context.Context, filter cloud.Filter) ([]cloud.Instance, error) {
+
+	instances := make([]cloud.Instance, 0)
+	for _, rg := range p.resourceGroups() {
+		vms, err := ListVMs(ctx, p.Subscription, rg, map[string]string{"appcode": filter.AppCode, "env": filter.Environment, "change": filter.ChangeNum})
+		if err != nil {
+			return nil, err
+		}
+		if len(vms) == 0 {
+			continue
+		}
+		ips, err := ListNICPrivateIPs(ctx, p.Subscription, rg)
+		if err != nil {
+			return nil, err
+		}
+		for _, vm := range vms {
+			inst := cloud.Instance{
+				Provider:     providerName,
+				InstanceName: to.String(vm.Name),
+				ID:           to.String(vm.ID),
+				Zone:         to.String(vm.Location),
+				Environment:  to.String(vm.Tags["env"]),
+			}
+			if props := vm.VirtualMachineProperties; props != nil {
+				inst.Status = to.String(props.ProvisioningState)
+				if props.NetworkProfile != nil && props.NetworkProfile.NetworkInterfaces != nil {
+					for _, nic := range *props.NetworkProfile.NetworkInterfaces {
+						inst.PrivateIPs = append(inst.PrivateIPs, ips[strings.ToLower(to.String(nic.ID))]...)
+					}
+				}
+			}
+			if len(inst.PrivateIPs) > 0 {
+				inst.NetworkInterfaces = inst.PrivateIPs[0]
+			}
+			instances = append(instances, inst)
+		}
+	}
+	return instances, nil
+}
+
+//LandingZone creates the virtual network of req with a subnet per tier, each behind its own network security group.
+//Everything is named and tagged so the config it returns finds it, and recorded on the saga of ctx.
+func (p *Provider) LandingZone(ctx context.Context, req landingzone.Request) (landingzone.Zone, error) {
+
+	subscription := p.Subscription
+	defaults := p.Settings.Current().Provider(providerName)
+	region, rg := req.Region, req.ResourceGroup
+	if region == "" {
+		region = defaults.Region
+	}
+	if rg == "" {
+		rg = defaults.ResourceGroup
+	}
+	cidrs, err := landingzone.Carve(req.CIDR, len(landingzone.Tiers))
+	if err != nil {
+		return landingzone.Zone{}, err
+	}
+	env, vnetName := req.Environment, landingzone.Name(req.Environment, "", "vnet")
+	if _, err := GetVNet(ctx, rg, vnetName, subscription); err == nil {
+		return landingzone.Zone{}, fmt.Errorf("%w: virtual network %s", landingzone.ErrExists, vnetName)
+	} else if !IsNotFound(err) {
+		return landingzone.Zone{}, err
+	}
+	tierCIDR := make(map[string]string, len(landingzone.Tiers))
+	for i, tier := range landingzone.Tiers {
+		tierCIDR[tier] = cidrs[i]
+	}
+	zone := landingzone.Zone{Provider: providerName, Environment: env, Region: region, Network: vnetName, CIDR: req.CIDR}
+	subnets := make([]network.Subnet, 0, len(landingzone.Tiers))
+	for _, tier := range landingzone.Tiers {
+		s := landingzone.Subnet{Tier: tier, Name: landingzone.Name(env, tier, "subnet"), CIDR: tierCIDR[tier], SecurityGroup: landingzone.Name(env, tier, "nsg")}
+		rules := make([]network.SecurityRule, 0)
+		for j, rule := range landingzone.Rules(tier, req.CIDR) {
+			source := rule.CIDR
+			if rule.Tier != "" {
+				source = tierCIDR[rule.Tier]
+			}
+			ports := fmt.Sprintf("%d-%d", rule.FromPort, rule.ToPort)
+			if rule.FromPort == rule.ToPort {
+				ports = fmt.Sprint(rule.FromPort)
+			}
+			rules = append(rules, network.SecurityRule{
+				Name: to.StringPtr(fmt.Sprintf("allow-%d", j+1)),
+				SecurityRulePropertiesFormat: &network.SecurityRulePropertiesFormat{
+					Protocol:                 network.SecurityRuleProtocolTCP,
+					SourcePortRange:          to.StringPtr("*"),
+					DestinationPortRange:     to.StringPtr(ports),
+					SourceAddressPrefix:      to.StringPtr(source),
+					DestinationAddressPrefix: to.StringPtr(s.CIDR),
+					Access:                   network.SecurityRuleAccessAllow,
+					Direction:                network.SecurityRuleDirectionInbound,
+					Priority:                 to.Int32Ptr(int32(100 + j*10)),
+				},
+			})
+		}
+		tags := map[string]*string{"env": to.StringPtr(env), "tier": to.StringPtr(tier)}
+		if s.SecurityGroupID, err = CreateNSG(ctx, rg, s.SecurityGroup, region, subscription, rules, tags); err != nil {
+			return landingzone.Zone{}, err
+		}
+		nsg := s.SecurityGroup
+		cloud.Record(ctx, "", "networkSecurityGroup", s.SecurityGroupID, func(ctx context.Context) error { return DeleteNSG(ctx, rg, nsg, subscription) })
+		subnets = append(subnets, network.Subnet{
+			Name: to.StringPtr(s.Name),
+			SubnetPropertiesFormat: &network.SubnetPropertiesFormat{
+				AddressPrefix:        to.StringPtr(s.CIDR),
+				NetworkSecurityGroup: &network.SecurityGroup{ID: to.StringPtr(s.SecurityGroupID)},
+			},
+		})
+		zone.Subnets = append(zone.Subnets, s)
+	}
+	if zone.NetworkID, err = CreateVNet(ctx, rg, vnetName, region, req.CIDR, subscription, subnets, map[string]*string{"env": to.StringPtr(env)}); err != nil {
+		return landingzone.Zone{}, err
+	}
+	cloud.Record(ctx, "", "virtualNetwork", zone.NetworkID, func(ctx context.Context) error { return DeleteVNet(ctx, rg, vnetName, subscription) })
+	for i := range zone.Subnets {
+		zone.Subnets[i].ID = zone.NetworkID + "/subnets/" + zone.Subnets[i].Name
+	}
+	zone.Config = landingzone.Config(providerName, region, rg, vnetName, zone.Subnets)
+	return zone, nil
 }
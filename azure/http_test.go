@@ -0,0 +1,175 @@
+package azure
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/shakilbd009/go-cloud/cloud"
+	"github.com/shakilbd009/go-cloud/naming"
+	"github.com/shakilbd009/go-cloud/secrets"
+)
+
+func TestCredentialsAreRolledBack(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "secrets")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	store, err := secrets.NewFileStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &Provider{Secrets: store}
+	tests := []struct {
+		os      string
+		sshKey  string
+		secrets int
+	}{
+		{os: "windows", secrets: 2},
+		{os: "redhat", secrets: 2},
+		{os: "redhat", sshKey: "ssh-rsa AAAA registered", secrets: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.os+tt.sshKey, func(t *testing.T) {
+			saga := cloud.NewSaga()
+			ctx := cloud.WithSaga(context.Background(), saga)
+			req := cloud.Request{Osname: tt.os, RG: "dev-rg", SSHPublicKey: tt.sshKey}
+			creds, err := p.credentials(ctx, req, []string{"vm1", "vm2"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if steps := saga.Steps(); len(steps) != tt.secrets {
+				t.Fatalf("%d steps recorded, want %d", len(steps), tt.secrets)
+			}
+			//only the failed vm2 is rolled back, the secret of vm1 stays with it.
+			results := saga.Rollback(context.Background(), func(instance string) bool { return instance == "vm2" })
+			if tt.secrets == 0 {
+				return
+			}
+			if err := results["vm2"]; err != nil {
+				t.Errorf("rollback of vm2: %v", err)
+			}
+			if _, err := store.Get(context.Background(), creds["vm2"].ref); !errors.Is(err, secrets.ErrNotFound) {
+				t.Errorf("secret of vm2 error = %v, want ErrNotFound", err)
+			}
+			if _, err := store.Get(context.Background(), creds["vm1"].ref); err != nil {
+				t.Errorf("secret of vm1: %v", err)
+			}
+		})
+	}
+}
+
+//fakeLister reports the names it holds that start with the prefix.
+type fakeLister struct {
+	mu    sync.Mutex
+	calls int
+	names []string
+}
+
+func (l *fakeLister) NamesWithPrefix(ctx context.Context, prefix string) ([]string, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.calls++
+	found := make([]string, 0)
+	for _, name := range l.names {
+		if strings.HasPrefix(name, prefix) {
+			found = append(found, name)
+		}
+	}
+	return found, nil
+}
+
+func TestVMNames(t *testing.T) {
+
+	p := &Provider{Namer: naming.Default()}
+	prefix, err := p.Namer.Prefix(providerName, "base", "windows", "abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name      string
+		names     []string
+		payload   AZrequest
+		want      []string
+		wantCalls int
+	}{
+		{name: "count", payload: AZrequest{Count: 2}, want: []string{"08", "09"}, wantCalls: 1},
+		{name: "retried count", names: []string{prefix + "05"}, payload: AZrequest{Count: 3}, want: []string{"05", "08", "09"}, wantCalls: 1},
+		{name: "complete retry", names: []string{prefix + "05"}, payload: AZrequest{Count: 1}, want: []string{"05"}},
+		{name: "countTO", payload: AZrequest{CountTO: "1-2"}, want: []string{"01", "02"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := &fakeLister{names: []string{prefix + "07", prefix + "03", "other99"}}
+			tt.payload.Environment, tt.payload.Osname, tt.payload.AppCode = "base", "windows", "abc"
+			names, release, err := p.vmNames(context.Background(), l, cloud.Request{Names: tt.names}, tt.payload)
+			if err != nil {
+				t.Fatal(err)
+			}
+			release()
+			want := make([]string, 0, len(tt.want))
+			for _, seq := range tt.want {
+				want = append(want, prefix+seq)
+			}
+			if fmt.Sprint(names) != fmt.Sprint(want) {
+				t.Errorf("names = %v, want %v", names, want)
+			}
+			if l.calls != tt.wantCalls {
+				t.Errorf("%d listings, want %d", l.calls, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestVMNamesConcurrentRequests(t *testing.T) {
+
+	p := &Provider{Namer: naming.Default()}
+	prefix, err := p.Namer.Prefix(providerName, "base", "windows", "abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := &fakeLister{names: []string{prefix + "02"}}
+	const requests = 8
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		all      []string
+		releases []func()
+	)
+	for i := 0; i < requests; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			payload := AZrequest{Environment: "base", Osname: "windows", AppCode: "abc", Count: 2}
+			names, release, err := p.vmNames(context.Background(), l, cloud.Request{}, payload)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			all = append(all, names...)
+			releases = append(releases, release)
+		}()
+	}
+	wg.Wait()
+	for _, release := range releases {
+		release()
+	}
+	sort.Strings(all)
+	want := make([]string, 0, 2*requests)
+	for seq := 3; seq < 3+2*requests; seq++ {
+		want = append(want, fmt.Sprintf("%s%02d", prefix, seq))
+	}
+	if fmt.Sprint(all) != fmt.Sprint(want) {
+		t.Errorf("concurrent requests got %v, want disjoint names %v", all, want)
+	}
+}
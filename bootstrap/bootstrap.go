@@ -0,0 +1,169 @@
+package bootstrap
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/template"
+
+	"github.com/shakilbd009/go-cloud/cloud"
+)
+
+//Kind of a bootstrap script.
+type Kind string
+
+//Script kinds.
+const (
+	CloudConfig Kind = "cloud-config"
+	Shell       Kind = "shell"
+	PowerShell  Kind = "powershell"
+)
+
+//MaxSize is the largest script in bytes, before encoding, each provider accepts.
+var MaxSize = map[string]int{
+	"aws":   16 * 1024,
+	"azure": 64*1024 - 1,
+	"gcp":   256 * 1024,
+}
+
+//ErrUnknownTemplate is returned by Render for a template the library does not have.
+var ErrUnknownTemplate = errors.New("unknown template")
+
+var templateName = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+//Detect returns the kind of script, windows instances run anything but cloud-config in PowerShell.
+func Detect(script, osname string) Kind {
+
+	switch {
+	case strings.HasPrefix(strings.TrimSpace(script), "#cloud-config"):
+		return CloudConfig
+	case strings.EqualFold(osname, "windows"):
+		return PowerShell
+	}
+	return Shell
+}
+
+//Check returns an error if script can't be passed to instances of osname on provider.
+func Check(provider, osname, script string) error {
+
+	if script == "" {
+		return nil
+	}
+	if max, ok := MaxSize[provider]; ok && len(script) > max {
+		return fmt.Errorf("script is %d bytes, %s accepts at most %d", len(script), provider, max)
+	}
+	if Detect(script, osname) == CloudConfig && strings.EqualFold(osname, "windows") {
+		return errors.New("cloud-config is not supported on windows")
+	}
+	return nil
+}
+
+//EC2 returns script encoded as EC2 UserData, wrapping PowerShell in the tags EC2Launch expects.
+func EC2(script, osname string) string {
+
+	if Detect(script, osname) == PowerShell {
+		trimmed := strings.TrimSpace(script)
+		if !strings.HasPrefix(trimmed, "<powershell>") && !strings.HasPrefix(trimmed, "<script>") {
+			script = "<powershell>\n" + script + "\n</powershell>"
+		}
+	}
+	return base64.StdEncoding.EncodeToString([]byte(script))
+}
+
+//MetadataKey returns the GCE metadata key script is run from: user-data for cloud-init, else the startup script of the os.
+func MetadataKey(script, osname string) string {
+
+	switch Detect(script, osname) {
+	case CloudConfig:
+		return "user-data"
+	case PowerShell:
+		return "windows-startup-script-ps1"
+	}
+	return "startup-script"
+}
+
+//CustomData returns script encoded as Azure OSProfile CustomData.
+//Linux images run it with cloud-init, windows only saves it to C:\AzureData\CustomData.bin.
+func CustomData(script string) string {
+	return base64.StdEncoding.EncodeToString([]byte(script))
+}
+
+//Vars returns the variables a template is rendered with: the vars of req plus its appCode, env, tier, os, flavor, requestNum and provider.
+func Vars(req cloud.Request) map[string]string {
+
+	vars := make(map[string]string, len(req.TemplateVars)+7)
+	for k, v := range req.TemplateVars {
+		vars[k] = v
+	}
+	for k, v := range map[string]string{
+		"appCode":    req.AppCode,
+		"env":        req.Environment,
+		"tier":       req.Tier,
+		"os":         req.Osname,
+		"flavor":     req.OsFlavor,
+		"requestNum": req.ChangeNum,
+		"provider":   req.Provider,
+	} {
+		vars[k] = v
+	}
+	return vars
+}
+
+//Library object is a directory of templates, each file is a template named after it without its extension.
+type Library struct {
+	dir string
+}
+
+//Open returns the Library in dir.
+func Open(dir string) (*Library, error) {
+
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", dir)
+	}
+	return &Library{dir: dir}, nil
+}
+
+//Render executes the template name with vars, referenced as {{.name}}, a missing variable is an error.
+func (l *Library) Render(name string, vars map[string]string) (string, error) {
+
+	if !templateName.MatchString(name) {
+		return "", fmt.Errorf("%w %q", ErrUnknownTemplate, name)
+	}
+	matches, err := filepath.Glob(filepath.Join(l.dir, name+".*"))
+	if err != nil {
+		return "", err
+	}
+	if _, err := os.Stat(filepath.Join(l.dir, name)); err == nil {
+		matches = append(matches, filepath.Join(l.dir, name))
+	}
+	switch len(matches) {
+	case 0:
+		return "", fmt.Errorf("%w %q", ErrUnknownTemplate, name)
+	case 1:
+	default:
+		return "", fmt.Errorf("template %q is ambiguous: %s", name, strings.Join(matches, ", "))
+	}
+	data, err := ioutil.ReadFile(matches[0])
+	if err != nil {
+		return "", err
+	}
+	tmpl, err := template.New(name).Option("missingkey=error").Parse(string(data))
+	if err != nil {
+		return "", fmt.Errorf("could not parse template %q: %w", name, err)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, vars); err != nil {
+		return "", fmt.Errorf("could not render template %q: %w", name, err)
+	}
+	return buf.String(), nil
+}
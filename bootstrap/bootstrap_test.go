@@ -0,0 +1,134 @@
+package bootstrap
+
+import (
+	"encoding/base64"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRender(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "templates")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for name, body := range map[string]string{
+		"base.sh":     "#!/bin/sh\necho {{.appCode}} {{.env}} > /etc/app\n",
+		"plain":       "#cloud-config\nhostname: {{.host}}\n",
+		"broken.sh":   "#!/bin/sh\necho {{.appCode\n",
+		"twice.sh":    "#!/bin/sh\n",
+		"twice.ps1":   "Write-Host hi\n",
+		"static.yaml": "#cloud-config\npackages: [nginx]\n",
+	} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(body), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	lib, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name     string
+		template string
+		vars     map[string]string
+		want     string
+		wantErr  string
+		unknown  bool
+	}{
+		{name: "renders vars", template: "base", vars: map[string]string{"appCode": "abc", "env": "dev"}, want: "#!/bin/sh\necho abc dev > /etc/app\n"},
+		{name: "file without extension", template: "plain", vars: map[string]string{"host": "web01"}, want: "#cloud-config\nhostname: web01\n"},
+		{name: "no vars needed", template: "static", want: "#cloud-config\npackages: [nginx]\n"},
+		{name: "missing key", template: "base", vars: map[string]string{"appCode": "abc"}, wantErr: "could not render"},
+		{name: "missing key with no vars", template: "plain", wantErr: "could not render"},
+		{name: "parse error", template: "broken", vars: map[string]string{"appCode": "abc"}, wantErr: "could not parse"},
+		{name: "ambiguous", template: "twice", wantErr: "ambiguous"},
+		{name: "unknown", template: "missing", unknown: true},
+		{name: "path traversal", template: "../base", unknown: true},
+		{name: "glob characters", template: "b*", unknown: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := lib.Render(tt.template, tt.vars)
+			if tt.unknown {
+				if !errors.Is(err, ErrUnknownTemplate) {
+					t.Fatalf("Render() error = %v, want %v", err, ErrUnknownTemplate)
+				}
+				return
+			}
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Render() error = %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("Render() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheck(t *testing.T) {
+
+	tests := []struct {
+		name, provider, os, script string
+		wantErr                    bool
+	}{
+		{name: "empty", provider: "aws", os: "redhat"},
+		{name: "shell on linux", provider: "aws", os: "redhat", script: "#!/bin/sh\n"},
+		{name: "at the aws limit", provider: "aws", os: "redhat", script: strings.Repeat("a", 16*1024)},
+		{name: "over the aws limit", provider: "aws", os: "redhat", script: strings.Repeat("a", 16*1024+1), wantErr: true},
+		{name: "fits gcp", provider: "gcp", os: "redhat", script: strings.Repeat("a", 16*1024+1)},
+		{name: "cloud-config on windows", provider: "azure", os: "windows", script: "#cloud-config\n", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := Check(tt.provider, tt.os, tt.script); (err != nil) != tt.wantErr {
+				t.Errorf("Check() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestEncoding(t *testing.T) {
+
+	tests := []struct {
+		name, script, os string
+		wantKind         Kind
+		wantKey          string
+		wantEC2          string
+	}{
+		{name: "cloud-config", script: "  #cloud-config\n", os: "ubuntu", wantKind: CloudConfig, wantKey: "user-data", wantEC2: "  #cloud-config\n"},
+		{name: "shell", script: "#!/bin/sh\n", os: "redhat", wantKind: Shell, wantKey: "startup-script", wantEC2: "#!/bin/sh\n"},
+		{name: "powershell is wrapped", script: "Write-Host hi", os: "Windows", wantKind: PowerShell, wantKey: "windows-startup-script-ps1",
+			wantEC2: "<powershell>\nWrite-Host hi\n</powershell>"},
+		{name: "wrapped powershell is kept", script: "<powershell>Write-Host hi</powershell>", os: "windows", wantKind: PowerShell,
+			wantKey: "windows-startup-script-ps1", wantEC2: "<powershell>Write-Host hi</powershell>"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Detect(tt.script, tt.os); got != tt.wantKind {
+				t.Errorf("Detect() = %s, want %s", got, tt.wantKind)
+			}
+			if got := MetadataKey(tt.script, tt.os); got != tt.wantKey {
+				t.Errorf("MetadataKey() = %s, want %s", got, tt.wantKey)
+			}
+			decoded, err := base64.StdEncoding.DecodeString(EC2(tt.script, tt.os))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(decoded) != tt.wantEC2 {
+				t.Errorf("EC2() = %q, want %q", decoded, tt.wantEC2)
+			}
+		})
+	}
+}
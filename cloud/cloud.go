@@ -0,0 +1,174 @@
+package cloud
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//ErrNotSupported is returned by a Provider for operations it does not implement yet.
+var ErrNotSupported = errors.New("operation not supported by this provider")
+
+//Request object shared by every provider.
+type Request struct {
+	Provider     string   `json:"provider,omitempty"`
+	Environment  string   `json:"env"`
+	Tier         string   `json:"tier"`
+	Osname       string   `json:"os"`
+	OsFlavor     string   `json:"flavor"`
+	Disks        string   `json:"disks"`
+	CountTO      string   `json:"countTO,omitempty"`
+	Count        int      `json:"count,omitempty"`
+	Min          int64    `json:"min,omitempty"`
+	Max          int64    `json:"max,omitempty"`
+	AppCode      string   `json:"appCode"`
+	ChangeNum    string   `json:"requestNum"`
+	InstanceType string   `json:"instanceType,omitempty"`
+	MachineType  string   `json:"machineType,omitempty"`
+	Desc         string   `json:"description,omitempty"`
+	Instance     string   `json:"instanceName,omitempty"`
+	VMname       string   `json:"vmName,omitempty"`
+	Zone         string   `json:"zone,omitempty"`
+	RG           string   `json:"resourceGroup,omitempty"`
+	InstanceIDs  []string `json:"instanceIds,omitempty"`
+	KeepDisks    bool     `json:"keepDisks,omitempty"`
+	Wait         bool     `json:"wait,omitempty"`
+	WaitTimeout  string   `json:"waitTimeout,omitempty"`
+	Rollback     string   `json:"rollback,omitempty"`
+	//UserData is a cloud-init, shell or PowerShell script run on first boot, Template names one from the template library instead.
+	UserData     string            `json:"userData,omitempty"`
+	Template     string            `json:"template,omitempty"`
+	TemplateVars map[string]string `json:"templateVars,omitempty"`
+	//SSHKey names a key of the key registry linux instances are given, password login is disabled.
+	SSHKey string `json:"sshKey,omitempty"`
+	//KeyName is an existing EC2 key pair instances are launched with.
+	KeyName string `json:"keyName,omitempty"`
+	//SSHPublicKey and SSHKeyRef are the public key and private key reference SSHKey resolves to.
+	SSHPublicKey string `json:"-"`
+	SSHKeyRef    string `json:"-"`
+	//Resume is set when a request is retried, instances it already created are kept instead of colliding.
+	Resume bool `json:"-"`
+	//Names are the instance names a retried request was given, they are used instead of allocating new ones.
+	Names []string `json:"-"`
+}
+
+//DefaultWaitTimeout is how long a provider waits for instances to run when a request sets no waitTimeout.
+const DefaultWaitTimeout = 10 * time.Minute
+
+//Timeout returns the WaitTimeout of r or DefaultWaitTimeout if it is empty.
+func (r Request) Timeout() (time.Duration, error) {
+
+	if r.WaitTimeout == "" {
+		return DefaultWaitTimeout, nil
+	}
+	timeout, err := time.ParseDuration(r.WaitTimeout)
+	if err != nil {
+		return 0, fmt.Errorf("invalid waitTimeout %q: %w", r.WaitTimeout, err)
+	}
+	if timeout <= 0 {
+		return 0, fmt.Errorf("waitTimeout must be positive, got %s", r.WaitTimeout)
+	}
+	return timeout, nil
+}
+
+//Instance object shared by every provider.
+type Instance struct {
+	Provider          string   `json:"provider,omitempty"`
+	InstanceName      string   `json:"InstanceName,omitempty"`
+	ID                string   `json:"id,omitempty"`
+	Status            string   `json:"status,omitempty"`
+	NetworkInterfaces string   `json:"networkInterfaces,omitempty"`
+	Zone              string   `json:"zone,omitempty"`
+	Environment       string   `json:"env,omitempty"`
+	CredentialRef     string   `json:"credentialRef,omitempty"`
+	PrivateIPs        []string `json:"privateIps,omitempty"`
+	LaunchTime        string   `json:"launchTime,omitempty"`
+	Image             string   `json:"image,omitempty"`
+	Volumes           []string `json:"volumes,omitempty"`
+	Error             string   `json:"error,omitempty"`
+}
+
+//Plan object describes what a request would build without building it.
+type Plan struct {
+	Provider      string   `json:"provider"`
+	Names         []string `json:"names"`
+	Image         string   `json:"image"`
+	Network       string   `json:"network"`
+	Subnet        string   `json:"subnet"`
+	SecurityGroup string   `json:"securityGroup,omitempty"`
+	InstanceType  string   `json:"instanceType,omitempty"`
+	Disks         []string `json:"disks"`
+	Zones         []string `json:"zones"`
+	DryRunPassed  bool     `json:"dryRunPassed,omitempty"`
+}
+
+//Filter narrows down a List call.
+type Filter struct {
+	Environment string `json:"env,omitempty"`
+	AppCode     string `json:"appCode,omitempty"`
+	ChangeNum   string `json:"requestNum,omitempty"`
+}
+
+//Provider is implemented by the aws, gcp and azure packages.
+type Provider interface {
+	//Name returns the provider name, i.e aws, gcp or azure.
+	Name() string
+	//Provision builds the instances described by req.
+	Provision(ctx context.Context, req Request) ([]Instance, error)
+	//Plan resolves what Provision would build for req without creating anything.
+	Plan(ctx context.Context, req Request) (Plan, error)
+	//Describe returns the instances identified by req.
+	Describe(ctx context.Context, req Request) ([]Instance, error)
+	//Delete decommissions the instances identified by req.
+	Delete(ctx context.Context, req Request) ([]Instance, error)
+	//List returns the instances matching filter.
+	List(ctx context.Context, filter Filter) ([]Instance, error)
+}
+
+//ParseCount parses a countTO range such as "1-3".
+func ParseCount(countTO string) (start, end int, err error) {
+
+	count := strings.Split(countTO, "-")
+	if len(count) != 2 {
+		return 0, 0, fmt.Errorf("countTO %q must be a range such as 1-3", countTO)
+	}
+	start, err = strconv.Atoi(strings.TrimSpace(count[0]))
+	if err != nil {
+		return 0, 0, err
+	}
+	end, err = strconv.Atoi(strings.TrimSpace(count[1]))
+	if err != nil {
+		return 0, 0, err
+	}
+	if start > end {
+		return 0, 0, fmt.Errorf("countTO %q must start before it ends", countTO)
+	}
+	return start, end, nil
+}
+
+type errResponse struct {
+	Error string `json:"error"`
+}
+
+//WriteJSON writes v as an indented JSON body with the given status code.
+func WriteJSON(w http.ResponseWriter, status int, v interface{}) {
+
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(data)
+}
+
+//WriteError writes err as a JSON body with the given status code.
+func WriteError(w http.ResponseWriter, status int, err error) {
+	WriteJSON(w, status, errResponse{Error: err.Error()})
+}
@@ -0,0 +1,63 @@
+package cloud
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCount(t *testing.T) {
+
+	tests := []struct {
+		countTO    string
+		start, end int
+		wantErr    bool
+	}{
+		{countTO: "1-3", start: 1, end: 3},
+		{countTO: " 2 - 5 ", start: 2, end: 5},
+		{countTO: "4-4", start: 4, end: 4},
+		{countTO: "98-100", start: 98, end: 100},
+		{countTO: "3", wantErr: true},
+		{countTO: "", wantErr: true},
+		{countTO: "1-2-3", wantErr: true},
+		{countTO: "a-3", wantErr: true},
+		{countTO: "1-b", wantErr: true},
+		{countTO: "5-1", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.countTO, func(t *testing.T) {
+			start, end, err := ParseCount(tt.countTO)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseCount(%q) error = %v, wantErr %v", tt.countTO, err, tt.wantErr)
+			}
+			if start != tt.start || end != tt.end {
+				t.Errorf("ParseCount(%q) = %d, %d, want %d, %d", tt.countTO, start, end, tt.start, tt.end)
+			}
+		})
+	}
+}
+
+func TestTimeout(t *testing.T) {
+
+	tests := []struct {
+		waitTimeout string
+		want        time.Duration
+		wantErr     bool
+	}{
+		{waitTimeout: "", want: DefaultWaitTimeout},
+		{waitTimeout: "90s", want: 90 * time.Second},
+		{waitTimeout: "0s", wantErr: true},
+		{waitTimeout: "-1m", wantErr: true},
+		{waitTimeout: "soon", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.waitTimeout, func(t *testing.T) {
+			got, err := Request{WaitTimeout: tt.waitTimeout}.Timeout()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Timeout() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Timeout() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
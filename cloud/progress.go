@@ -0,0 +1,28 @@
+package cloud
+
+import "context"
+
+type progressKey struct{}
+
+//ProgressFunc receives per-instance updates while a request is being processed.
+type ProgressFunc func(Instance)
+
+//WithProgress returns a copy of ctx that delivers instance updates to fn,
+//followed by any ProgressFunc already attached to ctx.
+func WithProgress(ctx context.Context, fn ProgressFunc) context.Context {
+	if parent, ok := ctx.Value(progressKey{}).(ProgressFunc); ok && parent != nil {
+		next := fn
+		fn = func(inst Instance) {
+			next(inst)
+			parent(inst)
+		}
+	}
+	return context.WithValue(ctx, progressKey{}, fn)
+}
+
+//ReportProgress sends inst to the ProgressFunc attached to ctx, if any.
+func ReportProgress(ctx context.Context, inst Instance) {
+	if fn, ok := ctx.Value(progressKey{}).(ProgressFunc); ok && fn != nil {
+		fn(inst)
+	}
+}
@@ -0,0 +1,85 @@
+package cloud
+
+import (
+	"context"
+	"sync"
+)
+
+//Rollback policies of a Request.
+const (
+	//RollbackAll deletes everything a failed request created.
+	RollbackAll = "all"
+	//RollbackKeepSuccessful deletes what the failed instances of a request left behind and keeps the ones that succeeded.
+	RollbackKeepSuccessful = "keep-successful"
+	//RollbackNone leaves everything in place.
+	RollbackNone = "none"
+)
+
+type sagaKey struct{}
+
+//Step object is a created resource and how to delete it.
+type Step struct {
+	Instance string
+	Kind     string
+	ID       string
+	undo     func(context.Context) error
+}
+
+//Saga records the resources a request creates, in order, so they can be deleted in reverse when it fails.
+type Saga struct {
+	mu    sync.Mutex
+	steps []Step
+}
+
+//NewSaga returns an empty Saga.
+func NewSaga() *Saga {
+	return &Saga{steps: make([]Step, 0)}
+}
+
+//WithSaga returns a copy of ctx that records created resources in s.
+func WithSaga(ctx context.Context, s *Saga) context.Context {
+	return context.WithValue(ctx, sagaKey{}, s)
+}
+
+//Record adds a created resource to the Saga attached to ctx, if any.
+//instance is the instance the resource belongs to, or empty for resources shared by the whole request.
+func Record(ctx context.Context, instance, kind, id string, undo func(context.Context) error) {
+	if s, ok := ctx.Value(sagaKey{}).(*Saga); ok && s != nil {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.steps = append(s.steps, Step{Instance: instance, Kind: kind, ID: id, undo: undo})
+	}
+}
+
+//Steps returns the resources recorded so far.
+func (s *Saga) Steps() []Step {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Step{}, s.steps...)
+}
+
+//Rollback deletes in reverse order the resources whose instance is selected by fn.
+//It returns an error per instance, nil for the ones fully rolled back. Undone steps are forgotten.
+func (s *Saga) Rollback(ctx context.Context, fn func(instance string) bool) map[string]error {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	results := make(map[string]error)
+	kept := make([]Step, 0)
+	for i := len(s.steps) - 1; i >= 0; i-- {
+		step := s.steps[i]
+		if !fn(step.Instance) {
+			kept = append([]Step{step}, kept...)
+			continue
+		}
+		err := step.undo(ctx)
+		if _, ok := results[step.Instance]; !ok || err != nil {
+			results[step.Instance] = err
+		}
+		if err != nil {
+			kept = append([]Step{step}, kept...)
+		}
+	}
+	s.steps = kept
+	return results
+}
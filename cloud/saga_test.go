@@ -0,0 +1,76 @@
+package cloud
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestSagaRollback(t *testing.T) {
+
+	tests := []struct {
+		name      string
+		selected  map[string]bool
+		failing   string
+		wantUndo  []string
+		wantLeft  []string
+		wantFails []string
+	}{
+		{name: "everything in reverse order", selected: map[string]bool{"": true, "a": true, "b": true},
+			wantUndo: []string{"b-disk", "b-vm", "a-vm", "net"}},
+		{name: "only selected instances", selected: map[string]bool{"b": true},
+			wantUndo: []string{"b-disk", "b-vm"}, wantLeft: []string{"net", "a-vm"}},
+		{name: "nothing selected", selected: map[string]bool{}, wantLeft: []string{"net", "a-vm", "b-vm", "b-disk"}},
+		{name: "failed steps are kept", selected: map[string]bool{"": true, "a": true, "b": true}, failing: "b-vm",
+			wantUndo: []string{"b-disk", "a-vm", "net"}, wantLeft: []string{"b-vm"}, wantFails: []string{"b"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			undone := make([]string, 0)
+			undo := func(id string) func(context.Context) error {
+				return func(context.Context) error {
+					if id == tt.failing {
+						return errors.New("boom")
+					}
+					undone = append(undone, id)
+					return nil
+				}
+			}
+			s := NewSaga()
+			ctx := WithSaga(context.Background(), s)
+			Record(ctx, "", "network", "net", undo("net"))
+			Record(ctx, "a", "instance", "a-vm", undo("a-vm"))
+			Record(ctx, "b", "instance", "b-vm", undo("b-vm"))
+			Record(ctx, "b", "disk", "b-disk", undo("b-disk"))
+
+			results := s.Rollback(context.Background(), func(instance string) bool { return tt.selected[instance] })
+			if !reflect.DeepEqual(undone, append([]string{}, tt.wantUndo...)) {
+				t.Errorf("undone = %v, want %v", undone, tt.wantUndo)
+			}
+			left := make([]string, 0)
+			for _, step := range s.Steps() {
+				left = append(left, step.ID)
+			}
+			if !reflect.DeepEqual(left, append([]string{}, tt.wantLeft...)) {
+				t.Errorf("Steps() = %v, want %v", left, tt.wantLeft)
+			}
+			fails := make([]string, 0)
+			for instance, err := range results {
+				if !tt.selected[instance] {
+					t.Errorf("result for unselected instance %q", instance)
+				}
+				if err != nil {
+					fails = append(fails, instance)
+				}
+			}
+			if !reflect.DeepEqual(fails, append([]string{}, tt.wantFails...)) {
+				t.Errorf("failed instances = %v, want %v", fails, tt.wantFails)
+			}
+		})
+	}
+}
+
+func TestRecordWithoutSaga(t *testing.T) {
+	Record(context.Background(), "a", "instance", "a-vm", func(context.Context) error { return nil })
+}
@@ -0,0 +1,314 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+//Network object is what a provider needs to place an instance for an environment and tier.
+type Network struct {
+	Region        string `json:"region,omitempty"`
+	Network       string `json:"network"`
+	Subnet        string `json:"subnet"`
+	SecurityGroup string `json:"securityGroup,omitempty"`
+	ResourceGroup string `json:"resourceGroup,omitempty"`
+	//NetworkTag, SubnetTag and SecurityGroupTag are the tag keys the network, subnet and security group are discovered by, where a provider supports it.
+	//Security groups are matched by group name when SecurityGroupTag is empty, since every group has one but not every group is tagged.
+	NetworkTag       string `json:"networkTag,omitempty"`
+	SubnetTag        string `json:"subnetTag,omitempty"`
+	SecurityGroupTag string `json:"securityGroupTag,omitempty"`
+}
+
+//ProviderDefaults object holds the settings used when an environment does not override them.
+type ProviderDefaults struct {
+	Region        string `json:"region"`
+	Zone          string `json:"zone,omitempty"`
+	ResourceGroup string `json:"resourceGroup,omitempty"`
+	//ResourceGroups are the resource groups instances may be placed in and are listed from, anywhere in the subscription if empty.
+	ResourceGroups   []string `json:"resourceGroups,omitempty"`
+	InstanceType     string   `json:"instanceType,omitempty"`
+	NetworkTag       string   `json:"networkTag,omitempty"`
+	SubnetTag        string   `json:"subnetTag,omitempty"`
+	SecurityGroupTag string   `json:"securityGroupTag,omitempty"`
+	//Sizes maps an environment to the instance sizes allowed in it, "*" applies to environments not listed.
+	Sizes map[string][]string `json:"sizes,omitempty"`
+}
+
+//Tier maps a provider name to its Network.
+type Tier map[string]Network
+
+//Environment maps a tier name to its Tier.
+type Environment map[string]Tier
+
+//Config object maps every environment and tier to region, network, subnet and security group per provider.
+type Config struct {
+	Providers    map[string]ProviderDefaults `json:"providers"`
+	Environments map[string]Environment      `json:"environments"`
+}
+
+//Provider returns the defaults of the given provider.
+func (c *Config) Provider(provider string) ProviderDefaults {
+	return c.Providers[provider]
+}
+
+//Network returns the Network of provider for env and tier, filling in the provider defaults.
+func (c *Config) Network(provider, env, tier string) (Network, error) {
+
+	envname := strings.ToLower(strings.TrimSpace(env))
+	tiername := strings.ToLower(strings.TrimSpace(tier))
+	environment, ok := c.Environments[envname]
+	if !ok {
+		return Network{}, fmt.Errorf("environment %q is not configured, use one of %s", env, strings.Join(c.EnvNames(provider), ", "))
+	}
+	net, ok := environment[tiername][provider]
+	if !ok {
+		return Network{}, fmt.Errorf("tier %q is not configured for %s in environment %q", tier, provider, env)
+	}
+	defaults := c.Providers[provider]
+	if net.Region == "" {
+		net.Region = defaults.Region
+	}
+	if net.ResourceGroup == "" {
+		net.ResourceGroup = defaults.ResourceGroup
+	}
+	if net.NetworkTag == "" {
+		net.NetworkTag = defaults.NetworkTag
+	}
+	if net.SubnetTag == "" {
+		net.SubnetTag = defaults.SubnetTag
+	}
+	if net.SecurityGroupTag == "" {
+		net.SecurityGroupTag = defaults.SecurityGroupTag
+	}
+	return net, nil
+}
+
+//Sizes returns the instance sizes of provider allowed in env, an empty list allows any size.
+func (c *Config) Sizes(provider, env string) []string {
+
+	sizes := c.Providers[provider].Sizes
+	if list, ok := sizes[strings.ToLower(strings.TrimSpace(env))]; ok {
+		return list
+	}
+	return sizes["*"]
+}
+
+//Regions returns the regions provider places instances in, its default region first.
+func (c *Config) Regions(provider string) []string {
+
+	regions := make([]string, 0)
+	seen := make(map[string]bool)
+	add := func(region string) {
+		if region != "" && !seen[region] {
+			seen[region] = true
+			regions = append(regions, region)
+		}
+	}
+	add(c.Providers[provider].Region)
+	for _, env := range c.Environments {
+		for _, tier := range env {
+			if net, ok := tier[provider]; ok {
+				add(net.Region)
+			}
+		}
+	}
+	return regions
+}
+
+//EnvNames returns the environments configured for provider.
+func (c *Config) EnvNames(provider string) []string {
+
+	names := make([]string, 0)
+	for name, env := range c.Environments {
+		for _, tier := range env {
+			if _, ok := tier[provider]; ok {
+				names = append(names, name)
+				break
+			}
+		}
+	}
+	return names
+}
+
+//Default returns the settings the servers were built with before the config file existed.
+func Default() *Config {
+	return &Config{
+		Providers: map[string]ProviderDefaults{
+			"aws": {
+				Region:       "us-east-2",
+				InstanceType: "t2.micro",
+				NetworkTag:   "Name",
+				SubnetTag:    "Name",
+				Sizes: map[string][]string{
+					"*":    {"t2.micro", "t2.small", "t3.micro", "t3.small", "t3.medium"},
+					"prod": {"t3.medium", "t3.large", "m5.large", "m5.xlarge", "r5.large"},
+				},
+			},
+			"gcp": {
+				Region: "us-east1",
+				Zone:   "us-east1-c",
+				Sizes: map[string][]string{
+					"*":    {"f1-micro", "g1-small", "e2-small", "e2-medium", "n1-standard-1"},
+					"prod": {"e2-medium", "n1-standard-2", "n1-standard-4", "n2-standard-2", "n2-standard-4"},
+				},
+			},
+			"azure": {
+				Region:        "eastus",
+				ResourceGroup: "az-nonProd-rg-001",
+				InstanceType:  "Standard_B1s",
+				Sizes: map[string][]string{
+					"*":    {"Standard_B1s", "Standard_B1ms", "Standard_B2s", "Standard_B2ms"},
+					"prod": {"Standard_B2ms", "Standard_D2s_v3", "Standard_D4s_v3", "Standard_E2s_v3"},
+				},
+			},
+		},
+		Environments: map[string]Environment{
+			"base": {
+				"web": {
+					"aws":   {Network: "*base*", Subnet: "*web*", SecurityGroup: "*web*"},
+					"gcp":   {Network: "base", Subnet: "web"},
+					"azure": {Network: "az-base-vnet-001", Subnet: "az-base-sub-001"},
+				},
+				"app": {
+					"aws":   {Network: "*base*", Subnet: "*app*", SecurityGroup: "*app*"},
+					"gcp":   {Network: "base", Subnet: "app"},
+					"azure": {Network: "az-base-vnet-001", Subnet: "az-base-app-sub-002"},
+				},
+				"db": {
+					"aws": {Network: "*base*", Subnet: "*db*", SecurityGroup: "*db*"},
+					"gcp": {Network: "base", Subnet: "db"},
+				},
+			},
+			"prod": {
+				"web": {
+					"aws":   {Network: "*prod*", Subnet: "*web*", SecurityGroup: "*web*"},
+					"gcp":   {Network: "-p-vpc", Subnet: "web"},
+					"azure": {Network: "az-Prod-vnet-001", Subnet: "az-Prod-sub-001"},
+				},
+				"app": {
+					"aws":   {Network: "*prod*", Subnet: "*app*", SecurityGroup: "*app*"},
+					"gcp":   {Network: "-p-vpc", Subnet: "app"},
+					"azure": {Network: "az-Prod-vnet-001", Subnet: "az-Prod-app-sub-002"},
+				},
+				"db": {
+					"aws": {Network: "*prod*", Subnet: "*db*", SecurityGroup: "*db*"},
+					"gcp": {Network: "-p-vpc", Subnet: "db"},
+				},
+			},
+			"nonprod": {
+				"web": {
+					"aws":   {Network: "*nonProd*", Subnet: "*web*", SecurityGroup: "*web*"},
+					"azure": {Network: "az-nonProd-vnet-001", Subnet: "az-nonProd-sub-001"},
+				},
+				"app": {
+					"aws":   {Network: "*nonProd*", Subnet: "*app*", SecurityGroup: "*app*"},
+					"azure": {Network: "az-nonProd-vnet-001", Subnet: "az-nonProd-app-sub-002"},
+				},
+				"db": {
+					"aws": {Network: "*nonProd*", Subnet: "*db*", SecurityGroup: "*db*"},
+				},
+			},
+			"dev": {
+				"web": {"gcp": {Network: "dev", Subnet: "web"}},
+				"app": {"gcp": {Network: "dev", Subnet: "app"}},
+				"db":  {"gcp": {Network: "dev", Subnet: "db"}},
+			},
+		},
+	}
+}
+
+//Load reads the JSON config at path.
+func Load(path string) (*Config, error) {
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	cfg := &Config{}
+	if err := json.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("could not parse %s: %w", path, err)
+	}
+	if len(cfg.Environments) == 0 {
+		return nil, fmt.Errorf("%s has no environments", path)
+	}
+	return cfg, nil
+}
+
+//Source returns the config currently in effect.
+type Source interface {
+	Current() *Config
+}
+
+//Static is a Source that never changes.
+type Static struct {
+	Config *Config
+}
+
+//Current returns the static config.
+func (s Static) Current() *Config { return s.Config }
+
+//Watcher is a Source reloaded whenever its file changes.
+type Watcher struct {
+	path    string
+	mu      sync.RWMutex
+	cfg     *Config
+	modTime time.Time
+}
+
+//Watch loads the config at path and reloads it every interval when the file changes, never if interval is not positive.
+func Watch(path string, interval time.Duration) (*Watcher, error) {
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := Load(path)
+	if err != nil {
+		return nil, err
+	}
+	w := &Watcher{path: path, cfg: cfg, modTime: info.ModTime()}
+	if interval <= 0 {
+		log.Printf("config reload disabled, %s is only read at startup\n", path)
+		return w, nil
+	}
+	go w.poll(interval)
+	return w, nil
+}
+
+//Current returns the last successfully loaded config.
+func (w *Watcher) Current() *Config {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return w.cfg
+}
+
+func (w *Watcher) poll(interval time.Duration) {
+	for range time.Tick(interval) {
+		info, err := os.Stat(w.path)
+		if err != nil {
+			log.Printf("could not stat config %s: %v\n", w.path, err)
+			continue
+		}
+		if !info.ModTime().After(w.modTime) {
+			continue
+		}
+		cfg, err := Load(w.path)
+		if err != nil {
+			log.Printf("keeping previous config, reload failed: %v\n", err)
+			w.mu.Lock()
+			w.modTime = info.ModTime()
+			w.mu.Unlock()
+			continue
+		}
+		w.mu.Lock()
+		w.cfg, w.modTime = cfg, info.ModTime()
+		w.mu.Unlock()
+		log.Printf("reloaded config %s\n", w.path)
+	}
+}
@@ -0,0 +1,128 @@
+package config
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+var testConfig = &Config{
+	Providers: map[string]ProviderDefaults{
+		"aws": {Region: "us-east-2", NetworkTag: "Name", SubnetTag: "Name", SecurityGroupTag: "Tier",
+			Sizes: map[string][]string{"*": {"t3.micro"}, "prod": {"m5.large"}}},
+		"azure": {Region: "eastus", ResourceGroup: "shared-rg"},
+	},
+	Environments: map[string]Environment{
+		"dev": {
+			"web": {
+				"aws":   {Network: "*dev*", Subnet: "*web*", SecurityGroup: "*web*"},
+				"azure": {Network: "dev-vnet", Subnet: "web"},
+			},
+		},
+		"prod": {
+			"web": {
+				"aws":   {Region: "us-west-2", Network: "prod", Subnet: "web", NetworkTag: "vpc", SubnetTag: "subnet", SecurityGroupTag: "sg"},
+				"azure": {Region: "westus", Network: "prod-vnet", Subnet: "web", ResourceGroup: "prod-rg"},
+			},
+		},
+	},
+}
+
+func TestNetwork(t *testing.T) {
+
+	tests := []struct {
+		name                string
+		provider, env, tier string
+		want                Network
+		wantErr             bool
+	}{
+		{name: "aws fills in every default", provider: "aws", env: "dev", tier: "web",
+			want: Network{Region: "us-east-2", Network: "*dev*", Subnet: "*web*", SecurityGroup: "*web*", NetworkTag: "Name", SubnetTag: "Name", SecurityGroupTag: "Tier"}},
+		{name: "aws keeps what the environment sets", provider: "aws", env: "prod", tier: "web",
+			want: Network{Region: "us-west-2", Network: "prod", Subnet: "web", NetworkTag: "vpc", SubnetTag: "subnet", SecurityGroupTag: "sg"}},
+		{name: "azure default resource group", provider: "azure", env: "dev", tier: "web",
+			want: Network{Region: "eastus", Network: "dev-vnet", Subnet: "web", ResourceGroup: "shared-rg"}},
+		{name: "azure resource group of the environment", provider: "azure", env: "prod", tier: "web",
+			want: Network{Region: "westus", Network: "prod-vnet", Subnet: "web", ResourceGroup: "prod-rg"}},
+		{name: "env and tier are case insensitive", provider: "azure", env: " DEV ", tier: "Web",
+			want: Network{Region: "eastus", Network: "dev-vnet", Subnet: "web", ResourceGroup: "shared-rg"}},
+		{name: "unknown env", provider: "aws", env: "qa", tier: "web", wantErr: true},
+		{name: "unknown tier", provider: "aws", env: "dev", tier: "db", wantErr: true},
+		{name: "provider not in tier", provider: "gcp", env: "dev", tier: "web", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := testConfig.Network(tt.provider, tt.env, tt.tier)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Network() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Network() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSizes(t *testing.T) {
+
+	tests := []struct {
+		provider, env string
+		want          []string
+	}{
+		{provider: "aws", env: "prod", want: []string{"m5.large"}},
+		{provider: "aws", env: "Prod", want: []string{"m5.large"}},
+		{provider: "aws", env: "dev", want: []string{"t3.micro"}},
+		{provider: "azure", env: "dev"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.provider+"/"+tt.env, func(t *testing.T) {
+			if got := testConfig.Sizes(tt.provider, tt.env); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Sizes() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRegionsAndEnvNames(t *testing.T) {
+
+	tests := []struct {
+		provider    string
+		wantRegions []string
+		wantEnvs    []string
+	}{
+		{provider: "aws", wantRegions: []string{"us-east-2", "us-west-2"}, wantEnvs: []string{"dev", "prod"}},
+		{provider: "azure", wantRegions: []string{"eastus", "westus"}, wantEnvs: []string{"dev", "prod"}},
+		{provider: "gcp", wantRegions: []string{}, wantEnvs: []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.provider, func(t *testing.T) {
+			if got := testConfig.Regions(tt.provider); !reflect.DeepEqual(got, tt.wantRegions) {
+				t.Errorf("Regions() = %v, want %v", got, tt.wantRegions)
+			}
+			got := testConfig.EnvNames(tt.provider)
+			sort.Strings(got)
+			if !reflect.DeepEqual(got, tt.wantEnvs) {
+				t.Errorf("EnvNames() = %v, want %v", got, tt.wantEnvs)
+			}
+		})
+	}
+}
+
+func TestDefaultNetworks(t *testing.T) {
+
+	cfg := Default()
+	for name, env := range cfg.Environments {
+		for tier, providers := range env {
+			for provider := range providers {
+				net, err := cfg.Network(provider, name, tier)
+				if err != nil {
+					t.Errorf("Network(%s, %s, %s) error = %v", provider, name, tier, err)
+					continue
+				}
+				if net.Region == "" || net.Network == "" || net.Subnet == "" {
+					t.Errorf("Network(%s, %s, %s) = %+v, want a region, network and subnet", provider, name, tier, net)
+				}
+			}
+		}
+	}
+}
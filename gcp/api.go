@@ -4,10 +4,13 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
 	"google.golang.org/api/compute/v1"
+	"google.golang.org/api/googleapi"
 )
 
 //GetInstance returns a compute.Instance object and an error if any
@@ -23,39 +26,31 @@ func GetInstance(svc *compute.Service, projectID, zone, instanceName string) (*c
 }
 
 //GetZones return a slice of zone and an error if any.
-func GetZones(svc *compute.Service, projectID string) ([]*compute.Zone, error) {
+func GetZones(ctx context.Context, svc *compute.Service, projectID string) ([]*compute.Zone, error) {
 
 	zones := compute.NewZonesService(svc)
-	zonesCall := zones.List(projectID)
-	zonesList, err := zonesCall.Do()
+	items := make([]*compute.Zone, 0)
+	err := zones.List(projectID).Pages(ctx, func(page *compute.ZoneList) error {
+		items = append(items, page.Items...)
+		return nil
+	})
 	if err != nil {
 		return nil, err
 	}
-	return zonesList.Items, nil
+	return items, nil
 }
 
-//GetZonesString a slice of zones and an error if any.
-func GetZonesString(svc *compute.Service, projectID, region string) ([]string, error) {
+//GetZonesString a slice of zones in the region and an error if any.
+func GetZonesString(ctx context.Context, svc *compute.Service, projectID, region string) ([]string, error) {
 
-	zones, err := GetZones(svc, projectID)
+	zones, err := GetZones(ctx, svc, projectID)
 	if err != nil {
 		return nil, err
 	}
 	Zones := make([]string, 0)
 	for _, v := range zones {
-		switch region {
-		case "us-east1":
-			if strings.Contains(v.Name, region) {
-				Zones = append(Zones, v.Name)
-			}
-		case "us-west1":
-			if strings.Contains(v.Name, region) {
-				Zones = append(Zones, v.Name)
-			}
-		case "us-central1":
-			if strings.Contains(v.Name, region) {
-				Zones = append(Zones, v.Name)
-			}
+		if strings.HasPrefix(v.Name, region+"-") {
+			Zones = append(Zones, v.Name)
 		}
 	}
 	return Zones, nil
@@ -66,20 +61,20 @@ func GetSession(ctx context.Context) (session *compute.Service, err error) {
 	return compute.NewService(ctx)
 }
 
-//GetSubnetName return a subnet name and an error.
-func GetSubnetName(svc *compute.Service, projectID, vpc, tier string) (string, error) {
+//GetSubnetName return the name of the vpc subnet containing subnet and an error.
+func GetSubnetName(svc *compute.Service, projectID, vpc, subnet string) (string, error) {
 
-	subnets, err := GetSubnetsName(svc, projectID, vpc)
+	_, subnets, err := GetVPC(svc, projectID, vpc)
 	if err != nil {
 		return "", err
 	}
-	for _, subnet := range subnets {
-		switch {
-		case strings.Contains(subnet, tier):
-			return subnet, nil
+	for _, link := range subnets {
+		fields := strings.Split(link, "/")
+		if name := fields[len(fields)-1]; strings.Contains(name, subnet) {
+			return name, nil
 		}
 	}
-	err = errors.New("No subnet found for the specific tier")
+	err = fmt.Errorf("No subnet found with name %s in %s", subnet, vpc)
 	return "", err
 }
 
@@ -189,42 +184,45 @@ func GetImage(svc *compute.Service, os, version string) (string, error) {
 	return resp.SelfLink, nil
 }
 
-//GetInstanceName returns instance name following naming standard and error if any.
-func GetInstanceName(provider, envname, os, app string) (string, error) {
-
-	env := strings.ToLower(envname)
-	os = strings.ToLower(os)
-	b := "b"
-	d := "d"
-	p := "p"
-	w := "w"
-	x := "x"
-	s := "s"
-	switch {
-	case env == "base":
-		if os == "windows" {
-			return fmt.Sprintf("%s%s%se%s%s", provider, b, w, d, app), nil
-		}
-		if os == "redhat" || os == "centos" || os == "suse" || os == "debian" || os == "ubuntu" {
-			return fmt.Sprintf("%s%s%sw%s%s", provider, b, x, d, app), nil
-		}
-	case env == "prod":
-		if os == "windows" {
-			return fmt.Sprintf("%s%s%se%s%s", provider, p, w, p, app), nil
-		}
-		if os == "redhat" || os == "centos" || os == "suse" || os == "debian" || os == "ubuntu" {
-			return fmt.Sprintf("%s%s%se%s%s", provider, p, x, p, app), nil
-		}
-	case env == "dev":
-		if os == "windows" {
-			return fmt.Sprintf("%s%s%se%s%s", provider, s, w, d, app), nil
-		}
-		if os == "redhat" || os == "centos" || os == "suse" || os == "debian" || os == "ubuntu" {
-			return fmt.Sprintf("%s%s%se%s%s", provider, s, x, d, app), nil
+//InstanceExists reports whether an instance with the given name exists in any zone.
+func InstanceExists(ctx context.Context, svc *compute.Service, projectID, name string) (bool, error) {
+
+	instanceService := compute.NewInstancesService(svc)
+	call := instanceService.AggregatedList(projectID).Filter(fmt.Sprintf("name = %s", name))
+	exists := false
+	err := call.Pages(ctx, func(list *compute.InstanceAggregatedList) error {
+		for _, scoped := range list.Items {
+			if len(scoped.Instances) > 0 {
+				exists = true
+			}
 		}
+		return nil
+	})
+	if err != nil {
+		return false, err
 	}
+	return exists, nil
+}
 
-	return "", errors.New("Instance name could not be generated with given OS details")
+//ListInstances returns the instances of every zone matching the AggregatedList filter expression and error if any.
+func ListInstances(ctx context.Context, svc *compute.Service, projectID, filter string) ([]*compute.Instance, error) {
+
+	instanceService := compute.NewInstancesService(svc)
+	call := instanceService.AggregatedList(projectID)
+	if filter != "" {
+		call = call.Filter(filter)
+	}
+	instances := make([]*compute.Instance, 0)
+	err := call.Pages(ctx, func(list *compute.InstanceAggregatedList) error {
+		for _, scoped := range list.Items {
+			instances = append(instances, scoped.Instances...)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return instances, nil
 }
 
 //GetSubnetsName returns slice of subnets and error if any.
@@ -252,42 +250,33 @@ func GetSubnetsName(svc *compute.Service, projectID, vpc string) ([]string, erro
 }
 
 //GetAllVPC returns all VPCs in the projectID and error if any.
-func GetAllVPC(svc *compute.Service, projectID string) (*compute.NetworkList, error) {
+func GetAllVPC(ctx context.Context, svc *compute.Service, projectID string) (*compute.NetworkList, error) {
 
 	network := compute.NewNetworksService(svc)
-	resp := network.List(projectID)
-	list, err := resp.Do()
+	list := &compute.NetworkList{Items: make([]*compute.Network, 0)}
+	err := network.List(projectID).Pages(ctx, func(page *compute.NetworkList) error {
+		list.Items = append(list.Items, page.Items...)
+		return nil
+	})
 	if err != nil {
 		return nil, err
 	}
-
 	return list, nil
 }
 
-//GetVPCfromEnv returns the VPC name, given the env name and error if any.
-func GetVPCfromEnv(svc *compute.Service, projectID, env string) (string, error) {
+//GetVPCfromEnv returns the VPC name containing the network configured for an env and error if any.
+func GetVPCfromEnv(ctx context.Context, svc *compute.Service, projectID, network string) (string, error) {
 
-	list, err := GetAllVPC(svc, projectID)
+	list, err := GetAllVPC(ctx, svc, projectID)
 	if err != nil {
 		return "", err
 	}
 	for _, v := range list.Items {
-		switch env {
-		case "prod":
-			if strings.Contains(v.Name, "-p-vpc") {
-				return v.Name, nil
-			}
-		case "dev":
-			if strings.Contains(v.Name, env) {
-				return v.Name, nil
-			}
-		case "base":
-			if strings.Contains(v.Name, env) {
-				return v.Name, nil
-			}
+		if strings.Contains(v.Name, network) {
+			return v.Name, nil
 		}
 	}
-	err = errors.New("VPC could not be found by environment name")
+	err = fmt.Errorf("VPC could not be found with name %s", network)
 	return "", err
 }
 
@@ -315,8 +304,8 @@ func GetSubNetwork(svc *compute.Service, projectID, subName, region string) (str
 	return ops.SelfLink, nil
 }
 
-//CreateSubNetwork create a subnet and returns its selflink and error if any.
-func CreateSubNetwork(svc *compute.Service, projectID, subName, region, vpcURL, cidr string) (string, error) {
+//CreateSubNetwork creates a subnet, waits for it and returns its selflink and error if any.
+func CreateSubNetwork(ctx context.Context, svc *compute.Service, projectID, subName, region, vpcURL, cidr string) (string, error) {
 
 	subnet := compute.NewSubnetworksService(svc)
 	subnetCall := subnet.Insert(projectID, region, &compute.Subnetwork{
@@ -326,27 +315,94 @@ func CreateSubNetwork(svc *compute.Service, projectID, subName, region, vpcURL,
 		Name:           subName,
 		Network:        vpcURL,
 	})
-	ops, err := subnetCall.Do()
+	ops, err := subnetCall.Context(ctx).Do()
 	if err != nil {
 		return "", err
 	}
-	return ops.SelfLink, nil
+	if err := WaitRegionOperation(ctx, svc, projectID, region, ops.Name); err != nil {
+		return "", fmt.Errorf("could not create subnet %s: %w", subName, err)
+	}
+	return ops.TargetLink, nil
+}
+
+//DeleteSubNetwork deletes a subnet and waits for it.
+func DeleteSubNetwork(ctx context.Context, svc *compute.Service, projectID, region, subName string) error {
+
+	ops, err := compute.NewSubnetworksService(svc).Delete(projectID, region, subName).Context(ctx).Do()
+	if err != nil {
+		return err
+	}
+	return WaitRegionOperation(ctx, svc, projectID, region, ops.Name)
+}
+
+//CreateNetwork creates a custom mode VPC, waits for it and returns its selflink and error if any.
+func CreateNetwork(ctx context.Context, svc *compute.Service, projectID, name, desc string) (string, error) {
+
+	ops, err := compute.NewNetworksService(svc).Insert(projectID, &compute.Network{
+		Name:                  name,
+		Description:           desc,
+		AutoCreateSubnetworks: false,
+		ForceSendFields:       []string{"AutoCreateSubnetworks"},
+	}).Context(ctx).Do()
+	if err != nil {
+		return "", err
+	}
+	if err := WaitGlobalOperation(ctx, svc, projectID, ops.Name); err != nil {
+		return "", fmt.Errorf("could not create VPC %s: %w", name, err)
+	}
+	return ops.TargetLink, nil
+}
+
+//DeleteNetwork deletes a VPC and waits for it.
+func DeleteNetwork(ctx context.Context, svc *compute.Service, projectID, name string) error {
+
+	ops, err := compute.NewNetworksService(svc).Delete(projectID, name).Context(ctx).Do()
+	if err != nil {
+		return err
+	}
+	return WaitGlobalOperation(ctx, svc, projectID, ops.Name)
+}
+
+//CreateFirewall creates a firewall rule and waits for it.
+func CreateFirewall(ctx context.Context, svc *compute.Service, projectID string, firewall *compute.Firewall) error {
+
+	ops, err := compute.NewFirewallsService(svc).Insert(projectID, firewall).Context(ctx).Do()
+	if err != nil {
+		return err
+	}
+	if err := WaitGlobalOperation(ctx, svc, projectID, ops.Name); err != nil {
+		return fmt.Errorf("could not create firewall %s: %w", firewall.Name, err)
+	}
+	return nil
+}
+
+//DeleteFirewall deletes a firewall rule and waits for it.
+func DeleteFirewall(ctx context.Context, svc *compute.Service, projectID, name string) error {
+
+	ops, err := compute.NewFirewallsService(svc).Delete(projectID, name).Context(ctx).Do()
+	if err != nil {
+		return err
+	}
+	return WaitGlobalOperation(ctx, svc, projectID, ops.Name)
 }
 
 //GetSubNetworks returns selflink of all subnetworks and error if any.
-func GetSubNetworks(svc *compute.Service, projectID string) ([]*compute.UsableSubnetwork, error) {
+func GetSubNetworks(ctx context.Context, svc *compute.Service, projectID string) ([]*compute.UsableSubnetwork, error) {
 
 	subnet := compute.NewSubnetworksService(svc)
-	subnetCall := subnet.ListUsable(projectID)
-	ops, err := subnetCall.Do()
+	items := make([]*compute.UsableSubnetwork, 0)
+	err := subnet.ListUsable(projectID).Pages(ctx, func(page *compute.UsableSubnetworksAggregatedList) error {
+		items = append(items, page.Items...)
+		return nil
+	})
 	if err != nil {
 		return nil, err
 	}
-	return ops.Items, nil
+	return items, nil
 }
 
-//CreateInstance creates an instance within a specified network tier and error if any.
-func CreateInstance(svc *compute.Service, projectID, instanceName, desc, subnet, machineType, zone, image, serviceAccount string, disks []*compute.AttachedDisk, labels map[string]string) (string, error) {
+//CreateInstance creates an instance within a specified network tier, returns the insert operation and error if any.
+func CreateInstance(svc *compute.Service, projectID, instanceName, desc, subnet, machineType, zone, image, serviceAccount string, disks []*compute.AttachedDisk, labels map[string]string, metadata *compute.Metadata, tags []string) (*compute.Operation, error) {
 
 	instance := compute.NewInstancesService(svc)
 	totalDisks := make([]*compute.AttachedDisk, 0)
@@ -367,6 +423,8 @@ func CreateInstance(svc *compute.Service, projectID, instanceName, desc, subnet,
 		Description:    desc,
 		Disks:          totalDisks,
 		Labels:         labels,
+		Metadata:       metadata,
+		Tags:           &compute.Tags{Items: tags},
 		MachineType:    fmt.Sprintf("zones/%s/machineTypes/%s", zone, machineType),
 		MinCpuPlatform: "Intel Sandy Bridge",
 		Name:           instanceName,
@@ -402,9 +460,104 @@ func CreateInstance(svc *compute.Service, projectID, instanceName, desc, subnet,
 		// },
 	}
 	instanceCall := instance.Insert(projectID, zone, input)
-	ops, err := instanceCall.Do()
+	return instanceCall.Do()
+}
+
+//waitOperation calls wait until the operation it returns is done and returns the error of the operation if any.
+func waitOperation(wait func(...googleapi.CallOption) (*compute.Operation, error)) error {
+	for {
+		ops, err := wait()
+		if err != nil {
+			return err
+		}
+		if ops.Status != "DONE" {
+			continue
+		}
+		if ops.Error != nil && len(ops.Error.Errors) > 0 {
+			return errors.New(ops.Error.Errors[0].Message)
+		}
+		return nil
+	}
+}
+
+//WaitZoneOperation blocks until the zone operation is done and returns its error if any.
+func WaitZoneOperation(ctx context.Context, svc *compute.Service, projectID, zone, operation string) error {
+	return waitOperation(compute.NewZoneOperationsService(svc).Wait(projectID, zone, operation).Context(ctx).Do)
+}
+
+//WaitRegionOperation blocks until the region operation is done and returns its error if any.
+func WaitRegionOperation(ctx context.Context, svc *compute.Service, projectID, region, operation string) error {
+	return waitOperation(compute.NewRegionOperationsService(svc).Wait(projectID, region, operation).Context(ctx).Do)
+}
+
+//WaitGlobalOperation blocks until the global operation is done and returns its error if any.
+func WaitGlobalOperation(ctx context.Context, svc *compute.Service, projectID, operation string) error {
+	return waitOperation(compute.NewGlobalOperationsService(svc).Wait(projectID, operation).Context(ctx).Do)
+}
+
+//WaitInstanceRunning waits for the insert operation of an instance and polls until the instance is RUNNING.
+func WaitInstanceRunning(ctx context.Context, svc *compute.Service, projectID, zone, operation, instanceName string) (*compute.Instance, error) {
+
+	if err := WaitZoneOperation(ctx, svc, projectID, zone, operation); err != nil {
+		return nil, err
+	}
+	instances := compute.NewInstancesService(svc)
+	for {
+		instance, err := instances.Get(projectID, zone, instanceName).Context(ctx).Do()
+		if err != nil {
+			return nil, err
+		}
+		switch instance.Status {
+		case "RUNNING":
+			return instance, nil
+		case "STOPPING", "STOPPED", "SUSPENDING", "SUSPENDED", "TERMINATED":
+			return instance, fmt.Errorf("instance %s is %s", instanceName, instance.Status)
+		}
+		select {
+		case <-ctx.Done():
+			return instance, ctx.Err()
+		case <-time.After(5 * time.Second):
+		}
+	}
+}
+
+//DeleteInstance deletes an instance, removing its non auto-delete disks unless keepDisks is set.
+func DeleteInstance(ctx context.Context, svc *compute.Service, projectID, zone, instanceName string, keepDisks bool) (string, error) {
+
+	instance, err := GetInstance(svc, projectID, zone, instanceName)
 	if err != nil {
 		return "", err
 	}
-	return ops.Status, nil
+	disks := make([]string, 0)
+	for _, disk := range instance.Disks {
+		if disk.Boot || disk.AutoDelete {
+			continue
+		}
+		fields := strings.Split(disk.Source, "/")
+		disks = append(disks, fields[len(fields)-1])
+	}
+	instanceService := compute.NewInstancesService(svc)
+	ops, err := instanceService.Delete(projectID, zone, instanceName).Context(ctx).Do()
+	if err != nil {
+		return "", err
+	}
+	if keepDisks || len(disks) == 0 {
+		return ops.Status, nil
+	}
+	if err := WaitZoneOperation(ctx, svc, projectID, zone, ops.Name); err != nil {
+		return "", err
+	}
+	diskService := compute.NewDisksService(svc)
+	for _, disk := range disks {
+		if _, err := diskService.Delete(projectID, zone, disk).Context(ctx).Do(); err != nil {
+			return "", fmt.Errorf("could not delete disk %s: %w", disk, err)
+		}
+	}
+	return "DONE", nil
+}
+
+//IsNotFound reports whether err is a 404 from the compute API.
+func IsNotFound(err error) bool {
+	var gerr *googleapi.Error
+	return errors.As(err, &gerr) && gerr.Code == http.StatusNotFound
 }
@@ -0,0 +1,87 @@
+package gcp
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestListsWalkEveryPage(t *testing.T) {
+
+	f, svc, stop := newFakeCompute(t, map[string][]string{
+		"proj/zones": {
+			`{"items":[{"name":"us-east1-b"},{"name":"europe-west1-b"}]}`,
+			`{"items":[]}`,
+			`{"items":[{"name":"us-east1-c"}]}`,
+		},
+		"proj/global/networks": {
+			`{"items":[{"name":"shared"}]}`,
+			`{"items":[{"name":"dev-base-vpc"}]}`,
+		},
+		"proj/aggregated/subnetworks/listUsable": {
+			`{"items":[{"subnetwork":"web"}]}`,
+			`{"items":[{"subnetwork":"app"}]}`,
+		},
+		"proj/aggregated/instances": {
+			`{"items":{"zones/us-east1-b":{"instances":[{"name":"web1"}]}}}`,
+			`{"items":{"zones/us-east1-c":{"instances":[{"name":"web2"}]},"zones/us-east1-d":{}}}`,
+		},
+	})
+	defer stop()
+	ctx := context.Background()
+	tests := []struct {
+		path string
+		list func() ([]string, error)
+		want []string
+	}{
+		{path: "proj/zones", list: func() ([]string, error) {
+			return GetZonesString(ctx, svc, "proj", "us-east1")
+		}, want: []string{"us-east1-b", "us-east1-c"}},
+		{path: "proj/global/networks", list: func() ([]string, error) {
+			vpc, err := GetVPCfromEnv(ctx, svc, "proj", "base")
+			return []string{vpc}, err
+		}, want: []string{"dev-base-vpc"}},
+		{path: "proj/aggregated/subnetworks/listUsable", list: func() ([]string, error) {
+			subnets, err := GetSubNetworks(ctx, svc, "proj")
+			names := make([]string, 0, len(subnets))
+			for _, s := range subnets {
+				names = append(names, s.Subnetwork)
+			}
+			return names, err
+		}, want: []string{"web", "app"}},
+		{path: "proj/aggregated/instances", list: func() ([]string, error) {
+			instances, err := ListInstances(ctx, svc, "proj", "labels.env = dev")
+			names := make([]string, 0, len(instances))
+			for _, inst := range instances {
+				names = append(names, inst.Name)
+			}
+			return names, err
+		}, want: []string{"web1", "web2"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			got, err := tt.list()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+			if calls, pages := f.count(tt.path), len(f.pages[tt.path]); calls != pages {
+				t.Errorf("%d calls, want one per page (%d)", calls, pages)
+			}
+		})
+	}
+}
+
+func TestListsReturnPageErrors(t *testing.T) {
+
+	//the second page is announced but missing, so it fails.
+	_, svc, stop := newFakeCompute(t, map[string][]string{
+		"proj/zones": {`{"nextPageToken":"p1","items":[{"name":"us-east1-b"}]}`},
+	})
+	defer stop()
+	if zones, err := GetZones(context.Background(), svc, "proj"); err == nil {
+		t.Errorf("GetZones = %v, want the error of the second page", zones)
+	}
+}
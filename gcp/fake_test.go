@@ -0,0 +1,69 @@
+package gcp
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"google.golang.org/api/compute/v1"
+	"google.golang.org/api/option"
+)
+
+//fakeCompute serves pages of compute API list calls, keyed by the path below the projects/ base path.
+type fakeCompute struct {
+	mu    sync.Mutex
+	calls []string
+	pages map[string][]string
+}
+
+//newFakeCompute starts a fakeCompute serving pages and returns it with a service calling it.
+//Each page is a JSON object, the fake adds the nextPageToken of every page but the last.
+func newFakeCompute(t *testing.T, pages map[string][]string) (*fakeCompute, *compute.Service, func()) {
+
+	f := &fakeCompute{pages: pages}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path := strings.TrimPrefix(r.URL.Path, "/")
+		f.mu.Lock()
+		f.calls = append(f.calls, path)
+		list := f.pages[path]
+		f.mu.Unlock()
+		i := 0
+		if token := r.URL.Query().Get("pageToken"); token != "" {
+			fmt.Sscanf(token, "p%d", &i)
+		}
+		if i >= len(list) {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprintf(w, `{"error":{"code":404,"message":"no page %d of %s"}}`, i, path)
+			return
+		}
+		page := list[i]
+		if i+1 < len(list) {
+			page = fmt.Sprintf(`{"nextPageToken":"p%d",`, i+1) + strings.TrimPrefix(page, "{")
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(page))
+	}))
+	svc, err := compute.NewService(context.Background(), option.WithEndpoint(server.URL+"/"), option.WithHTTPClient(server.Client()))
+	if err != nil {
+		server.Close()
+		t.Fatal(err)
+	}
+	return f, svc, server.Close
+}
+
+//count returns how many calls were made to path.
+func (f *fakeCompute) count(path string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	n := 0
+	for _, call := range f.calls {
+		if call == path {
+			n++
+		}
+	}
+	return n
+}
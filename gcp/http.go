@@ -1,18 +1,25 @@
 package gcp
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
-	"math/rand"
-	"net/http"
+	"path"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
-	"time"
 
+	"github.com/shakilbd009/go-cloud/bootstrap"
+	"github.com/shakilbd009/go-cloud/cloud"
+	"github.com/shakilbd009/go-cloud/config"
+	"github.com/shakilbd009/go-cloud/landingzone"
+	"github.com/shakilbd009/go-cloud/naming"
+	"github.com/shakilbd009/go-cloud/validate"
 	"google.golang.org/api/compute/v1"
 )
 
+const providerName = "gcp"
+
 //GCPrequest object
 type GCPrequest struct {
 	Environment string `json:"env"`
@@ -21,142 +28,539 @@ type GCPrequest struct {
 	OsFlavor    string `json:"flavor"`
 	Disks       string `json:"disks"`
 	CountTO     string `json:"countTO"`
+	Count       int    `json:"count"`
 	AppCode     string `json:"appCode"`
 	ChangeNum   string `json:"requestNum"`
 	MachineType string `json:"machineType"`
 	Desc        string `json:"description"`
 	Instance    string `json:"instanceName"`
+	Zone        string `json:"zone"`
+	Wait        bool   `json:"wait"`
+	WaitTimeout string `json:"waitTimeout"`
+	UserData    string `json:"userData"`
+	SSHKey      string `json:"sshKey"`
 }
 
 //GCPresponse object
-type GCPresponse struct {
-	InstanceName      string `json:"InstanceName,omitempty"`
-	Status            string `json:"status,omitempty"`
-	NetworkInterfaces string `json:"networkInterfaces,omitempty"`
-	Zone              string `json:"zone,omitempty"`
-	Error             string `json:"error,omitempty"`
+type GCPresponse = cloud.Instance
+
+//Provider implements cloud.Provider for gcp.
+type Provider struct {
+	Svc            *compute.Service
+	ProjectID      string
+	ServiceAccount string
+	Namer          *naming.Namer
+	Settings       config.Source
+	//Username is the login the ssh key of a request is given to.
+	Username string
+	//Workers bounds how many instances of one request are created at once.
+	Workers int
 }
 
-//Get responds to GET method
-func Get(w http.ResponseWriter, r *http.Request, svc *compute.Service, payload GCPrequest, projectID, provider, zone, instanceName string) {
+//NewProvider returns a Provider for the given project or an error if any.
+func NewProvider(ctx context.Context, projectID, serviceAccount string, settings config.Source) (*Provider, error) {
 
-	instance, err := GetInstance(svc, projectID, zone, instanceName)
+	svc, err := GetSession(ctx)
 	if err != nil {
-		errResp(w, err)
-		return
+		return nil, err
 	}
-	resp := GCPresponse{
-		InstanceName:      instanceName,
-		Zone:              zone,
-		NetworkInterfaces: instance.NetworkInterfaces[0].NetworkIP,
+	return &Provider{
+		Svc:            svc,
+		ProjectID:      projectID,
+		ServiceAccount: serviceAccount,
+		Namer:          naming.Default(),
+		Settings:       settings,
+		Username:       "gcpadmin",
+		Workers:        4,
+	}, nil
+}
+
+//NewGCPrequest maps a cloud.Request into a GCPrequest.
+func NewGCPrequest(req cloud.Request) GCPrequest {
+
+	machineType := req.MachineType
+	if machineType == "" {
+		machineType = req.InstanceType
 	}
-	data, err := json.MarshalIndent(resp, "", "  ")
-	if err != nil {
-		errResp(w, err)
-		return
+	return GCPrequest{
+		Environment: req.Environment,
+		Tier:        req.Tier,
+		Osname:      req.Osname,
+		OsFlavor:    req.OsFlavor,
+		Disks:       req.Disks,
+		CountTO:     req.CountTO,
+		Count:       req.Count,
+		AppCode:     req.AppCode,
+		ChangeNum:   req.ChangeNum,
+		MachineType: machineType,
+		Desc:        req.Desc,
+		Instance:    req.Instance,
+		Zone:        req.Zone,
+		Wait:        req.Wait,
+		WaitTimeout: req.WaitTimeout,
+		UserData:    req.UserData,
+		SSHKey:      req.SSHKey,
+	}
+}
+
+//newRequest maps req into a GCPrequest, using the configured default machine type if none is passed.
+func (p *Provider) newRequest(req cloud.Request) GCPrequest {
+
+	payload := NewGCPrequest(req)
+	if payload.MachineType == "" {
+		payload.MachineType = p.Settings.Current().Provider(providerName).InstanceType
+	}
+	return payload
+}
+
+//Request maps a GCPrequest into a cloud.Request.
+func (r GCPrequest) Request() cloud.Request {
+	return cloud.Request{
+		Provider:    providerName,
+		Environment: r.Environment,
+		Tier:        r.Tier,
+		Osname:      r.Osname,
+		OsFlavor:    r.OsFlavor,
+		Disks:       r.Disks,
+		CountTO:     r.CountTO,
+		Count:       r.Count,
+		AppCode:     r.AppCode,
+		ChangeNum:   r.ChangeNum,
+		MachineType: r.MachineType,
+		Desc:        r.Desc,
+		Instance:    r.Instance,
+		Zone:        r.Zone,
+		Wait:        r.Wait,
+		WaitTimeout: r.WaitTimeout,
+		UserData:    r.UserData,
+		SSHKey:      r.SSHKey,
 	}
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	w.Write(data)
 }
 
-func errResp(w http.ResponseWriter, err error) {
+//Name returns the provider name.
+func (p *Provider) Name() string { return providerName }
 
-	resp := GCPresponse{
-		Error: err.Error(),
+//Rules returns what gcp accepts in a request.
+func (p *Provider) Rules() validate.Rules {
+	return validate.Rules{
+		Provider: providerName,
+		OS: map[string][]string{
+			"windows": {"12", "16", "19"},
+			"centos":  {"6", "7", "8"},
+			"redhat":  {"6", "7", "8"},
+			"debian":  {"13", "14", "15"},
+			"ubuntu":  {"18", "19", "20"},
+			"suse":    {"12", "15"},
+		},
+		MaxDiskGB:           65536,
+		CountMode:           validate.CountRange,
+		MaxCount:            20,
+		RequireInstanceType: true,
+		SizeField:           "machineType",
+		Identity:            []string{"instanceName"},
 	}
-	data, err := json.MarshalIndent(resp, "", "  ")
+}
+
+//Exists reports whether an instance with the given name exists.
+func (p *Provider) Exists(ctx context.Context, name string) (bool, error) {
+	return InstanceExists(ctx, p.Svc, p.ProjectID, name)
+}
+
+//NamesWithPrefix returns the names of the instances starting with prefix.
+func (p *Provider) NamesWithPrefix(ctx context.Context, prefix string) ([]string, error) {
+
+	found, err := ListInstances(ctx, p.Svc, p.ProjectID, fmt.Sprintf("name eq %s.*", prefix))
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+		return nil, err
 	}
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusBadRequest)
-	w.Write(data)
+	names := make([]string, 0, len(found))
+	for _, instance := range found {
+		names = append(names, instance.Name)
+	}
+	return names, nil
 }
 
-//Post makes a POST request.
-func Post(w http.ResponseWriter, r *http.Request, svc *compute.Service, payload GCPrequest, projectID, provider, region, serviceAccount string) {
+//instanceNames returns the names covered by the countTO range of a request, or for its count the names of a retried request
+//topped up with the next free names. release frees names allocated for count once they are created.
+func (p *Provider) instanceNames(ctx context.Context, req cloud.Request, payload GCPrequest) (names []string, release func(), err error) {
 
-	instanceName, err := GetInstanceName(provider, payload.Environment, payload.Osname, payload.AppCode)
+	if payload.CountTO == "" {
+		if len(req.Names) >= payload.Count {
+			return req.Names, func() {}, nil
+		}
+		names, release, err = p.Namer.Allocate(ctx, p, providerName, payload.Environment, payload.Osname, payload.AppCode, payload.Count-len(req.Names))
+		if err != nil {
+			return nil, nil, err
+		}
+		return append(append([]string{}, req.Names...), names...), release, nil
+	}
+	start, stop, err := cloud.ParseCount(payload.CountTO)
 	if err != nil {
-		errResp(w, err)
-		return
+		return nil, nil, err
+	}
+	names = make([]string, 0, (stop-start)+1)
+	for i := start; i <= stop; i++ {
+		name, err := p.Namer.Name(providerName, payload.Environment, payload.Osname, payload.AppCode, i)
+		if err != nil {
+			return nil, nil, err
+		}
+		names = append(names, name)
 	}
+	return names, func() {}, nil
+}
 
-	vpc, err := GetVPCfromEnv(svc, projectID, payload.Environment)
+//resolved object holds the network, image and zones a request resolves to.
+type resolved struct {
+	vpc       string
+	subnetURL string
+	image     string
+	zones     []string
+}
+
+//resolve looks up the VPC, subnet, image and zones configured for payload.
+func (p *Provider) resolve(ctx context.Context, payload GCPrequest) (resolved, error) {
+
+	svc, projectID := p.Svc, p.ProjectID
+	net, err := p.Settings.Current().Network(providerName, payload.Environment, payload.Tier)
+	if err != nil {
+		return resolved{}, err
+	}
+	vpc, err := GetVPCfromEnv(ctx, svc, projectID, net.Network)
 	if err != nil {
-		errResp(w, err)
-		return
+		return resolved{}, err
 	}
-	subnet, err := GetSubnetName(svc, projectID, vpc, payload.Tier)
+	subnet, err := GetSubnetName(svc, projectID, vpc, net.Subnet)
 	if err != nil {
-		errResp(w, err)
-		return
+		return resolved{}, err
 	}
-	subnetURL, err := GetSubNetwork(svc, projectID, subnet, region)
+	subnetURL, err := GetSubNetwork(svc, projectID, subnet, net.Region)
 	if err != nil {
-		errResp(w, err)
-		return
+		return resolved{}, err
 	}
 	image, err := GetImage(svc, payload.Osname, payload.OsFlavor)
 	if err != nil {
-		errResp(w, err)
-		return
+		return resolved{}, err
+	}
+	zones, err := GetZonesString(ctx, svc, projectID, net.Region)
+	if err != nil {
+		return resolved{}, err
+	}
+	if len(zones) == 0 {
+		return resolved{}, fmt.Errorf("no zones found in region %s", net.Region)
+	}
+	return resolved{vpc: vpc, subnetURL: subnetURL, image: image, zones: zones}, nil
+}
+
+//defaultZone returns zone or the configured default zone if empty.
+func (p *Provider) defaultZone(zone string) string {
+	if zone != "" {
+		return zone
+	}
+	return p.Settings.Current().Provider(providerName).Zone
+}
+
+//Describe returns the instance named in req.
+func (p *Provider) Describe(ctx context.Context, req cloud.Request) ([]cloud.Instance, error) {
+
+	payload := NewGCPrequest(req)
+	zone := p.defaultZone(payload.Zone)
+	instance, err := GetInstance(p.Svc, p.ProjectID, zone, payload.Instance)
+	if err != nil {
+		return nil, err
+	}
+	return []cloud.Instance{{
+		Provider:          providerName,
+		InstanceName:      instance.Name,
+		ID:                strconv.FormatUint(instance.Id, 10),
+		Status:            instance.Status,
+		NetworkInterfaces: instance.NetworkInterfaces[0].NetworkIP,
+		Zone:              zone,
+		Environment:       instance.Labels["env"],
+	}}, nil
+}
+
+//Plan resolves the names, VPC, subnet, image, disks and zones for req.
+func (p *Provider) Plan(ctx context.Context, req cloud.Request) (cloud.Plan, error) {
+
+	projectID := p.ProjectID
+	payload := p.newRequest(req)
+	names, release, err := p.instanceNames(ctx, req, payload)
+	if err != nil {
+		return cloud.Plan{}, err
+	}
+	defer release()
+	if err := naming.Check(ctx, p, names...); err != nil {
+		return cloud.Plan{}, err
+	}
+	res, err := p.resolve(ctx, payload)
+	if err != nil {
+		return cloud.Plan{}, err
 	}
-	zones, err := GetZonesString(svc, projectID, region)
+	plan := cloud.Plan{
+		Provider:     providerName,
+		Names:        names,
+		Image:        res.image,
+		Network:      res.vpc,
+		Subnet:       res.subnetURL,
+		InstanceType: payload.MachineType,
+		Disks:        make([]string, 0),
+		Zones:        res.zones,
+	}
+	for _, instanceNm := range names {
+		disks, err := GetPersistantDisks(payload.Disks, instanceNm, "", projectID)
+		if err != nil {
+			return cloud.Plan{}, err
+		}
+		for _, disk := range disks {
+			plan.Disks = append(plan.Disks, fmt.Sprintf("%s %dGB", disk.InitializeParams.DiskName, disk.InitializeParams.DiskSizeGb))
+		}
+	}
+	return plan, nil
+}
+
+//metadata returns the instance metadata carrying the user data and ssh key of payload, nil if it has neither.
+func (p *Provider) metadata(payload GCPrequest, publicKey string) *compute.Metadata {
+
+	items := make([]*compute.MetadataItems, 0, 2)
+	if payload.UserData != "" {
+		items = append(items, &compute.MetadataItems{Key: bootstrap.MetadataKey(payload.UserData, payload.Osname), Value: &payload.UserData})
+	}
+	if publicKey != "" {
+		//the guest agent expects user:type key user, the comment of the key is replaced by the login.
+		fields := strings.Fields(publicKey)
+		entry := fmt.Sprintf("%s:%s %s %s", p.Username, fields[0], fields[1], p.Username)
+		items = append(items, &compute.MetadataItems{Key: "ssh-keys", Value: &entry})
+	}
+	if len(items) == 0 {
+		return nil
+	}
+	return &compute.Metadata{Items: items}
+}
+
+//Provision creates the instances described by req.
+func (p *Provider) Provision(ctx context.Context, req cloud.Request) ([]cloud.Instance, error) {
+
+	svc, projectID, serviceAccount := p.Svc, p.ProjectID, p.ServiceAccount
+	payload := p.newRequest(req)
+	names, release, err := p.instanceNames(ctx, req, payload)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	names, existing, err := naming.Available(ctx, p, req.Resume, names...)
 	if err != nil {
-		errResp(w, err)
-		return
+		return nil, err
 	}
-	rnd := rand.New(rand.NewSource(time.Now().UnixNano()))
-	count := strings.Split(payload.CountTO, "-")
-	start, err := strconv.Atoi(count[0])
+	res, err := p.resolve(ctx, payload)
 	if err != nil {
-		errResp(w, err)
-		return
+		return nil, err
 	}
-	stop, err := strconv.Atoi(count[1])
+	timeout, err := payload.Request().Timeout()
 	if err != nil {
-		errResp(w, err)
-		return
+		return nil, err
 	}
-	resp := make([]GCPresponse, 0, (stop-start)+1)
 	labels := map[string]string{"appcode": payload.AppCode, "os": payload.Osname, "env": payload.Environment, "change": payload.ChangeNum}
+	metadata := p.metadata(payload, req.SSHPublicKey)
+	resp := make([]GCPresponse, len(names))
+	create := func(i int) {
+		instanceNm := names[i]
+		zone := res.zones[i%len(res.zones)]
+		result := GCPresponse{Provider: providerName, InstanceName: instanceNm, Zone: zone, CredentialRef: req.SSHKeyRef}
+		defer func() {
+			resp[i] = result
+			cloud.ReportProgress(ctx, result)
+		}()
+		disks, err := GetPersistantDisks(payload.Disks, instanceNm, zone, projectID)
+		if err != nil {
+			result.Status, result.Error = "FAILED", err.Error()
+			return
+		}
+		op, err := CreateInstance(svc, projectID, instanceNm, payload.Desc, res.subnetURL, payload.MachineType, zone, res.image, serviceAccount, disks, labels, metadata, []string{landingzone.Tag(payload.Environment, payload.Tier)})
+		if err != nil {
+			result.Status, result.Error = "FAILED", err.Error()
+			return
+		}
+		result.Status = op.Status
+		cloud.Record(ctx, instanceNm, "instance", instanceNm, func(ctx context.Context) error {
+			if _, err := DeleteInstance(ctx, svc, projectID, zone, instanceNm, false); err != nil && !IsNotFound(err) {
+				return err
+			}
+			return nil
+		})
+		if !payload.Wait {
+			return
+		}
+		cloud.ReportProgress(ctx, result)
+		waitCtx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+		instance, err := WaitInstanceRunning(waitCtx, svc, projectID, zone, op.Name, instanceNm)
+		if instance != nil {
+			result.Status = instance.Status
+			result.LaunchTime = instance.CreationTimestamp
+			for _, nic := range instance.NetworkInterfaces {
+				result.PrivateIPs = append(result.PrivateIPs, nic.NetworkIP)
+			}
+			if len(result.PrivateIPs) > 0 {
+				result.NetworkInterfaces = result.PrivateIPs[0]
+			}
+		}
+		if err != nil {
+			result.Error = fmt.Sprintf("instance did not reach RUNNING within %s: %v", timeout, err)
+		}
+	}
+	workers := p.Workers
+	if workers < 1 {
+		workers = 1
+	}
+	if workers > len(names) {
+		workers = len(names)
+	}
+	next := make(chan int)
 	var wg sync.WaitGroup
-	for i := start; i <= stop; i++ {
+	for w := 0; w < workers; w++ {
 		wg.Add(1)
-		go func(i int, payload GCPrequest) {
-			zone := zones[rnd.Intn(len(zones))]
-			instanceNm := fmt.Sprintf("%s%02d", instanceName, i)
-			disks, err := GetPersistantDisks(payload.Disks, instanceNm, zone, projectID)
-			if err != nil {
-				errResp(w, err)
-				return
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				create(i)
 			}
-			status, err := CreateInstance(svc, projectID, instanceNm, payload.Desc, subnetURL, payload.MachineType, zone, image, serviceAccount, disks, labels)
-			if err != nil {
-				errResp(w, err)
-				return
-			}
-			resp = append(resp, GCPresponse{
-				InstanceName: instanceNm,
-				Status:       status,
-				Zone:         zone,
-			})
-			wg.Done()
-		}(i, payload)
-
+		}()
+	}
+	for i := range names {
+		next <- i
 	}
+	close(next)
 	wg.Wait()
+	for _, name := range existing {
+		result := cloud.Instance{Provider: providerName, InstanceName: name, Status: "EXISTS"}
+		resp = append(resp, result)
+		cloud.ReportProgress(ctx, result)
+	}
+	failed := 0
+	for _, result := range resp {
+		if result.Error != "" {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return resp, fmt.Errorf("%d of %d instances failed to create", failed, len(resp))
+	}
+	return resp, nil
+}
+
+//Delete deletes the instance named in req.
+func (p *Provider) Delete(ctx context.Context, req cloud.Request) ([]cloud.Instance, error) {
 
-	//resp := GCPresponse{instanceName, status, ""}
-	data, err := json.MarshalIndent(resp, "", "  ")
+	payload := NewGCPrequest(req)
+	zone := p.defaultZone(payload.Zone)
+	status, err := DeleteInstance(ctx, p.Svc, p.ProjectID, zone, payload.Instance, req.KeepDisks)
 	if err != nil {
-		errResp(w, err)
-		return
+		return nil, err
+	}
+	return []cloud.Instance{{
+		Provider:     providerName,
+		InstanceName: payload.Instance,
+		Status:       status,
+		Zone:         zone,
+	}}, nil
+}
+
+//List returns the instances whose appcode, env and change labels match filter.
+func (p *Provider) List(ctx context.Context, filter cloud.Filter) ([]cloud.Instance, error) {
+
+	exprs := make([]string, 0, 3)
+	for label, value := range map[string]string{"appcode": filter.AppCode, "env": filter.Environment, "change": filter.ChangeNum} {
+		if value != "" {
+			exprs = append(exprs, fmt.Sprintf("(labels.%s = %q)", label, strings.ToLower(value)))
+		}
+	}
+	sort.Strings(exprs)
+	found, err := ListInstances(ctx, p.Svc, p.ProjectID, strings.Join(exprs, " "))
+	if err != nil {
+		return nil, err
+	}
+	instances := make([]cloud.Instance, 0, len(found))
+	for _, instance := range found {
+		inst := cloud.Instance{
+			Provider:     providerName,
+			InstanceName: instance.Name,
+			ID:           strconv.FormatUint(instance.Id, 10),
+			Status:       instance.Status,
+			Zone:         path.Base(instance.Zone),
+			Environment:  instance.Labels["env"],
+			LaunchTime:   instance.CreationTimestamp,
+		}
+		for _, nic := range instance.NetworkInterfaces {
+			inst.PrivateIPs = append(inst.PrivateIPs, nic.NetworkIP)
+		}
+		if len(inst.PrivateIPs) > 0 {
+			inst.NetworkInterfaces = inst.PrivateIPs[0]
+		}
+		instances = append(instances, inst)
+	}
+	return instances, nil
+}
+
+//LandingZone creates the VPC of req with a subnet per tier and firewall rules targeting the network tag of each tier.
+//Everything is named so the config it returns finds it, and recorded on the saga of ctx.
+func (p *Provider) LandingZone(ctx context.Context, req landingzone.Request) (landingzone.Zone, error) {
+
+	svc, projectID := p.Svc, p.ProjectID
+	region := req.Region
+	if region == "" {
+		region = p.Settings.Current().Provider(providerName).Region
+	}
+	cidrs, err := landingzone.Carve(req.CIDR, len(landingzone.Tiers))
+	if err != nil {
+		return landingzone.Zone{}, err
+	}
+	env, vpcName := req.Environment, landingzone.Name(req.Environment, "", "vpc")
+	if _, _, err := GetVPC(svc, projectID, vpcName); err == nil {
+		return landingzone.Zone{}, fmt.Errorf("%w: VPC %s", landingzone.ErrExists, vpcName)
+	} else if !IsNotFound(err) {
+		return landingzone.Zone{}, err
+	}
+	vpcURL, err := CreateNetwork(ctx, svc, projectID, vpcName, fmt.Sprintf("landing zone of %s", env))
+	if err != nil {
+		return landingzone.Zone{}, err
+	}
+	cloud.Record(ctx, "", "network", vpcName, func(ctx context.Context) error { return DeleteNetwork(ctx, svc, projectID, vpcName) })
+	zone := landingzone.Zone{Provider: providerName, Environment: env, Region: region, Network: vpcName, NetworkID: vpcURL, CIDR: req.CIDR}
+	for i, tier := range landingzone.Tiers {
+		s := landingzone.Subnet{Tier: tier, Name: landingzone.Name(env, tier, "subnet"), CIDR: cidrs[i]}
+		if s.ID, err = CreateSubNetwork(ctx, svc, projectID, s.Name, region, vpcURL, s.CIDR); err != nil {
+			return landingzone.Zone{}, err
+		}
+		cloud.Record(ctx, "", "subnet", s.Name, func(ctx context.Context) error { return DeleteSubNetwork(ctx, svc, projectID, region, s.Name) })
+		for j, rule := range landingzone.Rules(tier, req.CIDR) {
+			firewall := &compute.Firewall{
+				Name:       fmt.Sprintf("%s-%d", landingzone.Name(env, tier, "fw"), j+1),
+				Network:    vpcURL,
+				Direction:  "INGRESS",
+				TargetTags: []string{landingzone.Tag(env, tier)},
+				Allowed:    []*compute.FirewallAllowed{{IPProtocol: "tcp", Ports: []string{ports(rule)}}},
+			}
+			if rule.Tier != "" {
+				firewall.SourceTags = []string{landingzone.Tag(env, rule.Tier)}
+			} else {
+				firewall.SourceRanges = []string{rule.CIDR}
+			}
+			if err := CreateFirewall(ctx, svc, projectID, firewall); err != nil {
+				return landingzone.Zone{}, err
+			}
+			name := firewall.Name
+			cloud.Record(ctx, "", "firewall", name, func(ctx context.Context) error { return DeleteFirewall(ctx, svc, projectID, name) })
+		}
+		zone.Subnets = append(zone.Subnets, s)
+	}
+	zone.Config = landingzone.Config(providerName, region, "", vpcName, zone.Subnets)
+	return zone, nil
+}
+
+//ports formats the port range of a rule for a firewall.
+func ports(rule landingzone.Rule) string {
+	if rule.FromPort == rule.ToPort {
+		return strconv.FormatInt(rule.FromPort, 10)
 	}
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusCreated)
-	w.Write(data)
+	return fmt.Sprintf("%d-%d", rule.FromPort, rule.ToPort)
 }
@@ -0,0 +1,111 @@
+package gcp
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/shakilbd009/go-cloud/cloud"
+	"github.com/shakilbd009/go-cloud/naming"
+)
+
+//allocationProvider returns a Provider whose project has instances named after the prefix of its requests
+//followed by the suffixes of each page, and that prefix.
+func allocationProvider(t *testing.T, pages ...[]string) (*Provider, string, func()) {
+
+	namer := naming.Default()
+	prefix, err := namer.Prefix(providerName, "base", "redhat", "abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lists := make([]string, 0, len(pages))
+	for i, suffixes := range pages {
+		instances := ""
+		for j, suffix := range suffixes {
+			if j > 0 {
+				instances += ","
+			}
+			instances += fmt.Sprintf(`{"name":%q}`, prefix+suffix)
+		}
+		lists = append(lists, fmt.Sprintf(`{"items":{"zones/us-east1-%c":{"instances":[%s]}}}`, 'b'+i, instances))
+	}
+	_, svc, stop := newFakeCompute(t, map[string][]string{"proj/aggregated/instances": lists})
+	return &Provider{Svc: svc, ProjectID: "proj", Namer: namer}, prefix, stop
+}
+
+func TestInstanceNames(t *testing.T) {
+
+	p, prefix, stop := allocationProvider(t, []string{"04"}, []string{"09", "-old99"})
+	defer stop()
+	tests := []struct {
+		name    string
+		names   []string
+		payload GCPrequest
+		want    []string
+	}{
+		{name: "count", payload: GCPrequest{Count: 2}, want: []string{"10", "11"}},
+		{name: "retried count", names: []string{prefix + "05"}, payload: GCPrequest{Count: 3}, want: []string{"05", "10", "11"}},
+		{name: "complete retry", names: []string{prefix + "05", prefix + "06"}, payload: GCPrequest{Count: 2}, want: []string{"05", "06"}},
+		{name: "countTO", payload: GCPrequest{CountTO: "3-5"}, want: []string{"03", "04", "05"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.payload.Environment, tt.payload.Osname, tt.payload.AppCode = "base", "redhat", "abc"
+			names, release, err := p.instanceNames(context.Background(), cloud.Request{Names: tt.names}, tt.payload)
+			if err != nil {
+				t.Fatal(err)
+			}
+			release()
+			want := make([]string, 0, len(tt.want))
+			for _, seq := range tt.want {
+				want = append(want, prefix+seq)
+			}
+			if fmt.Sprint(names) != fmt.Sprint(want) {
+				t.Errorf("names = %v, want %v", names, want)
+			}
+		})
+	}
+}
+
+func TestInstanceNamesConcurrentRequests(t *testing.T) {
+
+	p, prefix, stop := allocationProvider(t, []string{"01"}, []string{"02"})
+	defer stop()
+	const requests = 8
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		all      []string
+		releases []func()
+	)
+	for i := 0; i < requests; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			payload := GCPrequest{Environment: "base", Osname: "redhat", AppCode: "abc", Count: 2}
+			names, release, err := p.instanceNames(context.Background(), cloud.Request{}, payload)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			all = append(all, names...)
+			releases = append(releases, release)
+		}()
+	}
+	wg.Wait()
+	for _, release := range releases {
+		release()
+	}
+	sort.Strings(all)
+	want := make([]string, 0, 2*requests)
+	for seq := 3; seq < 3+2*requests; seq++ {
+		want = append(want, fmt.Sprintf("%s%02d", prefix, seq))
+	}
+	if fmt.Sprint(all) != fmt.Sprint(want) {
+		t.Errorf("concurrent requests got %v, want disjoint names %v", all, want)
+	}
+}
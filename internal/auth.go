@@ -0,0 +1,142 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/shakilbd009/go-cloud/auth"
+	"github.com/shakilbd009/go-cloud/cloud"
+)
+
+var (
+	authenticator auth.Authenticator
+	policy        auth.Policy
+)
+
+//loadAuth reads the auth config at path, leaving the server open if path is empty.
+func loadAuth(path string) error {
+
+	if path == "" {
+		log.Println("WARNING: no -auth config given, the API accepts anonymous requests")
+		return nil
+	}
+	a, p, err := auth.Load(path)
+	if err != nil {
+		return err
+	}
+	authenticator, policy = a, p
+	return nil
+}
+
+//handle registers h on pattern behind the authentication middleware when auth is enabled.
+func handle(pattern string, h http.HandlerFunc) {
+	if authenticator == nil {
+		http.Handle(pattern, h)
+		return
+	}
+	http.Handle(pattern, auth.Middleware(authenticator, h))
+}
+
+//allowed reports whether the caller of r may run action on provider and env.
+func allowed(r *http.Request, action, provider, env string) bool {
+
+	if authenticator == nil {
+		return true
+	}
+	principal, _ := auth.FromContext(r.Context())
+	return policy.Allowed(principal, action, provider, env)
+}
+
+//allowedAnywhere reports whether the caller of r may run action on provider in at least one environment.
+func allowedAnywhere(r *http.Request, action, provider string) bool {
+
+	if authenticator == nil {
+		return true
+	}
+	principal, _ := auth.FromContext(r.Context())
+	return policy.AllowedAnywhere(principal, action, provider)
+}
+
+//authorize responds with 403 and returns false if the caller may not run action on provider and env.
+func authorize(w http.ResponseWriter, r *http.Request, action, provider, env string) bool {
+
+	if allowed(r, action, provider, env) {
+		return true
+	}
+	principal, _ := auth.FromContext(r.Context())
+	subject := ""
+	if principal != nil {
+		subject = principal.Subject
+	}
+	cloud.WriteError(w, http.StatusForbidden, fmt.Errorf("%s is not allowed to %s on %s in env %q", subject, action, provider, env))
+	return false
+}
+
+//authorizeProvider responds with 403 and returns false if the caller may not run action on provider in any environment.
+//It guards the provider calls made to find out the environment of what a request targets.
+func authorizeProvider(w http.ResponseWriter, r *http.Request, action, provider string) bool {
+
+	if allowedAnywhere(r, action, provider) {
+		return true
+	}
+	principal, _ := auth.FromContext(r.Context())
+	subject := ""
+	if principal != nil {
+		subject = principal.Subject
+	}
+	cloud.WriteError(w, http.StatusForbidden, fmt.Errorf("%s is not allowed to %s on %s", subject, action, provider))
+	return false
+}
+
+//authorizeInstances responds with 403 and returns false if the caller may not run action on the environment of every instance.
+func authorizeInstances(w http.ResponseWriter, r *http.Request, action, provider string, instances []cloud.Instance) bool {
+	for _, inst := range instances {
+		if !authorize(w, r, action, provider, instanceEnv(provider, inst)) {
+			return false
+		}
+	}
+	return true
+}
+
+//authorizeTargets describes the instances a delete request targets and authorizes the caller against their environment,
+//never against the environment of the request which the caller controls. It returns the environment of the targets.
+func authorizeTargets(w http.ResponseWriter, r *http.Request, p cloud.Provider, payload cloud.Request) (string, bool) {
+
+	if !authorizeProvider(w, r, auth.ActionDelete, p.Name()) {
+		return "", false
+	}
+	lookup := payload
+	if len(lookup.InstanceIDs) > 0 {
+		lookup.Instance, lookup.ChangeNum = "", ""
+	}
+	targets, err := p.Describe(r.Context(), lookup)
+	if err != nil {
+		writeProviderError(w, err)
+		return "", false
+	}
+	if len(targets) == 0 {
+		cloud.WriteError(w, http.StatusNotFound, errors.New("no instance matches the request"))
+		return "", false
+	}
+	found := make(map[string]bool, len(targets))
+	for _, inst := range targets {
+		found[inst.ID] = true
+	}
+	for _, id := range payload.InstanceIDs {
+		if !found[id] {
+			cloud.WriteError(w, http.StatusNotFound, fmt.Errorf("instance %s not found", id))
+			return "", false
+		}
+	}
+	env := instanceEnv(p.Name(), targets[0])
+	for _, inst := range targets[1:] {
+		if other := instanceEnv(p.Name(), inst); !strings.EqualFold(other, env) {
+			cloud.WriteError(w, http.StatusBadRequest, fmt.Errorf("instances of envs %q and %q can't be deleted by one request", env, other))
+			return "", false
+		}
+	}
+	return env, authorize(w, r, auth.ActionDelete, p.Name(), env)
+}
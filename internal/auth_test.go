@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/shakilbd009/go-cloud/auth"
+	"github.com/shakilbd009/go-cloud/cloud"
+	"github.com/shakilbd009/go-cloud/config"
+	"github.com/shakilbd009/go-cloud/inventory"
+)
+
+var testRoles = map[string][]auth.Rule{
+	"gcp-dev":    {{Actions: []string{auth.ActionRead, auth.ActionDelete}, Providers: []string{"gcp"}, Environments: []string{"dev"}}},
+	"aws-reader": {{Actions: []string{auth.ActionRead}, Providers: []string{"aws"}}},
+}
+
+func TestProviderHandlerAuthorizesBeforeDescribing(t *testing.T) {
+
+	tests := []struct {
+		name          string
+		method        string
+		roles         []string
+		env           string
+		wantStatus    int
+		wantDescribed bool
+	}{
+		{name: "read of another provider", method: http.MethodGet, roles: []string{"aws-reader"}, env: "dev", wantStatus: http.StatusForbidden},
+		{name: "read of an allowed env", method: http.MethodGet, roles: []string{"gcp-dev"}, env: "dev", wantStatus: http.StatusOK, wantDescribed: true},
+		{name: "read of another env", method: http.MethodGet, roles: []string{"gcp-dev"}, env: "prod", wantStatus: http.StatusForbidden, wantDescribed: true},
+		{name: "delete without the delete action", method: http.MethodDelete, roles: []string{"aws-reader"}, env: "dev", wantStatus: http.StatusForbidden},
+		{name: "delete in another env", method: http.MethodDelete, roles: []string{"gcp-dev"}, env: "prod", wantStatus: http.StatusForbidden, wantDescribed: true},
+		{name: "delete in an allowed env", method: http.MethodDelete, roles: []string{"gcp-dev"}, env: "dev", wantStatus: http.StatusAccepted, wantDescribed: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testServer(testRoles)
+			described := false
+			p := &fakeProvider{name: "gcp", describe: func(ctx context.Context, req cloud.Request) ([]cloud.Instance, error) {
+				described = true
+				return []cloud.Instance{{InstanceName: req.Instance, ID: "1", Environment: tt.env}}, nil
+			}}
+			w := serve(providerHandler(p), tt.method, "/gcp?instanceName=gcpbxwdabc01", "", tt.roles...)
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+			if described != tt.wantDescribed {
+				t.Errorf("described = %v, want %v", described, tt.wantDescribed)
+			}
+		})
+	}
+}
+
+func TestListsOnlyShowWhatTheCallerMayRead(t *testing.T) {
+
+	testServer(testRoles)
+	settings = config.Static{Config: &config.Config{
+		Providers: map[string]config.ProviderDefaults{"gcp": {}, "aws": {}},
+		Environments: map[string]config.Environment{
+			"dev":  {"web": {"gcp": {}, "aws": {}}},
+			"prod": {"web": {"gcp": {}, "aws": {}}},
+		},
+	}}
+	now := time.Now()
+	for i, r := range []inventory.Record{
+		{Provider: "gcp", Name: "gcp-dev", Tags: map[string]string{"env": "dev", "appcode": "abc"}},
+		{Provider: "gcp", Name: "gcp-prod", Tags: map[string]string{"env": "prod", "appcode": "abc"}},
+		{Provider: "aws", Name: "aws-prod", Tags: map[string]string{"env": "prod", "appcode": "abc"}},
+	} {
+		r.Created = now.Add(time.Duration(i) * time.Second)
+		if err := store.Put(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	listed := func(provider string) *fakeProvider {
+		return &fakeProvider{name: provider, list: func(ctx context.Context, filter cloud.Filter) ([]cloud.Instance, error) {
+			return []cloud.Instance{
+				{Provider: provider, InstanceName: provider + "-dev", Environment: "dev"},
+				{Provider: provider, InstanceName: provider + "-prod", Environment: "prod"},
+			}, nil
+		}}
+	}
+	providers = []cloud.Provider{listed("gcp"), listed("aws")}
+
+	tests := []struct {
+		name       string
+		handler    http.HandlerFunc
+		target     string
+		names      func([]byte) []string
+		roles      []string
+		wantStatus int
+		want       []string
+	}{
+		{name: "inventory without filters", handler: inventoryHandler, names: recordNames, target: "/inventory", roles: []string{"gcp-dev"},
+			wantStatus: http.StatusOK, want: []string{"gcp-dev"}},
+		{name: "inventory of a readable provider", handler: inventoryHandler, names: recordNames, target: "/inventory?provider=aws", roles: []string{"aws-reader"},
+			wantStatus: http.StatusOK, want: []string{"aws-prod"}},
+		{name: "inventory of a named env the caller can't read", handler: inventoryHandler, names: recordNames, target: "/inventory?provider=gcp&env=prod",
+			roles: []string{"gcp-dev"}, wantStatus: http.StatusForbidden},
+		{name: "sizes without filters", handler: sizesHandler, names: catalogNames, target: "/sizes", roles: []string{"gcp-dev", "aws-reader"},
+			wantStatus: http.StatusOK, want: []string{"aws-dev", "aws-prod", "gcp-dev"}},
+		{name: "sizes of a named env the caller can't read", handler: sizesHandler, names: catalogNames, target: "/sizes?provider=gcp&env=prod",
+			roles: []string{"gcp-dev"}, wantStatus: http.StatusForbidden},
+		{name: "instances without env", handler: instancesHandler, names: instanceNames, target: "/instances?appCode=abc", roles: []string{"gcp-dev"},
+			wantStatus: http.StatusOK, want: []string{"gcp-dev"}},
+		{name: "instances of a provider the caller can't read", handler: instancesHandler, names: instanceNames, target: "/instances?appCode=abc&provider=aws",
+			roles: []string{"gcp-dev"}, wantStatus: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(tt.handler, http.MethodGet, tt.target, "", tt.roles...)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+			if w.Code != http.StatusOK {
+				return
+			}
+			if got := tt.names(w.Body.Bytes()); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("listed %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+//catalogNames returns the sorted provider-env pairs of the size catalogs in body.
+func catalogNames(body []byte) []string {
+
+	catalogs := make([]sizeCatalog, 0)
+	json.Unmarshal(body, &catalogs)
+	names := make([]string, 0, len(catalogs))
+	for _, c := range catalogs {
+		names = append(names, c.Provider+"-"+c.Environment)
+	}
+	sort.Strings(names)
+	return names
+}
+
+//instanceNames returns the sorted names of the instances in body.
+func instanceNames(body []byte) []string {
+
+	resp := instanceList{}
+	json.Unmarshal(body, &resp)
+	names := make([]string, 0, len(resp.Instances))
+	for _, inst := range resp.Instances {
+		names = append(names, inst.InstanceName)
+	}
+	sort.Strings(names)
+	return names
+}
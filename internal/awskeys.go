@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/shakilbd009/go-cloud/auth"
+	"github.com/shakilbd009/go-cloud/aws"
+	"github.com/shakilbd009/go-cloud/cloud"
+	"github.com/shakilbd009/go-cloud/keys"
+)
+
+//keyPairRequest object creates an EC2 key pair, or imports PublicKey when it is set.
+type keyPairRequest struct {
+	Name        string `json:"name"`
+	Region      string `json:"region"`
+	Environment string `json:"env"`
+	PublicKey   string `json:"publicKey"`
+}
+
+//keyPairs is what /aws/keys manages EC2 key pairs through, i.e an *aws.Provider.
+type keyPairs interface {
+	Name() string
+	KeyPairs(ctx context.Context, region string) ([]aws.KeyPair, error)
+	KeyPair(ctx context.Context, region, name string) (aws.KeyPair, error)
+	CreateKeyPair(ctx context.Context, region, env, name string) (aws.KeyPair, error)
+	ImportKeyPair(ctx context.Context, region, env, name, publicKey string) (aws.KeyPair, error)
+	DeleteKeyPair(ctx context.Context, region, name string) error
+}
+
+//awsKeysHandler serves GET and POST /aws/keys and DELETE /aws/keys/{name}, the region is the default one unless passed.
+//Callers are authorized against the env tag of the key pairs, only key pairs they may read are listed.
+func awsKeysHandler(p keyPairs) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		defer r.Body.Close()
+		name := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, "/aws/keys"), "/")
+		region := r.URL.Query().Get("region")
+		switch {
+		case r.Method == http.MethodGet && name == "":
+			pairs, err := p.KeyPairs(r.Context(), region)
+			if err != nil {
+				writeProviderError(w, err)
+				return
+			}
+			visible := make([]aws.KeyPair, 0, len(pairs))
+			for _, pair := range pairs {
+				if allowed(r, auth.ActionRead, p.Name(), pair.Environment) {
+					visible = append(visible, pair)
+				}
+			}
+			cloud.WriteJSON(w, http.StatusOK, visible)
+		case r.Method == http.MethodPost && name == "":
+			req := keyPairRequest{}
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				cloud.WriteError(w, http.StatusBadRequest, err)
+				return
+			}
+			if !authorize(w, r, auth.ActionProvision, p.Name(), req.Environment) {
+				return
+			}
+			if err := keys.CheckName(req.Name); err != nil {
+				cloud.WriteError(w, http.StatusBadRequest, err)
+				return
+			}
+			if req.PublicKey != "" {
+				if err := keys.CheckPublicKey(req.PublicKey); err != nil {
+					cloud.WriteError(w, http.StatusBadRequest, err)
+					return
+				}
+			}
+			if region == "" {
+				region = req.Region
+			}
+			var (
+				pair aws.KeyPair
+				err  error
+			)
+			if req.PublicKey == "" {
+				pair, err = p.CreateKeyPair(r.Context(), region, req.Environment, req.Name)
+			} else {
+				pair, err = p.ImportKeyPair(r.Context(), region, req.Environment, req.Name, req.PublicKey)
+			}
+			if errors.Is(err, aws.ErrKeyPairExists) {
+				cloud.WriteError(w, http.StatusConflict, err)
+				return
+			}
+			if err != nil {
+				writeProviderError(w, err)
+				return
+			}
+			cloud.WriteJSON(w, http.StatusCreated, pair)
+		case r.Method == http.MethodDelete && name != "":
+			pair, err := p.KeyPair(r.Context(), region, name)
+			if errors.Is(err, aws.ErrKeyPairNotFound) {
+				cloud.WriteError(w, http.StatusNotFound, err)
+				return
+			}
+			if err != nil {
+				writeProviderError(w, err)
+				return
+			}
+			if !authorize(w, r, auth.ActionDelete, p.Name(), pair.Environment) {
+				return
+			}
+			if err := p.DeleteKeyPair(r.Context(), region, name); err != nil {
+				writeProviderError(w, err)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			cloud.WriteError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		}
+	}
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/shakilbd009/go-cloud/auth"
+	"github.com/shakilbd009/go-cloud/aws"
+	"github.com/shakilbd009/go-cloud/secrets"
+)
+
+//fakeKeyPairs keeps key pairs by name and records the calls made to it, err fails every call.
+type fakeKeyPairs struct {
+	pairs map[string]aws.KeyPair
+	calls []string
+	err   error
+}
+
+func (f *fakeKeyPairs) Name() string { return "aws" }
+
+func (f *fakeKeyPairs) KeyPairs(ctx context.Context, region string) ([]aws.KeyPair, error) {
+	f.calls = append(f.calls, "list "+region)
+	list := make([]aws.KeyPair, 0, len(f.pairs))
+	for _, pair := range f.pairs {
+		list = append(list, pair)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list, f.err
+}
+
+func (f *fakeKeyPairs) KeyPair(ctx context.Context, region, name string) (aws.KeyPair, error) {
+	f.calls = append(f.calls, "get "+region+" "+name)
+	if f.err != nil {
+		return aws.KeyPair{}, f.err
+	}
+	pair, ok := f.pairs[name]
+	if !ok {
+		return aws.KeyPair{}, fmt.Errorf("%w: %s", aws.ErrKeyPairNotFound, name)
+	}
+	return pair, nil
+}
+
+func (f *fakeKeyPairs) add(call, region, env, name string) (aws.KeyPair, error) {
+	f.calls = append(f.calls, call+" "+region+" "+env+" "+name)
+	if f.err != nil {
+		return aws.KeyPair{}, f.err
+	}
+	if _, ok := f.pairs[name]; ok {
+		return aws.KeyPair{}, fmt.Errorf("%w: %s", aws.ErrKeyPairExists, name)
+	}
+	f.pairs[name] = aws.KeyPair{Name: name, Region: region, Environment: env}
+	return f.pairs[name], nil
+}
+
+func (f *fakeKeyPairs) CreateKeyPair(ctx context.Context, region, env, name string) (aws.KeyPair, error) {
+	return f.add("create", region, env, name)
+}
+
+func (f *fakeKeyPairs) ImportKeyPair(ctx context.Context, region, env, name, publicKey string) (aws.KeyPair, error) {
+	return f.add("import", region, env, name)
+}
+
+func (f *fakeKeyPairs) DeleteKeyPair(ctx context.Context, region, name string) error {
+	f.calls = append(f.calls, "delete "+region+" "+name)
+	delete(f.pairs, name)
+	return f.err
+}
+
+var keyPairRoles = map[string][]auth.Rule{
+	"aws-dev":   {{Actions: []string{auth.ActionRead, auth.ActionProvision, auth.ActionDelete}, Providers: []string{"aws"}, Environments: []string{"dev"}}},
+	"aws-admin": {{Actions: []string{auth.ActionRead, auth.ActionProvision, auth.ActionDelete}, Providers: []string{"aws"}}},
+	"gcp-dev":   {{Actions: []string{auth.ActionRead, auth.ActionProvision, auth.ActionDelete}, Providers: []string{"gcp"}, Environments: []string{"dev"}}},
+}
+
+//testKeyPairs returns a fakeKeyPairs holding a key pair tagged dev, one tagged prod and an untagged one.
+func testKeyPairs() *fakeKeyPairs {
+	return &fakeKeyPairs{pairs: map[string]aws.KeyPair{
+		"dev-key":  {Name: "dev-key", Region: "us-east-1", Environment: "dev"},
+		"prod-key": {Name: "prod-key", Region: "us-east-1", Environment: "prod"},
+		"shared":   {Name: "shared", Region: "us-east-1"},
+	}}
+}
+
+func TestAWSKeysList(t *testing.T) {
+
+	testServer(keyPairRoles)
+	defer testServer(nil)
+	tests := []struct {
+		role       string
+		wantStatus int
+		want       []string
+	}{
+		{role: "aws-dev", wantStatus: http.StatusOK, want: []string{"dev-key"}},
+		{role: "aws-admin", wantStatus: http.StatusOK, want: []string{"dev-key", "prod-key", "shared"}},
+		{role: "gcp-dev", wantStatus: http.StatusOK, want: []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.role, func(t *testing.T) {
+			f := testKeyPairs()
+			w := serve(awsKeysHandler(f), http.MethodGet, "/aws/keys?region=eu-west-1", "", tt.role)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+			pairs := make([]aws.KeyPair, 0)
+			if err := json.NewDecoder(w.Body).Decode(&pairs); err != nil {
+				t.Fatal(err)
+			}
+			names := make([]string, 0, len(pairs))
+			for _, pair := range pairs {
+				names = append(names, pair.Name)
+			}
+			if !reflect.DeepEqual(names, tt.want) {
+				t.Errorf("listed %v, want %v", names, tt.want)
+			}
+			if want := []string{"list eu-west-1"}; !reflect.DeepEqual(f.calls, want) {
+				t.Errorf("calls = %v, want %v", f.calls, want)
+			}
+		})
+	}
+}
+
+func TestAWSKeysCreate(t *testing.T) {
+
+	_, public, err := secrets.GenerateSSHKey(1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testServer(keyPairRoles)
+	defer testServer(nil)
+	tests := []struct {
+		name       string
+		target     string
+		body       string
+		role       string
+		err        error
+		wantStatus int
+		wantCalls  []string
+	}{
+		{name: "create in an allowed env", target: "/aws/keys", body: `{"name":"deploy","env":"dev","region":"us-west-2"}`, role: "aws-dev",
+			wantStatus: http.StatusCreated, wantCalls: []string{"create us-west-2 dev deploy"}},
+		{name: "region of the query first", target: "/aws/keys?region=eu-west-1", body: `{"name":"deploy","env":"dev","region":"us-west-2"}`, role: "aws-dev",
+			wantStatus: http.StatusCreated, wantCalls: []string{"create eu-west-1 dev deploy"}},
+		{name: "import", target: "/aws/keys", body: fmt.Sprintf(`{"name":"deploy","env":"dev","publicKey":%q}`, public), role: "aws-dev",
+			wantStatus: http.StatusCreated, wantCalls: []string{"import  dev deploy"}},
+		{name: "create in another env", target: "/aws/keys", body: `{"name":"deploy","env":"prod"}`, role: "aws-dev", wantStatus: http.StatusForbidden},
+		{name: "untagged by an env limited role", target: "/aws/keys", body: `{"name":"deploy"}`, role: "aws-dev", wantStatus: http.StatusForbidden},
+		{name: "untagged", target: "/aws/keys", body: `{"name":"deploy"}`, role: "aws-admin",
+			wantStatus: http.StatusCreated, wantCalls: []string{"create   deploy"}},
+		{name: "another provider", target: "/aws/keys", body: `{"name":"deploy","env":"dev"}`, role: "gcp-dev", wantStatus: http.StatusForbidden},
+		{name: "invalid name", target: "/aws/keys", body: `{"name":"Deploy Key","env":"dev"}`, role: "aws-dev", wantStatus: http.StatusBadRequest},
+		{name: "invalid public key", target: "/aws/keys", body: `{"name":"deploy","env":"dev","publicKey":"ssh-rsa !!!"}`, role: "aws-dev",
+			wantStatus: http.StatusBadRequest},
+		{name: "invalid body", target: "/aws/keys", body: `{"name":`, role: "aws-dev", wantStatus: http.StatusBadRequest},
+		{name: "existing", target: "/aws/keys", body: `{"name":"dev-key","env":"dev"}`, role: "aws-dev",
+			wantStatus: http.StatusConflict, wantCalls: []string{"create  dev dev-key"}},
+		{name: "provider error", target: "/aws/keys", body: `{"name":"deploy","env":"dev"}`, role: "aws-dev", err: errors.New("throttled"),
+			wantStatus: http.StatusInternalServerError, wantCalls: []string{"create  dev deploy"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := testKeyPairs()
+			f.err = tt.err
+			w := serve(awsKeysHandler(f), http.MethodPost, tt.target, tt.body, tt.role)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+			if fmt.Sprint(f.calls) != fmt.Sprint(tt.wantCalls) {
+				t.Errorf("calls = %q, want %q", f.calls, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestAWSKeysDelete(t *testing.T) {
+
+	testServer(keyPairRoles)
+	defer testServer(nil)
+	tests := []struct {
+		name       string
+		role       string
+		err        error
+		wantStatus int
+		wantCalls  []string
+	}{
+		{name: "dev-key", role: "aws-dev", wantStatus: http.StatusNoContent, wantCalls: []string{"get us-east-1 dev-key", "delete us-east-1 dev-key"}},
+		{name: "prod-key", role: "aws-dev", wantStatus: http.StatusForbidden, wantCalls: []string{"get us-east-1 prod-key"}},
+		{name: "shared", role: "aws-dev", wantStatus: http.StatusForbidden, wantCalls: []string{"get us-east-1 shared"}},
+		{name: "shared", role: "aws-admin", wantStatus: http.StatusNoContent, wantCalls: []string{"get us-east-1 shared", "delete us-east-1 shared"}},
+		{name: "missing", role: "aws-admin", wantStatus: http.StatusNotFound, wantCalls: []string{"get us-east-1 missing"}},
+		{name: "dev-key", role: "aws-dev", err: errors.New("throttled"), wantStatus: http.StatusInternalServerError,
+			wantCalls: []string{"get us-east-1 dev-key"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name+" by "+tt.role, func(t *testing.T) {
+			f := testKeyPairs()
+			f.err = tt.err
+			w := serve(awsKeysHandler(f), http.MethodDelete, "/aws/keys/"+tt.name+"?region=us-east-1", "", tt.role)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+			if fmt.Sprint(f.calls) != fmt.Sprint(tt.wantCalls) {
+				t.Errorf("calls = %q, want %q", f.calls, tt.wantCalls)
+			}
+			_, existed := testKeyPairs().pairs[tt.name]
+			if _, kept := f.pairs[tt.name]; kept != (existed && tt.wantStatus != http.StatusNoContent) {
+				t.Errorf("key pair %s kept = %v after status %d", tt.name, kept, w.Code)
+			}
+		})
+	}
+}
+
+func TestAWSKeysMethodNotAllowed(t *testing.T) {
+
+	testServer(nil)
+	for _, req := range []struct{ method, target string }{
+		{http.MethodPut, "/aws/keys"},
+		{http.MethodDelete, "/aws/keys"},
+		{http.MethodPost, "/aws/keys/deploy"},
+	} {
+		if w := serve(awsKeysHandler(testKeyPairs()), req.method, req.target, "", "anyone"); w.Code != http.StatusMethodNotAllowed {
+			t.Errorf("%s %s status = %d, want %d", req.method, req.target, w.Code, http.StatusMethodNotAllowed)
+		}
+	}
+}
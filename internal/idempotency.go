@@ -0,0 +1,189 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shakilbd009/go-cloud/auth"
+	"github.com/shakilbd009/go-cloud/cloud"
+	"github.com/shakilbd009/go-cloud/inventory"
+	"github.com/shakilbd009/go-cloud/jobs"
+)
+
+//idempotencyEntry object remembers the job a provisioning request was submitted as.
+type idempotencyEntry struct {
+	jobID       string
+	fingerprint string
+	created     time.Time
+}
+
+var idempotent = struct {
+	sync.Mutex
+	keys map[string]idempotencyEntry
+}{keys: make(map[string]idempotencyEntry)}
+
+//idempotencyKey returns the key a provisioning request is deduplicated by: its Idempotency-Key header,
+//else its requestNum along with the fingerprint fp of the request, since one change can hold several different requests.
+//Keys are scoped to the caller, so two callers can't see or collide with each other's requests.
+func idempotencyKey(r *http.Request, payload cloud.Request, fp string) string {
+
+	key := r.Header.Get("Idempotency-Key")
+	if key == "" && payload.ChangeNum != "" {
+		key = "requestNum:" + payload.ChangeNum + ":" + fp
+	}
+	if key == "" {
+		return ""
+	}
+	caller := "anonymous"
+	if principal, ok := auth.FromContext(r.Context()); ok {
+		caller = principal.Subject
+	}
+	return caller + "/" + payload.Provider + "/" + key
+}
+
+//expireIdempotencyKeys forgets the keys older than idempotencyTTL, idempotent must be locked.
+func expireIdempotencyKeys(now time.Time) {
+	for key, entry := range idempotent.keys {
+		if now.Sub(entry.created) > idempotencyTTL {
+			delete(idempotent.keys, key)
+		}
+	}
+}
+
+//fingerprint returns a hash of payload, so a key reused for a different request can be told apart.
+func fingerprint(payload cloud.Request) string {
+	data, _ := json.Marshal(payload)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+//recordedNames returns the names of the instances the inventory holds for the change number of payload,
+//so a request retried after its job was forgotten resumes with the names it already used.
+func recordedNames(payload cloud.Request) []string {
+
+	if payload.ChangeNum == "" {
+		return nil
+	}
+	records, err := store.List(inventory.Filter{
+		Provider:    payload.Provider,
+		ChangeNum:   payload.ChangeNum,
+		AppCode:     payload.AppCode,
+		Environment: payload.Environment,
+	})
+	if err != nil {
+		log.Printf("could not look up %s in inventory: %v\n", payload.ChangeNum, err)
+		return nil
+	}
+	names := make([]string, 0, len(records))
+	for _, record := range records {
+		//a change can hold requests for other tiers or operating systems, their instances are not this request's.
+		if strings.EqualFold(record.Tags["tier"], payload.Tier) && strings.EqualFold(record.Tags["os"], payload.Osname) {
+			names = append(names, record.Name)
+		}
+	}
+	return names
+}
+
+//jobNames returns the instance names a job created or tried to create.
+func jobNames(job jobs.Job) []string {
+
+	names := make([]string, 0, len(job.Instances))
+	seen := make(map[string]bool)
+	for _, inst := range job.Instances {
+		if inst.InstanceName != "" && !seen[inst.InstanceName] {
+			seen[inst.InstanceName] = true
+			names = append(names, inst.InstanceName)
+		}
+	}
+	return names
+}
+
+//submitProvision queues the provisioning of payload once per idempotency key.
+//A retry of a queued, running or succeeded request returns the original job, a retry of a failed or forgotten one resumes it.
+func submitProvision(w http.ResponseWriter, r *http.Request, p cloud.Provider, payload cloud.Request) {
+
+	fp := fingerprint(payload)
+	key := idempotencyKey(r, payload, fp)
+	if key == "" {
+		fn, saga := provisionJob(p, payload)
+		if job, ok := submitJob(w, p.Name(), payload.Environment, "provision", fn); ok {
+			keepSaga(job.ID, saga)
+		}
+		return
+	}
+	previous, job, reserved, err := reserveIdempotencyKey(key, fp)
+	if err != nil {
+		cloud.WriteError(w, http.StatusConflict, err)
+		return
+	}
+	if !reserved {
+		status := http.StatusOK
+		if job.State == jobs.Queued || job.State == jobs.Running {
+			status = http.StatusAccepted
+		}
+		w.Header().Set("Location", "/jobs/"+job.ID)
+		cloud.WriteJSON(w, status, job)
+		return
+	}
+	if job.ID != "" {
+		payload.Names = jobNames(job)
+	}
+	if len(payload.Names) == 0 {
+		payload.Names = recordedNames(payload)
+	}
+	payload.Resume = previous.jobID != "" || len(payload.Names) > 0
+	fn, saga := provisionJob(p, payload)
+	job, submitted := submitJob(w, p.Name(), payload.Environment, "provision", fn)
+	if submitted {
+		keepSaga(job.ID, saga)
+	}
+	commitIdempotencyKey(key, fp, previous, job.ID, submitted)
+}
+
+//reserveIdempotencyKey returns the job key points at while it is queued, running or succeeded.
+//Otherwise it reserves key for a new job and returns the entry and failed job it pointed at, if any.
+//It fails while another request holds the reservation or if key was used for a different request,
+//which only a reused Idempotency-Key header can be since requestNum keys hold the fingerprint.
+func reserveIdempotencyKey(key, fp string) (previous idempotencyEntry, job jobs.Job, reserved bool, err error) {
+
+	now := time.Now()
+	idempotent.Lock()
+	defer idempotent.Unlock()
+	expireIdempotencyKeys(now)
+	previous, found := idempotent.keys[key]
+	switch {
+	case found && previous.jobID == "":
+		return previous, jobs.Job{}, false, fmt.Errorf("a request with idempotency key %s is already being submitted", key)
+	case found && previous.fingerprint != fp:
+		return previous, jobs.Job{}, false, fmt.Errorf("idempotency key %s was already used for a different request", key)
+	}
+	job, ok := jobManager.Get(previous.jobID)
+	if ok && job.State != jobs.Failed {
+		return previous, job, false, nil
+	}
+	idempotent.keys[key] = idempotencyEntry{fingerprint: fp, created: now}
+	return previous, job, true, nil
+}
+
+//commitIdempotencyKey ends the reservation of key, pointing it at jobID when the job was submitted,
+//else restoring the entry it held before or dropping it.
+func commitIdempotencyKey(key, fp string, previous idempotencyEntry, jobID string, submitted bool) {
+
+	idempotent.Lock()
+	defer idempotent.Unlock()
+	switch {
+	case submitted:
+		idempotent.keys[key] = idempotencyEntry{jobID: jobID, fingerprint: fp, created: time.Now()}
+	case previous.jobID != "":
+		idempotent.keys[key] = previous
+	default:
+		delete(idempotent.keys, key)
+	}
+}
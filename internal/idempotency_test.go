@@ -0,0 +1,266 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/shakilbd009/go-cloud/auth"
+	"github.com/shakilbd009/go-cloud/cloud"
+	"github.com/shakilbd009/go-cloud/inventory"
+	"github.com/shakilbd009/go-cloud/jobs"
+)
+
+//recordingProvider is a fake provider keeping the requests it provisions, each answered by result.
+type recordingProvider struct {
+	fakeProvider
+	mu       sync.Mutex
+	requests []cloud.Request
+	result   func(ctx context.Context, req cloud.Request) ([]cloud.Instance, error)
+}
+
+func newRecordingProvider(result func(ctx context.Context, req cloud.Request) ([]cloud.Instance, error)) *recordingProvider {
+
+	p := &recordingProvider{result: result}
+	p.name = "gcp"
+	p.provision = func(ctx context.Context, req cloud.Request) ([]cloud.Instance, error) {
+		p.mu.Lock()
+		p.requests = append(p.requests, req)
+		p.mu.Unlock()
+		return p.result(ctx, req)
+	}
+	return p
+}
+
+func (p *recordingProvider) provisioned() []cloud.Request {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]cloud.Request{}, p.requests...)
+}
+
+//submit posts payload to submitProvision as subject, with an Idempotency-Key header when key is set.
+func submit(p cloud.Provider, payload cloud.Request, key, subject string) *httptest.ResponseRecorder {
+
+	r := httptest.NewRequest(http.MethodPost, "/gcp", nil)
+	if key != "" {
+		r.Header.Set("Idempotency-Key", key)
+	}
+	r = r.WithContext(auth.WithPrincipal(r.Context(), &auth.Principal{Subject: subject}))
+	w := httptest.NewRecorder()
+	payload.Provider = p.Name()
+	submitProvision(w, r, p, payload)
+	return w
+}
+
+//jobOf decodes the job in the body of w.
+func jobOf(t *testing.T, w *httptest.ResponseRecorder) jobs.Job {
+	job := jobs.Job{}
+	if err := json.Unmarshal(w.Body.Bytes(), &job); err != nil {
+		t.Fatalf("could not decode job from %s: %v", w.Body, err)
+	}
+	return job
+}
+
+//waitJob polls the job manager until job id is finished.
+func waitJob(t *testing.T, id string) jobs.Job {
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		job, ok := jobManager.Get(id)
+		if ok && (job.State == jobs.Succeeded || job.State == jobs.Failed) {
+			return job
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("job %s did not finish: %+v", id, job)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func resetIdempotency() {
+	idempotent.Lock()
+	defer idempotent.Unlock()
+	idempotent.keys = make(map[string]idempotencyEntry)
+}
+
+var provisionRequest = cloud.Request{Environment: "dev", Tier: "web", Osname: "redhat", AppCode: "abc", Count: 3, ChangeNum: "CHG1"}
+
+func TestSubmitProvisionReturnsTheOriginalJob(t *testing.T) {
+
+	tests := []struct {
+		name       string
+		key        string
+		retry      func(cloud.Request) cloud.Request
+		subject    string
+		wantStatus int
+		wantSame   bool
+	}{
+		{name: "same header key", key: "k1", wantStatus: http.StatusOK, wantSame: true},
+		{name: "same change number", wantStatus: http.StatusOK, wantSame: true},
+		{name: "same header key for a different request", key: "k1", retry: func(r cloud.Request) cloud.Request { r.Count = 5; return r },
+			wantStatus: http.StatusConflict},
+		{name: "same change number for a different request", retry: func(r cloud.Request) cloud.Request { r.Tier = "app"; return r },
+			wantStatus: http.StatusAccepted},
+		{name: "same key of another caller", key: "k1", subject: "mallory", wantStatus: http.StatusAccepted},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testServer(nil)
+			resetIdempotency()
+			p := newRecordingProvider(func(ctx context.Context, req cloud.Request) ([]cloud.Instance, error) { return nil, nil })
+			first := submit(p, provisionRequest, tt.key, "alice")
+			if first.Code != http.StatusAccepted {
+				t.Fatalf("first status = %d, want %d: %s", first.Code, http.StatusAccepted, first.Body)
+			}
+			original := waitJob(t, jobOf(t, first).ID)
+			retry := provisionRequest
+			if tt.retry != nil {
+				retry = tt.retry(retry)
+			}
+			subject := tt.subject
+			if subject == "" {
+				subject = "alice"
+			}
+			second := submit(p, retry, tt.key, subject)
+			if second.Code != tt.wantStatus {
+				t.Fatalf("retry status = %d, want %d: %s", second.Code, tt.wantStatus, second.Body)
+			}
+			if second.Code == http.StatusConflict {
+				return
+			}
+			if same := jobOf(t, second).ID == original.ID; same != tt.wantSame {
+				t.Errorf("retry returned the original job = %v, want %v", same, tt.wantSame)
+			}
+		})
+	}
+}
+
+func TestSubmitProvisionWhileRunning(t *testing.T) {
+
+	testServer(nil)
+	resetIdempotency()
+	release := make(chan struct{})
+	p := newRecordingProvider(func(ctx context.Context, req cloud.Request) ([]cloud.Instance, error) {
+		<-release
+		return nil, nil
+	})
+	const retries = 8
+	var wg sync.WaitGroup
+	codes := make(chan int, retries)
+	ids := make(chan string, retries)
+	for i := 0; i < retries; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w := submit(p, provisionRequest, "k1", "alice")
+			codes <- w.Code
+			if w.Code == http.StatusAccepted {
+				ids <- jobOf(t, w).ID
+			}
+		}()
+	}
+	wg.Wait()
+	close(codes)
+	close(ids)
+	for code := range codes {
+		if code != http.StatusAccepted && code != http.StatusConflict {
+			t.Errorf("concurrent submit status = %d, want 202 or 409", code)
+		}
+	}
+	seen := make(map[string]bool)
+	for id := range ids {
+		seen[id] = true
+	}
+	if len(seen) != 1 {
+		t.Errorf("concurrent submits created %d jobs, want 1", len(seen))
+	}
+	close(release)
+	for id := range seen {
+		waitJob(t, id)
+	}
+	if got := len(p.provisioned()); got != 1 {
+		t.Errorf("provisioned %d times, want once", got)
+	}
+}
+
+func TestSubmitProvisionResumes(t *testing.T) {
+
+	//failOnce creates two of three instances the first time, reporting them as the providers do, and succeeds after.
+	failOnce := func() func(ctx context.Context, req cloud.Request) ([]cloud.Instance, error) {
+		failed := false
+		return func(ctx context.Context, req cloud.Request) ([]cloud.Instance, error) {
+			if failed {
+				return nil, nil
+			}
+			failed = true
+			instances := []cloud.Instance{{InstanceName: "gcpbxwdabc01"}, {InstanceName: "gcpbxwdabc02"}, {InstanceName: "gcpbxwdabc03", Error: "quota"}}
+			for _, inst := range instances {
+				cloud.ReportProgress(ctx, inst)
+			}
+			return instances, errors.New("some instances failed")
+		}
+	}
+	tests := []struct {
+		name string
+		//restart forgets the jobs and keys of the server between the attempts.
+		restart   bool
+		expire    bool
+		records   []inventory.Record
+		wantNames []string
+	}{
+		{name: "failed job", wantNames: []string{"gcpbxwdabc01", "gcpbxwdabc02", "gcpbxwdabc03"}},
+		{name: "after a restart", restart: true, records: []inventory.Record{
+			{Provider: "gcp", Name: "gcpbxwdabc01", ChangeNum: "CHG1", Tags: map[string]string{"appcode": "abc", "env": "dev", "tier": "web", "os": "redhat"}},
+			{Provider: "gcp", Name: "gcpbxwdabc02", ChangeNum: "CHG1", Tags: map[string]string{"appcode": "abc", "env": "dev", "tier": "web", "os": "redhat"}},
+			{Provider: "gcp", Name: "gcpbxwdabc07", ChangeNum: "CHG1", Tags: map[string]string{"appcode": "abc", "env": "dev", "tier": "app", "os": "redhat"}},
+			{Provider: "gcp", Name: "gcpbxwdabc08", ChangeNum: "CHG2", Tags: map[string]string{"appcode": "abc", "env": "dev", "tier": "web", "os": "redhat"}},
+		}, wantNames: []string{"gcpbxwdabc01", "gcpbxwdabc02"}},
+		{name: "after the key expired", expire: true, wantNames: []string{"gcpbxwdabc01", "gcpbxwdabc02"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testServer(nil)
+			resetIdempotency()
+			p := newRecordingProvider(failOnce())
+			first := submit(p, provisionRequest, "", "alice")
+			if job := waitJob(t, jobOf(t, first).ID); job.State != jobs.Failed {
+				t.Fatalf("first job = %s, want failed", job.State)
+			}
+			switch {
+			case tt.restart:
+				testServer(nil)
+				resetIdempotency()
+				for i, r := range tt.records {
+					r.Created = time.Now().Add(time.Duration(i) * time.Second)
+					store.Put(r)
+				}
+			case tt.expire:
+				idempotent.Lock()
+				for key, entry := range idempotent.keys {
+					entry.created = entry.created.Add(-idempotencyTTL - time.Minute)
+					idempotent.keys[key] = entry
+				}
+				idempotent.Unlock()
+			}
+			second := submit(p, provisionRequest, "", "alice")
+			if second.Code != http.StatusAccepted {
+				t.Fatalf("retry status = %d, want %d: %s", second.Code, http.StatusAccepted, second.Body)
+			}
+			waitJob(t, jobOf(t, second).ID)
+			requests := p.provisioned()
+			retried := requests[len(requests)-1]
+			if !retried.Resume {
+				t.Error("retry is not resumed")
+			}
+			if !reflect.DeepEqual(retried.Names, tt.wantNames) {
+				t.Errorf("retry names = %v, want %v", retried.Names, tt.wantNames)
+			}
+		})
+	}
+}
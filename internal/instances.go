@@ -0,0 +1,85 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+
+	"github.com/shakilbd009/go-cloud/auth"
+	"github.com/shakilbd009/go-cloud/cloud"
+)
+
+//providers are the providers GET /instances lists across.
+var providers []cloud.Provider
+
+//instanceList object is the unified answer of GET /instances.
+type instanceList struct {
+	Instances []cloud.Instance  `json:"instances"`
+	Errors    map[string]string `json:"errors,omitempty"`
+}
+
+//instancesHandler serves GET /instances?provider&appCode&env&requestNum across every provider,
+//listing only the instances the caller may read.
+func instancesHandler(w http.ResponseWriter, r *http.Request) {
+
+	if r.Method != http.MethodGet {
+		cloud.WriteError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return
+	}
+	q := r.URL.Query()
+	filter := cloud.Filter{
+		Environment: q.Get("env"),
+		AppCode:     q.Get("appCode"),
+		ChangeNum:   q.Get("requestNum"),
+	}
+	if filter == (cloud.Filter{}) {
+		cloud.WriteError(w, http.StatusBadRequest, errors.New("at least one of appCode, env or requestNum is required"))
+		return
+	}
+	name := q.Get("provider")
+	selected := make([]cloud.Provider, 0, len(providers))
+	for _, p := range providers {
+		switch {
+		case name != "" && name != p.Name():
+			continue
+		case name != "":
+			//a provider asked for by name is refused rather than silently left out.
+			if !authorizeProvider(w, r, auth.ActionRead, p.Name()) {
+				return
+			}
+			if filter.Environment != "" && !authorize(w, r, auth.ActionRead, p.Name(), filter.Environment) {
+				return
+			}
+		case !allowedAnywhere(r, auth.ActionRead, p.Name()):
+			continue
+		}
+		selected = append(selected, p)
+	}
+	var (
+		mu   sync.Mutex
+		wg   sync.WaitGroup
+		resp = instanceList{Instances: make([]cloud.Instance, 0), Errors: make(map[string]string)}
+	)
+	for _, p := range selected {
+		wg.Add(1)
+		go func(p cloud.Provider) {
+			defer wg.Done()
+			found, err := p.List(r.Context(), filter)
+			visible := make([]cloud.Instance, 0, len(found))
+			for _, inst := range found {
+				if allowed(r, auth.ActionRead, p.Name(), instanceEnv(p.Name(), inst)) {
+					visible = append(visible, inst)
+				}
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				resp.Errors[p.Name()] = err.Error()
+				return
+			}
+			resp.Instances = append(resp.Instances, visible...)
+		}(p)
+	}
+	wg.Wait()
+	cloud.WriteJSON(w, http.StatusOK, resp)
+}
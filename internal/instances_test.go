@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/shakilbd009/go-cloud/cloud"
+)
+
+func TestInstancesHandler(t *testing.T) {
+
+	testServer(nil)
+	var (
+		mu      sync.Mutex
+		filters = make(map[string]cloud.Filter)
+	)
+	listed := func(name string, found []cloud.Instance, err error) *fakeProvider {
+		return &fakeProvider{name: name, list: func(ctx context.Context, filter cloud.Filter) ([]cloud.Instance, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			filters[name] = filter
+			return found, err
+		}}
+	}
+	providers = []cloud.Provider{
+		listed("aws", []cloud.Instance{{Provider: "aws", InstanceName: "aws-1"}, {Provider: "aws", InstanceName: "aws-2"}}, nil),
+		listed("gcp", nil, errors.New("quota exceeded")),
+		listed("azure", []cloud.Instance{{Provider: "azure", InstanceName: "azure-1"}}, nil),
+	}
+	defer func() { providers = nil }()
+	tests := []struct {
+		name       string
+		target     string
+		wantStatus int
+		wantFilter cloud.Filter
+		wantListed []string
+		want       []string
+		wantErrors map[string]string
+	}{
+		{name: "every provider", target: "/instances?appCode=abc&env=dev&requestNum=CHG1", wantStatus: http.StatusOK,
+			wantFilter: cloud.Filter{AppCode: "abc", Environment: "dev", ChangeNum: "CHG1"}, wantListed: []string{"aws", "azure", "gcp"},
+			want: []string{"aws-1", "aws-2", "azure-1"}, wantErrors: map[string]string{"gcp": "quota exceeded"}},
+		{name: "one provider", target: "/instances?provider=azure&requestNum=CHG1", wantStatus: http.StatusOK,
+			wantFilter: cloud.Filter{ChangeNum: "CHG1"}, wantListed: []string{"azure"}, want: []string{"azure-1"}},
+		{name: "unknown provider", target: "/instances?provider=oci&env=dev", wantStatus: http.StatusOK, wantListed: []string{}, want: []string{}},
+		{name: "no filter", target: "/instances?provider=aws", wantStatus: http.StatusBadRequest, wantListed: []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filters = make(map[string]cloud.Filter)
+			w := serve(instancesHandler, http.MethodGet, tt.target, "")
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+			listedBy := make([]string, 0, len(filters))
+			for name, filter := range filters {
+				listedBy = append(listedBy, name)
+				if filter != tt.wantFilter {
+					t.Errorf("%s listed with %+v, want %+v", name, filter, tt.wantFilter)
+				}
+			}
+			sort.Strings(listedBy)
+			if !reflect.DeepEqual(listedBy, tt.wantListed) {
+				t.Errorf("listed by %v, want %v", listedBy, tt.wantListed)
+			}
+			if w.Code != http.StatusOK {
+				return
+			}
+			if got := instanceNames(w.Body.Bytes()); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("instances = %v, want %v", got, tt.want)
+			}
+			resp := instanceList{}
+			json.Unmarshal(w.Body.Bytes(), &resp)
+			if len(resp.Errors) != len(tt.wantErrors) || (len(tt.wantErrors) > 0 && !reflect.DeepEqual(resp.Errors, tt.wantErrors)) {
+				t.Errorf("errors = %v, want %v", resp.Errors, tt.wantErrors)
+			}
+		})
+	}
+	if w := serve(instancesHandler, http.MethodPost, "/instances?env=dev", ""); w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST status = %d, want %d", w.Code, http.StatusMethodNotAllowed)
+	}
+}
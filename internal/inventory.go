@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/shakilbd009/go-cloud/auth"
+	"github.com/shakilbd009/go-cloud/cloud"
+	"github.com/shakilbd009/go-cloud/inventory"
+)
+
+//withInventory records every successfully created instance reported on ctx.
+func withInventory(ctx context.Context, req cloud.Request) context.Context {
+	return cloud.WithProgress(ctx, func(inst cloud.Instance) {
+		if inst.Error != "" {
+			return
+		}
+		record := inventory.Record{
+			Provider: req.Provider,
+			Name:     inst.InstanceName,
+			ID:       inst.ID,
+			Zone:     inst.Zone,
+			Tags: map[string]string{
+				"appcode": req.AppCode,
+				"env":     req.Environment,
+				"os":      req.Osname,
+				"tier":    req.Tier,
+				"change":  req.ChangeNum,
+			},
+			ChangeNum: req.ChangeNum,
+			Created:   time.Now().UTC(),
+		}
+		if len(inst.PrivateIPs) > 0 {
+			record.IPs = inst.PrivateIPs
+		} else if inst.NetworkInterfaces != "" {
+			record.IPs = []string{inst.NetworkInterfaces}
+		}
+		if err := store.Put(record); err != nil {
+			log.Printf("could not record %s in inventory: %v\n", inst.InstanceName, err)
+		}
+	})
+}
+
+//forgetInstances removes deleted instances from the inventory.
+func forgetInstances(provider string, instances []cloud.Instance) {
+	for _, inst := range instances {
+		if inst.Error != "" {
+			continue
+		}
+		key := inventory.Record{Provider: provider, Name: inst.InstanceName, ID: inst.ID}.Key()
+		if err := store.Delete(key); err != nil {
+			log.Printf("could not remove %s from inventory: %v\n", key, err)
+		}
+	}
+}
+
+//instanceEnv returns the environment of inst from its provider tags, or from its inventory record when it isn't tagged.
+func instanceEnv(provider string, inst cloud.Instance) string {
+
+	if inst.Environment != "" || inst.InstanceName == "" {
+		return inst.Environment
+	}
+	records, err := store.List(inventory.Filter{Provider: provider, Name: inst.InstanceName})
+	if err != nil {
+		log.Printf("could not look up %s in inventory: %v\n", inst.InstanceName, err)
+		return ""
+	}
+	for _, record := range records {
+		if inst.ID == "" || record.ID == "" || record.ID == inst.ID {
+			return record.Tags["env"]
+		}
+	}
+	return ""
+}
+
+//inventoryHandler serves GET /inventory filtered by query parameters, listing only the records the caller may read.
+func inventoryHandler(w http.ResponseWriter, r *http.Request) {
+
+	if r.Method != http.MethodGet {
+		cloud.WriteError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return
+	}
+	q := r.URL.Query()
+	if provider, env := q.Get("provider"), q.Get("env"); provider != "" && env != "" && !authorize(w, r, auth.ActionRead, provider, env) {
+		return
+	}
+	records, err := store.List(inventory.Filter{
+		Provider:    q.Get("provider"),
+		Name:        q.Get("name"),
+		Zone:        q.Get("zone"),
+		ChangeNum:   q.Get("requestNum"),
+		AppCode:     q.Get("appCode"),
+		Environment: q.Get("env"),
+	})
+	if err != nil {
+		cloud.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	visible := make([]inventory.Record, 0, len(records))
+	for _, record := range records {
+		if allowed(r, auth.ActionRead, record.Provider, record.Tags["env"]) {
+			visible = append(visible, record)
+		}
+	}
+	cloud.WriteJSON(w, http.StatusOK, visible)
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/shakilbd009/go-cloud/cloud"
+	"github.com/shakilbd009/go-cloud/inventory"
+)
+
+func TestInventoryHandler(t *testing.T) {
+
+	testServer(nil)
+	now := time.Now().UTC()
+	for i, r := range []inventory.Record{
+		{Provider: "aws", Name: "awsbxwdabc01", ID: "i-1", Zone: "us-east-2a", ChangeNum: "CHG1", Tags: map[string]string{"appcode": "abc", "env": "base"}},
+		{Provider: "gcp", Name: "gcpbxwdabc01", Zone: "us-east1-c", ChangeNum: "CHG1", Tags: map[string]string{"appcode": "abc", "env": "base"}},
+		{Provider: "gcp", Name: "gcppxepxyz01", Zone: "us-east1-b", ChangeNum: "CHG2", Tags: map[string]string{"appcode": "xyz", "env": "prod"}},
+	} {
+		r.Created = now.Add(time.Duration(i) * time.Second)
+		if err := store.Put(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tests := []struct {
+		name       string
+		method     string
+		target     string
+		wantStatus int
+		want       []string
+	}{
+		{name: "everything", target: "/inventory", wantStatus: http.StatusOK, want: []string{"awsbxwdabc01", "gcpbxwdabc01", "gcppxepxyz01"}},
+		{name: "what a change built", target: "/inventory?requestNum=CHG1", wantStatus: http.StatusOK, want: []string{"awsbxwdabc01", "gcpbxwdabc01"}},
+		{name: "provider and app code", target: "/inventory?provider=gcp&appCode=abc", wantStatus: http.StatusOK, want: []string{"gcpbxwdabc01"}},
+		{name: "env", target: "/inventory?env=prod", wantStatus: http.StatusOK, want: []string{"gcppxepxyz01"}},
+		{name: "zone", target: "/inventory?zone=us-east-2a", wantStatus: http.StatusOK, want: []string{"awsbxwdabc01"}},
+		{name: "name", target: "/inventory?name=gcppxepxyz01", wantStatus: http.StatusOK, want: []string{"gcppxepxyz01"}},
+		{name: "nothing matches", target: "/inventory?requestNum=CHG3", wantStatus: http.StatusOK, want: []string{}},
+		{name: "method not allowed", method: http.MethodPost, target: "/inventory", wantStatus: http.StatusMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			method := tt.method
+			if method == "" {
+				method = http.MethodGet
+			}
+			w := serve(inventoryHandler, method, tt.target, "")
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+			if w.Code != http.StatusOK {
+				return
+			}
+			if got := recordNames(w.Body.Bytes()); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("listed %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInventoryRecordsAndForgetsInstances(t *testing.T) {
+
+	testServer(nil)
+	req := cloud.Request{Provider: "azure", Environment: "dev", Tier: "web", Osname: "redhat", AppCode: "abc", ChangeNum: "CHG9"}
+	ctx := withInventory(context.Background(), req)
+	cloud.ReportProgress(ctx, cloud.Instance{InstanceName: "azbxwdabc01", ID: "/vm/1", PrivateIPs: []string{"10.0.0.4"}})
+	cloud.ReportProgress(ctx, cloud.Instance{InstanceName: "azbxwdabc02", Error: "quota exceeded"})
+	records, err := store.List(inventory.Filter{ChangeNum: "CHG9"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 {
+		t.Fatalf("recorded %+v, want only the instance created without error", records)
+	}
+	want := map[string]string{"appcode": "abc", "env": "dev", "os": "redhat", "tier": "web", "change": "CHG9"}
+	if r := records[0]; r.Name != "azbxwdabc01" || r.ID != "/vm/1" || !reflect.DeepEqual(r.IPs, []string{"10.0.0.4"}) || !reflect.DeepEqual(r.Tags, want) {
+		t.Errorf("recorded %+v", r)
+	}
+
+	forgetInstances("azure", []cloud.Instance{{InstanceName: "azbxwdabc01", ID: "/vm/1", Error: "could not delete"}})
+	if records, _ := store.List(inventory.Filter{ChangeNum: "CHG9"}); len(records) != 1 {
+		t.Errorf("an instance that failed to delete was forgotten")
+	}
+	forgetInstances("azure", []cloud.Instance{{InstanceName: "azbxwdabc01", ID: "/vm/1"}})
+	if records, _ := store.List(inventory.Filter{ChangeNum: "CHG9"}); len(records) != 0 {
+		t.Errorf("inventory after delete = %+v, want nothing", records)
+	}
+}
+
+//recordNames returns the sorted names of the inventory records in body.
+func recordNames(body []byte) []string {
+
+	records := make([]inventory.Record, 0)
+	json.Unmarshal(body, &records)
+	names := make([]string, 0, len(records))
+	for _, r := range records {
+		names = append(names, r.Name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/shakilbd009/go-cloud/auth"
+	"github.com/shakilbd009/go-cloud/cloud"
+	"github.com/shakilbd009/go-cloud/keys"
+	"github.com/shakilbd009/go-cloud/secrets"
+	"github.com/shakilbd009/go-cloud/validate"
+)
+
+//keyRequest object registers a public key, or generates a key pair when PublicKey is empty.
+type keyRequest struct {
+	Name        string `json:"name"`
+	Team        string `json:"team"`
+	Environment string `json:"env"`
+	PublicKey   string `json:"publicKey"`
+}
+
+//keysScope is the provider the key registry is authorized as, the environment being the one of each key.
+//Keys without an environment can be used anywhere, so only roles not limited to environments may manage them.
+const keysScope = "keys"
+
+//resolveSSHKey fills the public key and private key reference of the registry key named by payload.
+func resolveSSHKey(payload *cloud.Request) validate.Errors {
+
+	if payload.SSHKey == "" {
+		return nil
+	}
+	k, err := registry.Get(payload.SSHKey)
+	if err != nil {
+		return validate.Errors{{Field: "sshKey", Code: validate.CodeNotFound, Message: err.Error()}}
+	}
+	if k.Environment != "" && !strings.EqualFold(k.Environment, payload.Environment) {
+		return validate.Errors{{Field: "sshKey", Code: validate.CodeInvalid, Message: fmt.Sprintf("ssh key %s can only be used in env %s", k.Name, k.Environment)}}
+	}
+	payload.SSHPublicKey, payload.SSHKeyRef = k.PublicKey, k.PrivateKeyRef
+	return nil
+}
+
+//keysHandler serves GET and POST /keys and DELETE /keys/{name}.
+func keysHandler(w http.ResponseWriter, r *http.Request) {
+
+	defer r.Body.Close()
+	name := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, "/keys"), "/")
+	switch {
+	case r.Method == http.MethodGet && name == "":
+		list := make([]keys.Key, 0)
+		for _, k := range registry.List(r.URL.Query().Get("team")) {
+			if allowed(r, auth.ActionRead, keysScope, k.Environment) {
+				list = append(list, k)
+			}
+		}
+		cloud.WriteJSON(w, http.StatusOK, list)
+	case r.Method == http.MethodGet:
+		k, err := registry.Get(name)
+		if err != nil {
+			cloud.WriteError(w, http.StatusNotFound, err)
+			return
+		}
+		if !authorize(w, r, auth.ActionRead, keysScope, k.Environment) {
+			return
+		}
+		cloud.WriteJSON(w, http.StatusOK, k)
+	case r.Method == http.MethodPost && name == "":
+		addKey(w, r)
+	case r.Method == http.MethodDelete && name != "":
+		k, err := registry.Get(name)
+		if err != nil {
+			cloud.WriteError(w, http.StatusNotFound, err)
+			return
+		}
+		if !authorize(w, r, auth.ActionDelete, keysScope, k.Environment) {
+			return
+		}
+		if err := registry.Delete(name); err != nil {
+			cloud.WriteError(w, http.StatusNotFound, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		cloud.WriteError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+	}
+}
+
+//addKey registers the key posted in r, generating it and storing its private key when no public key is passed.
+func addKey(w http.ResponseWriter, r *http.Request) {
+
+	req := keyRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		cloud.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	if !authorize(w, r, auth.ActionProvision, keysScope, req.Environment) {
+		return
+	}
+	if err := keys.CheckName(req.Name); err != nil {
+		cloud.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	if _, err := registry.Get(req.Name); err == nil {
+		cloud.WriteError(w, http.StatusConflict, fmt.Errorf("%w: %s", keys.ErrExists, req.Name))
+		return
+	}
+	k := keys.Key{Name: req.Name, Team: req.Team, Environment: req.Environment, PublicKey: strings.TrimSpace(req.PublicKey)}
+	if k.PublicKey == "" {
+		private, public, err := secrets.GenerateSSHKey(4096)
+		if err != nil {
+			cloud.WriteError(w, http.StatusInternalServerError, err)
+			return
+		}
+		k.PublicKey = public + " " + req.Name
+		if k.PrivateKeyRef, err = secretStore.Put(r.Context(), "keys/"+req.Name, []byte(private)); err != nil {
+			cloud.WriteError(w, http.StatusInternalServerError, fmt.Errorf("could not store private key of %s: %w", req.Name, err))
+			return
+		}
+	}
+	if err := registry.Add(k); err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, keys.ErrExists) {
+			status = http.StatusConflict
+		}
+		cloud.WriteError(w, status, err)
+		return
+	}
+	cloud.WriteJSON(w, http.StatusCreated, k)
+}
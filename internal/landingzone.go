@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/shakilbd009/go-cloud/auth"
+	"github.com/shakilbd009/go-cloud/cloud"
+	"github.com/shakilbd009/go-cloud/landingzone"
+)
+
+//landingZoner is implemented by providers that can create the network of an environment.
+type landingZoner interface {
+	LandingZone(ctx context.Context, req landingzone.Request) (landingzone.Zone, error)
+}
+
+//landingZoneHandler serves POST /landingzone, creating the network, tier subnets and security groups of an environment.
+//Whatever was created is deleted again when a step fails.
+func landingZoneHandler(w http.ResponseWriter, r *http.Request) {
+
+	defer r.Body.Close()
+	if r.Method != http.MethodPost {
+		cloud.WriteError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return
+	}
+	req := landingzone.Request{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		cloud.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	var lz landingZoner
+	for _, p := range providers {
+		if p.Name() == req.Provider {
+			lz, _ = p.(landingZoner)
+		}
+	}
+	if lz == nil {
+		cloud.WriteError(w, http.StatusBadRequest, fmt.Errorf("provider %q can't create landing zones", req.Provider))
+		return
+	}
+	if !authorize(w, r, auth.ActionProvision, req.Provider, req.Environment) {
+		return
+	}
+	if err := req.Check(); err != nil {
+		cloud.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	saga := cloud.NewSaga()
+	zone, err := lz.LandingZone(cloud.WithSaga(r.Context(), saga), req)
+	if err != nil {
+		//the request context may be what failed, the rollback must not depend on it.
+		for _, rerr := range saga.Rollback(context.Background(), func(string) bool { return true }) {
+			if rerr != nil {
+				log.Printf("could not roll back landing zone %s on %s: %v\n", req.Environment, req.Provider, rerr)
+				err = fmt.Errorf("%w, rollback failed: %v", err, rerr)
+			}
+		}
+		if errors.Is(err, landingzone.ErrExists) {
+			cloud.WriteError(w, http.StatusConflict, err)
+			return
+		}
+		writeProviderError(w, err)
+		return
+	}
+	cloud.WriteJSON(w, http.StatusCreated, zone)
+}
@@ -1,36 +1,128 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"flag"
 	"io"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/shakilbd009/go-cloud/auth"
 	"github.com/shakilbd009/go-cloud/aws"
 	"github.com/shakilbd009/go-cloud/azure"
+	"github.com/shakilbd009/go-cloud/bootstrap"
+	"github.com/shakilbd009/go-cloud/cloud"
+	"github.com/shakilbd009/go-cloud/config"
 	"github.com/shakilbd009/go-cloud/gcp"
+	"github.com/shakilbd009/go-cloud/inventory"
+	"github.com/shakilbd009/go-cloud/jobs"
+	"github.com/shakilbd009/go-cloud/keys"
+	"github.com/shakilbd009/go-cloud/naming"
+	"github.com/shakilbd009/go-cloud/secrets"
+	"github.com/shakilbd009/go-cloud/validate"
 )
 
 var (
 	subscription   = ""
-	username       = "usertest"
-	passwd         = "useRword123$"
-	gregion        = "us-east1"
-	aregion        = "us-east-2"
-	zone           = "us-east1-c"
-	key            = "my-key-pair"
+	username       = "azureadmin"
+	secretsSpec    = "file:.secrets"
+	vaultStub      = ""
+	authPath       = ""
 	projectID      = ""
 	desc           = "my go sdk deployent test"
 	serviceAccount = ""
+	workers        = 4
+	queueSize      = 100
+	gcpWorkers     = 4
+	inventoryPath  = "inventory.db"
+	namingPath     = ""
+	templatesPath  = ""
+	keysPath       = "keys.json"
+	configPath     = ""
+	configReload   = 30 * time.Second
+	idempotencyTTL = 24 * time.Hour
+	jobRetention   = 24 * time.Hour
+	jobManager     *jobs.Manager
+	store          inventory.Store
+	settings       config.Source
+	secretStore    secrets.Store
+	registry       *keys.Registry
 )
 
 func main() {
 	parseFlags()
-	http.HandleFunc("/azure", azureHandler)
-	http.HandleFunc("/gcp", gcpHandler)
-	http.HandleFunc("/aws", awsHandler)
+	settings = config.Static{Config: config.Default()}
+	if configPath != "" {
+		watcher, err := config.Watch(configPath, configReload)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		settings = watcher
+	}
+	awsProvider, err := aws.NewProvider(settings)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	gcpProvider, err := gcp.NewProvider(context.Background(), projectID, serviceAccount, settings)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	if vaultStub != "" {
+		go func() {
+			log.Fatalln(http.ListenAndServe(vaultStub, secrets.NewVaultStub(os.Getenv("VAULT_TOKEN"))))
+		}()
+	}
+	secretStore, err = secrets.Open(secretsSpec)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	azureProvider := azure.NewProvider(subscription, username, secretStore, settings)
+	if namingPath != "" {
+		namer, err := naming.Load(namingPath)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		awsProvider.Namer, gcpProvider.Namer, azureProvider.Namer = namer, namer, namer
+	}
+	if templatesPath != "" {
+		if templates, err = bootstrap.Open(templatesPath); err != nil {
+			log.Fatalln(err)
+		}
+	}
+	if registry, err = keys.Open(keysPath); err != nil {
+		log.Fatalln(err)
+	}
+	gcpProvider.Workers = gcpWorkers
+	gcpProvider.Username = username
+	awsProvider.Secrets = secretStore
+	jobManager = jobs.NewManager(workers, queueSize, jobRetention)
+	store, err = inventory.NewBoltStore(inventoryPath, 5*time.Second)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	if err := loadAuth(authPath); err != nil {
+		log.Fatalln(err)
+	}
+	providers = []cloud.Provider{awsProvider, gcpProvider, azureProvider}
+	handle("/azure", providerHandler(azureProvider))
+	handle("/gcp", providerHandler(gcpProvider))
+	handle("/aws", providerHandler(awsProvider))
+	handle("/jobs/", jobsHandler)
+	handle("/inventory", inventoryHandler)
+	handle("/sizes", sizesHandler)
+	handle("/instances", instancesHandler)
+	handle("/keys", keysHandler)
+	handle("/landingzone", landingZoneHandler)
+	handle("/aws/keys", awsKeysHandler(awsProvider))
+	handle("/aws/keys/", awsKeysHandler(awsProvider))
+	handle("/keys/", keysHandler)
 	log.Fatalln(http.ListenAndServe(":9999", nil))
 }
 
@@ -39,6 +131,21 @@ func parseFlags() {
 	flag.StringVar(&projectID, "prjID", "", "project ID needs to be passed")
 	flag.StringVar(&serviceAccount, "serviceAccount", "", "service account needs to be passed")
 	flag.StringVar(&subscription, "subscription", "", "suscription needs to be passed")
+	flag.StringVar(&username, "adminUser", username, "admin user name created on Azure VMs and given the ssh key on gcp instances")
+	flag.StringVar(&secretsSpec, "secrets", secretsSpec, "secret backend for generated credentials: file:<dir> or vault:<addr> (token from VAULT_TOKEN)")
+	flag.StringVar(&vaultStub, "vaultStub", vaultStub, "address to serve a local in-memory Vault stub on, for development only")
+	flag.StringVar(&authPath, "auth", authPath, "JSON file with API tokens, JWT settings and roles, the API is anonymous if empty")
+	flag.IntVar(&workers, "workers", workers, "number of background provisioning workers")
+	flag.StringVar(&inventoryPath, "inventory", inventoryPath, "BoltDB file the inventory of provisioned instances is kept in")
+	flag.StringVar(&configPath, "config", configPath, "JSON file mapping environments and tiers to regions and networks, the built-in defaults are used if empty")
+	flag.DurationVar(&configReload, "configReload", configReload, "how often the config file is checked for changes, 0 to only read it at startup")
+	flag.StringVar(&namingPath, "naming", namingPath, "JSON naming convention file, the built-in standard is used if empty")
+	flag.StringVar(&templatesPath, "templates", templatesPath, "directory of user-data templates, rendered with the templateVars of a request")
+	flag.StringVar(&keysPath, "keys", keysPath, "file the registry of named ssh keys is kept in")
+	flag.DurationVar(&idempotencyTTL, "idempotencyTTL", idempotencyTTL, "how long a provisioning request is remembered under its Idempotency-Key or requestNum")
+	flag.DurationVar(&jobRetention, "jobRetention", jobRetention, "how long finished jobs can be looked up, kept forever if not positive")
+	flag.IntVar(&queueSize, "queue", queueSize, "number of provisioning jobs that can wait for a worker")
+	flag.IntVar(&gcpWorkers, "gcpWorkers", gcpWorkers, "number of gcp instances of one request created at once")
 	flag.Parse()
 	if projectID == "" || serviceAccount == "" || subscription == "" {
 		flag.PrintDefaults()
@@ -46,64 +153,188 @@ func parseFlags() {
 	}
 }
 
-func awsHandler(w http.ResponseWriter, r *http.Request) {
-	provider := "aws"
-	cfg, err := aws.GetNewSession(aregion)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+//providerHandler serves POST, GET and DELETE for any cloud.Provider.
+func providerHandler(p cloud.Provider) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		defer r.Body.Close()
+		payload := cloud.Request{}
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil && (err != io.EOF || r.Method == http.MethodPost) {
+			cloud.WriteError(w, http.StatusBadRequest, err)
+			return
+		}
+		if r.Method == http.MethodGet {
+			lookupFromQuery(r.URL.Query(), &payload)
+		}
+		payload.Provider = p.Name()
+		var (
+			resp   []cloud.Instance
+			err    error
+			status int
+		)
+		dryRun, _ := strconv.ParseBool(r.URL.Query().Get("dryRun"))
+		if r.Method == http.MethodPost && !authorize(w, r, action(r.Method, dryRun), p.Name(), payload.Environment) {
+			return
+		}
+		if errs := validateRequest(p, r.Method, payload); errs != nil {
+			cloud.WriteJSON(w, http.StatusBadRequest, map[string]validate.Errors{"errors": errs})
+			return
+		}
+		switch r.Method {
+		case http.MethodPost:
+			if errs := append(renderUserData(&payload), resolveSSHKey(&payload)...); len(errs) > 0 {
+				cloud.WriteJSON(w, http.StatusBadRequest, map[string]validate.Errors{"errors": errs})
+				return
+			}
+			if dryRun {
+				plan, err := p.Plan(r.Context(), payload)
+				if err != nil {
+					writeProviderError(w, err)
+					return
+				}
+				cloud.WriteJSON(w, http.StatusOK, plan)
+				return
+			}
+			submitProvision(w, r, p, payload)
+			return
+		case http.MethodGet:
+			if !authorizeProvider(w, r, auth.ActionRead, p.Name()) {
+				return
+			}
+			resp, err = p.Describe(r.Context(), payload)
+			if err == nil && !authorizeInstances(w, r, auth.ActionRead, p.Name(), resp) {
+				return
+			}
+			status = http.StatusOK
+		case http.MethodDelete:
+			env, ok := authorizeTargets(w, r, p, payload)
+			if !ok {
+				return
+			}
+			if keep := r.URL.Query().Get("keepDisks"); keep != "" {
+				payload.KeepDisks, err = strconv.ParseBool(keep)
+				if err != nil {
+					cloud.WriteError(w, http.StatusBadRequest, err)
+					return
+				}
+			}
+			submitJob(w, p.Name(), env, "delete", func(ctx context.Context) ([]cloud.Instance, error) {
+				resp, err := p.Delete(ctx, payload)
+				forgetInstances(payload.Provider, resp)
+				return resp, err
+			})
+			return
+		default:
+			cloud.WriteError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+			return
+		}
+		if err != nil {
+			writeProviderError(w, err)
+			return
+		}
+		cloud.WriteJSON(w, status, resp)
 	}
-	defer r.Body.Close()
-	payload := aws.AWSrequest{}
-	rdr := io.TeeReader(r.Body, os.Stdout)
-	if err := json.NewDecoder(rdr).Decode(&payload); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+}
+
+//lookupFromQuery fills the fields that identify instances from the query of a GET request.
+func lookupFromQuery(q url.Values, payload *cloud.Request) {
+
+	if ids := q.Get("instanceIds"); ids != "" {
+		payload.InstanceIDs = strings.Split(ids, ",")
 	}
-	payload.Ctx = r.Context()
-	payload.Provider = provider
-	payload.Config = cfg
-	if r.Method == http.MethodPost {
-		aws.Post(w, payload)
+	for param, field := range map[string]*string{
+		"instanceName":  &payload.Instance,
+		"vmName":        &payload.VMname,
+		"requestNum":    &payload.ChangeNum,
+		"zone":          &payload.Zone,
+		"resourceGroup": &payload.RG,
+	} {
+		if v := q.Get(param); v != "" {
+			*field = v
+		}
 	}
 }
 
-func gcpHandler(w http.ResponseWriter, r *http.Request) {
+//action returns the auth action a provider request performs.
+func action(method string, dryRun bool) string {
+	switch {
+	case method == http.MethodPost && dryRun:
+		return auth.ActionPlan
+	case method == http.MethodPost:
+		return auth.ActionProvision
+	case method == http.MethodDelete:
+		return auth.ActionDelete
+	}
+	return auth.ActionRead
+}
 
-	provider := "gcp"
-	payload := gcp.GCPrequest{}
-	defer r.Body.Close()
-	rdr := io.TeeReader(r.Body, os.Stdout)
-	if err := json.NewDecoder(rdr).Decode(&payload); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+//validator is implemented by providers that can check a request up front.
+type validator interface {
+	Rules() validate.Rules
+}
+
+//validateRequest returns the field errors of payload or nil if p can't validate it.
+func validateRequest(p cloud.Provider, method string, payload cloud.Request) validate.Errors {
+
+	v, ok := p.(validator)
+	if !ok {
+		return nil
 	}
-	svc, err := gcp.GetSession(r.Context())
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	switch method {
+	case http.MethodPost:
+		return validate.Provision(payload, settings.Current(), v.Rules())
+	case http.MethodGet:
+		return validate.Describe(payload, v.Rules())
+	case http.MethodDelete:
+		return validate.Identity(payload, v.Rules())
+	}
+	return nil
+}
+
+func writeProviderError(w http.ResponseWriter, err error) {
+	if errors.Is(err, cloud.ErrNotSupported) {
+		cloud.WriteError(w, http.StatusNotImplemented, err)
 		return
 	}
-	if r.Method == http.MethodPost {
-		gcp.Post(w, r, svc, payload, projectID, provider, gregion, serviceAccount)
+	if errors.Is(err, naming.ErrCollision) {
+		cloud.WriteError(w, http.StatusConflict, err)
+		return
 	}
-	if r.Method == http.MethodGet {
-		gcp.Get(w, r, svc, payload, projectID, provider, zone, payload.Instance)
+	cloud.WriteError(w, http.StatusInternalServerError, err)
+}
+
+//submitJob queues fn acting on env on the job manager and responds with 202 and the job, it reports whether the job was queued.
+func submitJob(w http.ResponseWriter, provider, env, action string, fn jobs.Func) (jobs.Job, bool) {
+
+	job, err := jobManager.Submit(provider, env, action, fn)
+	if err != nil {
+		cloud.WriteError(w, http.StatusServiceUnavailable, err)
+		return jobs.Job{}, false
 	}
+	w.Header().Set("Location", "/jobs/"+job.ID)
+	cloud.WriteJSON(w, http.StatusAccepted, job)
+	return job, true
 }
 
-func azureHandler(w http.ResponseWriter, r *http.Request) {
+//jobsHandler serves GET /jobs/{id} and POST /jobs/{id}/rollback.
+func jobsHandler(w http.ResponseWriter, r *http.Request) {
 
-	payload := azure.AZrequest{}
-	defer r.Body.Close()
-	rdr := io.TeeReader(r.Body, os.Stdout)
-	if err := json.NewDecoder(rdr).Decode(&payload); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	id := strings.TrimPrefix(r.URL.Path, "/jobs/")
+	if strings.HasSuffix(id, "/rollback") && r.Method == http.MethodPost {
+		rollbackJob(w, r, strings.TrimSuffix(id, "/rollback"))
 		return
 	}
-	if r.Method == http.MethodPost {
-		azure.Post(w, r, subscription, username, passwd, payload)
+	if r.Method != http.MethodGet {
+		cloud.WriteError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return
 	}
-	if r.Method == http.MethodGet {
-		azure.Get(w, r, subscription, payload)
+	job, ok := jobManager.Get(id)
+	if !ok {
+		cloud.WriteError(w, http.StatusNotFound, errors.New("job not found"))
+		return
+	}
+	if !authorize(w, r, auth.ActionRead, job.Provider, job.Environment) {
+		return
 	}
+	cloud.WriteJSON(w, http.StatusOK, job)
 }
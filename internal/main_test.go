@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/shakilbd009/go-cloud/auth"
+	"github.com/shakilbd009/go-cloud/cloud"
+	"github.com/shakilbd009/go-cloud/inventory"
+	"github.com/shakilbd009/go-cloud/jobs"
+)
+
+//fakeProvider is a cloud.Provider whose calls are answered by its funcs, nil ones answer nothing.
+type fakeProvider struct {
+	name      string
+	provision func(ctx context.Context, req cloud.Request) ([]cloud.Instance, error)
+	describe  func(ctx context.Context, req cloud.Request) ([]cloud.Instance, error)
+	list      func(ctx context.Context, filter cloud.Filter) ([]cloud.Instance, error)
+}
+
+func (f *fakeProvider) Name() string { return f.name }
+
+func (f *fakeProvider) Provision(ctx context.Context, req cloud.Request) ([]cloud.Instance, error) {
+	if f.provision == nil {
+		return nil, nil
+	}
+	return f.provision(ctx, req)
+}
+
+func (f *fakeProvider) Plan(ctx context.Context, req cloud.Request) (cloud.Plan, error) {
+	return cloud.Plan{}, nil
+}
+
+func (f *fakeProvider) Describe(ctx context.Context, req cloud.Request) ([]cloud.Instance, error) {
+	if f.describe == nil {
+		return nil, nil
+	}
+	return f.describe(ctx, req)
+}
+
+func (f *fakeProvider) Delete(ctx context.Context, req cloud.Request) ([]cloud.Instance, error) {
+	return nil, nil
+}
+
+func (f *fakeProvider) List(ctx context.Context, filter cloud.Filter) ([]cloud.Instance, error) {
+	if f.list == nil {
+		return nil, nil
+	}
+	return f.list(ctx, filter)
+}
+
+//testServer resets the state shared by the handlers: an empty inventory, a job manager and,
+//when roles is not nil, a policy granting each role its rules. Without roles anyone may do anything.
+func testServer(roles map[string][]auth.Rule) {
+
+	store = inventory.NewMemoryStore()
+	jobManager = jobs.NewManager(1, 10, 0)
+	authenticator, policy = nil, auth.Policy{}
+	if roles != nil {
+		authenticator, policy = auth.StaticTokens{}, auth.Policy{Roles: roles}
+	}
+}
+
+//serve runs h on a request of method to target with body, made by a caller holding roles.
+func serve(h http.HandlerFunc, method, target, body string, roles ...string) *httptest.ResponseRecorder {
+
+	r := httptest.NewRequest(method, target, strings.NewReader(body))
+	r = r.WithContext(auth.WithPrincipal(r.Context(), &auth.Principal{Subject: "tester", Roles: roles}))
+	w := httptest.NewRecorder()
+	h(w, r)
+	return w
+}
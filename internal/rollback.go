@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/shakilbd009/go-cloud/auth"
+	"github.com/shakilbd009/go-cloud/cloud"
+	"github.com/shakilbd009/go-cloud/jobs"
+)
+
+//sagas keeps the resources every provisioning job created, so they can be rolled back on request.
+var sagas = struct {
+	sync.Mutex
+	byJob map[string]*cloud.Saga
+}{byJob: make(map[string]*cloud.Saga)}
+
+//provisionJob returns a job provisioning payload on p that applies the rollback policy of payload when it fails.
+func provisionJob(p cloud.Provider, payload cloud.Request) (jobs.Func, *cloud.Saga) {
+
+	saga := cloud.NewSaga()
+	return func(ctx context.Context) ([]cloud.Instance, error) {
+		instances, err := p.Provision(cloud.WithSaga(withInventory(ctx, payload), saga), payload)
+		if err != nil {
+			instances = rollback(ctx, saga, payload.Provider, payload.Rollback, instances)
+		}
+		return instances, err
+	}, saga
+}
+
+//keepSaga remembers the saga of a submitted job, forgetting those of the jobs the manager evicted.
+func keepSaga(jobID string, saga *cloud.Saga) {
+
+	sagas.Lock()
+	defer sagas.Unlock()
+	for id := range sagas.byJob {
+		if _, ok := jobManager.Get(id); !ok {
+			delete(sagas.byJob, id)
+		}
+	}
+	sagas.byJob[jobID] = saga
+}
+
+//rollback deletes what saga recorded according to policy, keep-successful if empty, and marks the instances rolled back.
+func rollback(ctx context.Context, saga *cloud.Saga, provider, policy string, instances []cloud.Instance) []cloud.Instance {
+
+	succeeded := make(map[string]bool)
+	for _, inst := range instances {
+		if inst.Error == "" && inst.InstanceName != "" {
+			succeeded[inst.InstanceName] = true
+		}
+	}
+	selected := func(instance string) bool {
+		//shared resources are only removed when no instance is left using them.
+		if instance == "" {
+			return len(succeeded) == 0
+		}
+		return !succeeded[instance]
+	}
+	switch policy {
+	case cloud.RollbackNone:
+		return instances
+	case cloud.RollbackAll:
+		selected = func(string) bool { return true }
+	}
+	return markRolledBack(provider, instances, saga.Rollback(ctx, selected))
+}
+
+//markRolledBack updates the status of instances from the results of a rollback and removes the rolled back ones from the inventory.
+func markRolledBack(provider string, instances []cloud.Instance, results map[string]error) []cloud.Instance {
+
+	forgotten := make([]cloud.Instance, 0)
+	for i := range instances {
+		err, ok := results[instances[i].InstanceName]
+		if !ok {
+			continue
+		}
+		if err != nil {
+			msg := fmt.Sprintf("rollback failed: %v", err)
+			if instances[i].Error != "" {
+				msg = instances[i].Error + "; " + msg
+			}
+			instances[i].Error = msg
+			continue
+		}
+		//failed instances may have been recorded before they failed, they are gone all the same.
+		forgotten = append(forgotten, cloud.Instance{InstanceName: instances[i].InstanceName, ID: instances[i].ID})
+		instances[i].Status = "RolledBack"
+	}
+	forgetInstances(provider, forgotten)
+	return instances
+}
+
+//rollbackJob serves POST /jobs/{id}/rollback, deleting everything a finished provisioning job created.
+func rollbackJob(w http.ResponseWriter, r *http.Request, id string) {
+
+	job, ok := jobManager.Get(id)
+	if !ok {
+		cloud.WriteError(w, http.StatusNotFound, errors.New("job not found"))
+		return
+	}
+	if !authorize(w, r, auth.ActionDelete, job.Provider, job.Environment) {
+		return
+	}
+	if job.State == jobs.Queued || job.State == jobs.Running {
+		cloud.WriteError(w, http.StatusConflict, errors.New("job is still running"))
+		return
+	}
+	sagas.Lock()
+	saga, ok := sagas.byJob[id]
+	sagas.Unlock()
+	if !ok || len(saga.Steps()) == 0 {
+		cloud.WriteError(w, http.StatusConflict, errors.New("job has nothing left to roll back"))
+		return
+	}
+	submitJob(w, job.Provider, job.Environment, "rollback", func(ctx context.Context) ([]cloud.Instance, error) {
+
+		results := saga.Rollback(ctx, func(string) bool { return true })
+		instances := make([]cloud.Instance, 0, len(results))
+		for _, inst := range job.Instances {
+			if _, ok := results[inst.InstanceName]; ok {
+				inst.Error = ""
+				instances = append(instances, inst)
+			}
+		}
+		instances = markRolledBack(job.Provider, instances, results)
+		for _, inst := range instances {
+			if inst.Error != "" {
+				return instances, errors.New("some resources could not be rolled back")
+			}
+		}
+		return instances, nil
+	})
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/shakilbd009/go-cloud/cloud"
+	"github.com/shakilbd009/go-cloud/inventory"
+)
+
+func TestRollbackPolicies(t *testing.T) {
+
+	testServer(nil)
+	tests := []struct {
+		name       string
+		policy     string
+		instances  []cloud.Instance
+		failing    string
+		wantUndo   []string
+		wantStatus map[string]string
+	}{
+		{name: "keep successful by default",
+			instances: []cloud.Instance{{InstanceName: "a", Status: "Running"}, {InstanceName: "b", Error: "timeout"}},
+			wantUndo:  []string{"b-vm"}, wantStatus: map[string]string{"a": "Running", "b": "RolledBack"}},
+		{name: "keep successful removes shared resources when every instance failed", policy: cloud.RollbackKeepSuccessful,
+			instances: []cloud.Instance{{InstanceName: "a", Error: "quota"}, {InstanceName: "b", Error: "timeout"}},
+			wantUndo:  []string{"b-vm", "a-vm", "net"}, wantStatus: map[string]string{"a": "RolledBack", "b": "RolledBack"}},
+		{name: "all", policy: cloud.RollbackAll,
+			instances: []cloud.Instance{{InstanceName: "a", Status: "Running"}, {InstanceName: "b", Error: "timeout"}},
+			wantUndo:  []string{"b-vm", "a-vm", "net"}, wantStatus: map[string]string{"a": "RolledBack", "b": "RolledBack"}},
+		{name: "none", policy: cloud.RollbackNone,
+			instances:  []cloud.Instance{{InstanceName: "a", Status: "Running"}, {InstanceName: "b", Error: "timeout"}},
+			wantStatus: map[string]string{"a": "Running", "b": ""}},
+		{name: "failed rollback is reported", policy: cloud.RollbackAll, failing: "b-vm",
+			instances: []cloud.Instance{{InstanceName: "a", Status: "Running"}, {InstanceName: "b", Error: "timeout"}},
+			wantUndo:  []string{"a-vm", "net"}, wantStatus: map[string]string{"a": "RolledBack", "b": ""}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			undone := make([]string, 0)
+			undo := func(id string) func(context.Context) error {
+				return func(context.Context) error {
+					if id == tt.failing {
+						return errors.New("boom")
+					}
+					undone = append(undone, id)
+					return nil
+				}
+			}
+			saga := cloud.NewSaga()
+			ctx := cloud.WithSaga(context.Background(), saga)
+			cloud.Record(ctx, "", "network", "net", undo("net"))
+			cloud.Record(ctx, "a", "instance", "a-vm", undo("a-vm"))
+			cloud.Record(ctx, "b", "instance", "b-vm", undo("b-vm"))
+
+			instances := append([]cloud.Instance{}, tt.instances...)
+			got := rollback(context.Background(), saga, "gcp", tt.policy, instances)
+			if !reflect.DeepEqual(undone, append([]string{}, tt.wantUndo...)) {
+				t.Errorf("undone = %v, want %v", undone, tt.wantUndo)
+			}
+			for _, inst := range got {
+				if inst.Status != tt.wantStatus[inst.InstanceName] {
+					t.Errorf("status of %s = %q, want %q", inst.InstanceName, inst.Status, tt.wantStatus[inst.InstanceName])
+				}
+			}
+			if tt.failing != "" {
+				if want := "timeout; rollback failed: boom"; got[1].Error != want {
+					t.Errorf("error of b = %q, want %q", got[1].Error, want)
+				}
+			}
+		})
+	}
+}
+
+func TestProvisionJobForgetsRolledBackInstances(t *testing.T) {
+
+	testServer(nil)
+	p := &fakeProvider{name: "gcp", provision: func(ctx context.Context, req cloud.Request) ([]cloud.Instance, error) {
+		//both instances are created and reported before waiting for them, then b never comes up.
+		for _, name := range []string{"a", "b"} {
+			cloud.Record(ctx, name, "instance", name+"-vm", func(context.Context) error { return nil })
+			cloud.ReportProgress(ctx, cloud.Instance{InstanceName: name, ID: name + "-id", Status: "PROVISIONING"})
+		}
+		return []cloud.Instance{
+			{InstanceName: "a", ID: "a-id", Status: "RUNNING"},
+			{InstanceName: "b", ID: "b-id", Status: "PROVISIONING", Error: "timed out waiting for RUNNING"},
+		}, errors.New("some instances failed")
+	}}
+	fn, _ := provisionJob(p, cloud.Request{Provider: "gcp", Environment: "dev", ChangeNum: "CHG1"})
+	instances, err := fn(context.Background())
+	if err == nil {
+		t.Fatal("job error = nil, want the provisioning error")
+	}
+	if instances[1].Status != "RolledBack" {
+		t.Errorf("status of b = %q, want RolledBack", instances[1].Status)
+	}
+	records, err := store.List(inventory.Filter{ChangeNum: "CHG1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := make([]string, 0, len(records))
+	for _, record := range records {
+		names = append(names, record.Name)
+	}
+	if want := []string{"a"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("inventory = %v, want %v", names, want)
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+
+	"github.com/shakilbd009/go-cloud/auth"
+	"github.com/shakilbd009/go-cloud/cloud"
+)
+
+//sizeCatalog object lists the instance sizes a provider allows in an environment.
+type sizeCatalog struct {
+	Provider    string   `json:"provider"`
+	Environment string   `json:"env"`
+	Default     string   `json:"default,omitempty"`
+	Sizes       []string `json:"sizes"`
+}
+
+//sizesHandler serves GET /sizes?provider&env, listing only the catalogs the caller may read.
+func sizesHandler(w http.ResponseWriter, r *http.Request) {
+
+	if r.Method != http.MethodGet {
+		cloud.WriteError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return
+	}
+	q := r.URL.Query()
+	if provider, env := q.Get("provider"), q.Get("env"); provider != "" && env != "" && !authorize(w, r, auth.ActionRead, provider, env) {
+		return
+	}
+	cfg := settings.Current()
+	providers := make([]string, 0, len(cfg.Providers))
+	for name := range cfg.Providers {
+		if q.Get("provider") == "" || q.Get("provider") == name {
+			providers = append(providers, name)
+		}
+	}
+	sort.Strings(providers)
+	catalogs := make([]sizeCatalog, 0)
+	for _, provider := range providers {
+		envs := cfg.EnvNames(provider)
+		if env := q.Get("env"); env != "" {
+			envs = []string{env}
+		}
+		sort.Strings(envs)
+		for _, env := range envs {
+			if !allowed(r, auth.ActionRead, provider, env) {
+				continue
+			}
+			catalogs = append(catalogs, sizeCatalog{
+				Provider:    provider,
+				Environment: env,
+				Default:     cfg.Provider(provider).InstanceType,
+				Sizes:       cfg.Sizes(provider, env),
+			})
+		}
+	}
+	cloud.WriteJSON(w, http.StatusOK, catalogs)
+}
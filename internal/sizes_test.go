@@ -0,0 +1,56 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/shakilbd009/go-cloud/config"
+)
+
+func TestSizesHandler(t *testing.T) {
+
+	testServer(nil)
+	settings = config.Static{Config: &config.Config{
+		Providers: map[string]config.ProviderDefaults{
+			"aws": {InstanceType: "t2.micro", Sizes: map[string][]string{"*": {"t2.micro", "t3.small"}, "prod": {"m5.large"}}},
+			"gcp": {InstanceType: "e2-small", Sizes: map[string][]string{"*": {"e2-small"}}},
+		},
+		Environments: map[string]config.Environment{
+			"dev":  {"web": {"aws": {}, "gcp": {}}},
+			"prod": {"web": {"aws": {}}},
+		},
+	}}
+	awsDev := sizeCatalog{Provider: "aws", Environment: "dev", Default: "t2.micro", Sizes: []string{"t2.micro", "t3.small"}}
+	awsProd := sizeCatalog{Provider: "aws", Environment: "prod", Default: "t2.micro", Sizes: []string{"m5.large"}}
+	gcpDev := sizeCatalog{Provider: "gcp", Environment: "dev", Default: "e2-small", Sizes: []string{"e2-small"}}
+	tests := []struct {
+		target string
+		want   []sizeCatalog
+	}{
+		{target: "/sizes", want: []sizeCatalog{awsDev, awsProd, gcpDev}},
+		{target: "/sizes?provider=aws", want: []sizeCatalog{awsDev, awsProd}},
+		{target: "/sizes?env=dev", want: []sizeCatalog{awsDev, gcpDev}},
+		{target: "/sizes?provider=aws&env=prod", want: []sizeCatalog{awsProd}},
+		{target: "/sizes?provider=azure", want: []sizeCatalog{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			w := serve(sizesHandler, http.MethodGet, tt.target, "")
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d: %s", w.Code, w.Body)
+			}
+			got := make([]sizeCatalog, 0)
+			if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("catalogs = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+	if w := serve(sizesHandler, http.MethodPost, "/sizes", ""); w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST status = %d, want %d", w.Code, http.StatusMethodNotAllowed)
+	}
+}
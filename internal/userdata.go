@@ -0,0 +1,30 @@
+package main
+
+import (
+	"github.com/shakilbd009/go-cloud/bootstrap"
+	"github.com/shakilbd009/go-cloud/cloud"
+	"github.com/shakilbd009/go-cloud/validate"
+)
+
+//templates is the library named user-data templates are rendered from, nil if none is configured.
+var templates *bootstrap.Library
+
+//renderUserData renders the template of payload into its UserData, it returns the field errors if it can't.
+func renderUserData(payload *cloud.Request) validate.Errors {
+
+	if payload.Template == "" {
+		return nil
+	}
+	if templates == nil {
+		return validate.Errors{{Field: "template", Code: validate.CodeNotFound, Message: "no template library is configured"}}
+	}
+	script, err := templates.Render(payload.Template, bootstrap.Vars(*payload))
+	if err != nil {
+		return validate.Errors{{Field: "template", Code: validate.CodeInvalid, Message: err.Error()}}
+	}
+	if err := bootstrap.Check(payload.Provider, payload.Osname, script); err != nil {
+		return validate.Errors{{Field: "template", Code: validate.CodeInvalid, Message: err.Error()}}
+	}
+	payload.UserData = script
+	return nil
+}
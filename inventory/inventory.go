@@ -0,0 +1,182 @@
+package inventory
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+//Record object describes a provisioned instance.
+type Record struct {
+	Provider  string            `json:"provider"`
+	Name      string            `json:"name"`
+	ID        string            `json:"id,omitempty"`
+	Zone      string            `json:"zone,omitempty"`
+	IPs       []string          `json:"ips,omitempty"`
+	Tags      map[string]string `json:"tags,omitempty"`
+	ChangeNum string            `json:"requestNum,omitempty"`
+	Created   time.Time         `json:"created"`
+}
+
+//Key uniquely identifies a record within the store.
+func (r Record) Key() string {
+	if r.ID != "" {
+		return r.Provider + "/" + r.ID
+	}
+	return r.Provider + "/" + r.Name
+}
+
+//Filter narrows down a List call, empty fields match everything.
+type Filter struct {
+	Provider    string
+	Name        string
+	Zone        string
+	ChangeNum   string
+	AppCode     string
+	Environment string
+}
+
+func (f Filter) match(r Record) bool {
+	return matches(f.Provider, r.Provider) &&
+		matches(f.Name, r.Name) &&
+		matches(f.Zone, r.Zone) &&
+		matches(f.ChangeNum, r.ChangeNum) &&
+		matches(f.AppCode, r.Tags["appcode"]) &&
+		matches(f.Environment, r.Tags["env"])
+}
+
+func matches(want, got string) bool {
+	return want == "" || strings.EqualFold(want, got)
+}
+
+//Store records provisioned instances.
+type Store interface {
+	//Put adds or replaces a record.
+	Put(r Record) error
+	//List returns the records matching f, oldest first.
+	List(f Filter) ([]Record, error)
+	//Delete removes the record with the given key.
+	Delete(key string) error
+}
+
+//MemoryStore is a Store that lives in memory only.
+type MemoryStore struct {
+	mu      sync.RWMutex
+	records map[string]Record
+}
+
+//NewMemoryStore returns an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{records: make(map[string]Record)}
+}
+
+//Put adds or replaces a record.
+func (s *MemoryStore) Put(r Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records[r.Key()] = r
+	return nil
+}
+
+//List returns the records matching f, oldest first.
+func (s *MemoryStore) List(f Filter) ([]Record, error) {
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	list := make([]Record, 0)
+	for _, r := range s.records {
+		if f.match(r) {
+			list = append(list, r)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Created.Before(list[j].Created) })
+	return list, nil
+}
+
+//Delete removes the record with the given key.
+func (s *MemoryStore) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.records, key)
+	return nil
+}
+
+//bucket holds the records of a BoltStore, JSON encoded and keyed by Record.Key.
+var bucket = []byte("records")
+
+//BoltStore is a Store kept in a BoltDB file. Every write is its own transaction, so the file is never left
+//half written, and the file is locked so a second server can't open the same inventory.
+type BoltStore struct {
+	db *bolt.DB
+}
+
+//NewBoltStore opens the store at path, creating it if needed.
+//It fails after timeout if another process holds the file.
+func NewBoltStore(path string, timeout time.Duration) (*BoltStore, error) {
+
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: timeout})
+	if err != nil {
+		return nil, fmt.Errorf("could not open inventory %s: %w", path, err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(bucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &BoltStore{db: db}, nil
+}
+
+//Put adds or replaces a record.
+func (s *BoltStore) Put(r Record) error {
+
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucket).Put([]byte(r.Key()), data)
+	})
+}
+
+//List returns the records matching f, oldest first.
+func (s *BoltStore) List(f Filter) ([]Record, error) {
+
+	list := make([]Record, 0)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucket).ForEach(func(k, v []byte) error {
+			r := Record{}
+			if err := json.Unmarshal(v, &r); err != nil {
+				return fmt.Errorf("could not decode record %s: %w", k, err)
+			}
+			if f.match(r) {
+				list = append(list, r)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Created.Before(list[j].Created) })
+	return list, nil
+}
+
+//Delete removes the record with the given key.
+func (s *BoltStore) Delete(key string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucket).Delete([]byte(key))
+	})
+}
+
+//Close releases the file of the store.
+func (s *BoltStore) Close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,153 @@
+package inventory
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+var now = time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)
+
+var testRecords = []Record{
+	{Provider: "aws", Name: "awsbxwdabc01", ID: "i-1", Zone: "us-east-2a", ChangeNum: "CHG1", Created: now,
+		Tags: map[string]string{"appcode": "abc", "env": "base"}},
+	{Provider: "aws", Name: "awsbxwdabc02", ID: "i-2", Zone: "us-east-2b", ChangeNum: "CHG1", Created: now.Add(time.Minute),
+		Tags: map[string]string{"appcode": "abc", "env": "base"}},
+	{Provider: "gcp", Name: "gcppxepxyz01", Zone: "us-east1-c", ChangeNum: "CHG2", Created: now.Add(-time.Minute),
+		Tags: map[string]string{"appcode": "xyz", "env": "prod"}},
+}
+
+//tempDir returns a new directory removed when the test ends through the returned func.
+func tempDir(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "inventory")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir, func() { os.RemoveAll(dir) }
+}
+
+//testStore checks the Store contract on s.
+func testStore(t *testing.T, s Store) {
+
+	for _, r := range testRecords {
+		if err := s.Put(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tests := []struct {
+		name   string
+		filter Filter
+		want   []string
+	}{
+		{name: "everything oldest first", want: []string{"gcppxepxyz01", "awsbxwdabc01", "awsbxwdabc02"}},
+		{name: "provider", filter: Filter{Provider: "aws"}, want: []string{"awsbxwdabc01", "awsbxwdabc02"}},
+		{name: "change number", filter: Filter{ChangeNum: "chg2"}, want: []string{"gcppxepxyz01"}},
+		{name: "app code tag", filter: Filter{AppCode: "ABC"}, want: []string{"awsbxwdabc01", "awsbxwdabc02"}},
+		{name: "env tag", filter: Filter{Environment: "prod"}, want: []string{"gcppxepxyz01"}},
+		{name: "zone and name", filter: Filter{Zone: "us-east-2b", Name: "awsbxwdabc02"}, want: []string{"awsbxwdabc02"}},
+		{name: "no match", filter: Filter{Provider: "aws", Environment: "prod"}, want: []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			records, err := s.List(tt.filter)
+			if err != nil {
+				t.Fatal(err)
+			}
+			names := make([]string, 0, len(records))
+			for _, r := range records {
+				names = append(names, r.Name)
+			}
+			if !reflect.DeepEqual(names, tt.want) {
+				t.Errorf("List(%+v) = %v, want %v", tt.filter, names, tt.want)
+			}
+		})
+	}
+
+	updated := testRecords[0]
+	updated.IPs = []string{"10.0.0.5"}
+	if err := s.Put(updated); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Delete(testRecords[1].Key()); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Delete("aws/i-unknown"); err != nil {
+		t.Errorf("Delete() of a missing key error = %v, want nil", err)
+	}
+	records, err := s.List(Filter{Provider: "aws"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []Record{updated}; !reflect.DeepEqual(records, want) {
+		t.Errorf("List() after Put and Delete = %+v, want %+v", records, want)
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	testStore(t, NewMemoryStore())
+}
+
+func TestBoltStore(t *testing.T) {
+
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	path := filepath.Join(dir, "inventory.db")
+	s, err := NewBoltStore(path, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testStore(t, s)
+	want, err := s.List(Filter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened, err := NewBoltStore(path, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.Close()
+	got, err := reopened.List(Filter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("List() after reopening = %+v, want %+v", got, want)
+	}
+}
+
+func TestBoltStoreLocked(t *testing.T) {
+
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	path := filepath.Join(dir, "inventory.db")
+	s, err := NewBoltStore(path, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if second, err := NewBoltStore(path, 50*time.Millisecond); err == nil {
+		second.Close()
+		t.Fatal("NewBoltStore() of a file already open succeeded, want a timeout")
+	}
+}
+
+func TestNewBoltStoreNotADatabase(t *testing.T) {
+
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	path := filepath.Join(dir, "inventory.json")
+	if err := ioutil.WriteFile(path, []byte(`[{"provider":"aws"}]`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if s, err := NewBoltStore(path, time.Second); err == nil {
+		s.Close()
+		t.Fatal("NewBoltStore() of a JSON file succeeded, want an error")
+	}
+}
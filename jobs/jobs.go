@@ -0,0 +1,192 @@
+package jobs
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/shakilbd009/go-cloud/cloud"
+)
+
+//ErrQueueFull is returned by Submit when no worker can accept the job.
+var ErrQueueFull = errors.New("job queue is full, please try again later")
+
+//State of a job.
+type State string
+
+//Job states.
+const (
+	Queued    State = "queued"
+	Running   State = "running"
+	Succeeded State = "succeeded"
+	Failed    State = "failed"
+)
+
+//Job object
+type Job struct {
+	ID       string `json:"id"`
+	Provider string `json:"provider"`
+	//Environment is the environment the job acts in, callers are authorized against it.
+	Environment string           `json:"env,omitempty"`
+	Action      string           `json:"action"`
+	State       State            `json:"state"`
+	Instances   []cloud.Instance `json:"instances"`
+	Error       string           `json:"error,omitempty"`
+	Created     time.Time        `json:"created"`
+	Updated     time.Time        `json:"updated"`
+}
+
+//Func is the unit of work run by a job.
+type Func func(ctx context.Context) ([]cloud.Instance, error)
+
+type task struct {
+	id string
+	fn Func
+}
+
+//Manager runs jobs on a fixed pool of workers and keeps their status.
+type Manager struct {
+	mu        sync.Mutex
+	jobs      map[string]*Job
+	queue     chan task
+	retention time.Duration
+}
+
+//NewManager starts workers goroutines consuming a queue of queueSize jobs.
+//Finished jobs are forgotten retention after they last changed, never if retention is not positive.
+func NewManager(workers, queueSize int, retention time.Duration) *Manager {
+
+	m := &Manager{
+		jobs:      make(map[string]*Job),
+		queue:     make(chan task, queueSize),
+		retention: retention,
+	}
+	for i := 0; i < workers; i++ {
+		go m.worker()
+	}
+	return m
+}
+
+//Submit queues fn acting on env and returns the newly created job or an error if any.
+func (m *Manager) Submit(provider, env, action string, fn Func) (Job, error) {
+
+	id, err := newID()
+	if err != nil {
+		return Job{}, err
+	}
+	now := time.Now().UTC()
+	job := &Job{
+		ID:          id,
+		Provider:    provider,
+		Environment: env,
+		Action:      action,
+		State:       Queued,
+		Instances:   make([]cloud.Instance, 0),
+		Created:     now,
+		Updated:     now,
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.evict(now)
+	select {
+	case m.queue <- task{id: id, fn: fn}:
+		m.jobs[id] = job
+		return copyJob(job), nil
+	default:
+		return Job{}, ErrQueueFull
+	}
+}
+
+//Get returns a snapshot of the job with the given ID.
+func (m *Manager) Get(id string) (Job, bool) {
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	job, ok := m.jobs[id]
+	if !ok {
+		return Job{}, false
+	}
+	return copyJob(job), true
+}
+
+//evict removes the finished jobs not updated within the retention, m.mu must be held.
+func (m *Manager) evict(now time.Time) {
+
+	if m.retention <= 0 {
+		return
+	}
+	for id, job := range m.jobs {
+		if (job.State == Succeeded || job.State == Failed) && now.Sub(job.Updated) > m.retention {
+			delete(m.jobs, id)
+		}
+	}
+}
+
+func (m *Manager) worker() {
+	for t := range m.queue {
+		m.run(t)
+	}
+}
+
+func (m *Manager) run(t task) {
+
+	m.update(t.id, func(job *Job) { job.State = Running })
+	ctx := cloud.WithProgress(context.Background(), func(inst cloud.Instance) {
+		m.update(t.id, func(job *Job) { job.Instances = upsert(job.Instances, inst) })
+	})
+	now := time.Now()
+	instances, err := t.fn(ctx)
+	m.update(t.id, func(job *Job) {
+		for _, inst := range instances {
+			job.Instances = upsert(job.Instances, inst)
+		}
+		if err != nil {
+			job.State = Failed
+			job.Error = err.Error()
+			return
+		}
+		job.State = Succeeded
+	})
+	log.Printf("job %s finished in %.2f minutes\n", t.id, time.Since(now).Minutes())
+}
+
+func (m *Manager) update(id string, fn func(*Job)) {
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	job, ok := m.jobs[id]
+	if !ok {
+		return
+	}
+	fn(job)
+	job.Updated = time.Now().UTC()
+}
+
+//upsert replaces the instance with the same name and ID or appends inst.
+func upsert(instances []cloud.Instance, inst cloud.Instance) []cloud.Instance {
+	for i, v := range instances {
+		if v.InstanceName == inst.InstanceName && (v.ID == "" || v.ID == inst.ID) {
+			instances[i] = inst
+			return instances
+		}
+	}
+	return append(instances, inst)
+}
+
+func copyJob(job *Job) Job {
+	cp := *job
+	cp.Instances = append([]cloud.Instance(nil), job.Instances...)
+	return cp
+}
+
+func newID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
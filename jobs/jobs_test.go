@@ -0,0 +1,141 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/shakilbd009/go-cloud/cloud"
+)
+
+//waitState polls m until the job id reaches want or a second passed.
+func waitState(t *testing.T, m *Manager, id string, want State) Job {
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		job, ok := m.Get(id)
+		if !ok {
+			t.Fatalf("job %s not found", id)
+		}
+		if job.State == want {
+			return job
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("job %s is %s, want %s", id, job.State, want)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestSubmitQueueFull(t *testing.T) {
+
+	tests := []struct {
+		name      string
+		queueSize int
+		submits   int
+		wantFull  int
+	}{
+		{name: "no queue", queueSize: 0, submits: 1, wantFull: 1},
+		{name: "within the queue", queueSize: 2, submits: 2},
+		{name: "past the queue", queueSize: 2, submits: 4, wantFull: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			//no workers, so nothing leaves the queue.
+			m := NewManager(0, tt.queueSize, 0)
+			full := 0
+			for i := 0; i < tt.submits; i++ {
+				job, err := m.Submit("gcp", "dev", "provision", func(context.Context) ([]cloud.Instance, error) { return nil, nil })
+				if errors.Is(err, ErrQueueFull) {
+					full++
+					continue
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				if job.State != Queued || job.Environment != "dev" {
+					t.Errorf("Submit() = %+v, want a queued job in dev", job)
+				}
+			}
+			if full != tt.wantFull {
+				t.Errorf("%d submits were rejected, want %d", full, tt.wantFull)
+			}
+		})
+	}
+}
+
+func TestJobStates(t *testing.T) {
+
+	tests := []struct {
+		name      string
+		err       error
+		want      State
+		wantError string
+	}{
+		{name: "success", want: Succeeded},
+		{name: "failure", err: errors.New("quota exceeded"), want: Failed, wantError: "quota exceeded"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewManager(1, 1, 0)
+			started := make(chan struct{})
+			finish := make(chan struct{})
+			job, err := m.Submit("aws", "prod", "provision", func(ctx context.Context) ([]cloud.Instance, error) {
+				cloud.ReportProgress(ctx, cloud.Instance{InstanceName: "a", Status: "pending"})
+				close(started)
+				<-finish
+				return []cloud.Instance{{InstanceName: "a", ID: "i-1", Status: "running"}, {InstanceName: "b", Status: "running"}}, tt.err
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			<-started
+			running := waitState(t, m, job.ID, Running)
+			if want := []cloud.Instance{{InstanceName: "a", Status: "pending"}}; !reflect.DeepEqual(running.Instances, want) {
+				t.Errorf("instances while running = %+v, want %+v", running.Instances, want)
+			}
+			close(finish)
+			done := waitState(t, m, job.ID, tt.want)
+			if done.Error != tt.wantError {
+				t.Errorf("Error = %q, want %q", done.Error, tt.wantError)
+			}
+			want := []cloud.Instance{{InstanceName: "a", ID: "i-1", Status: "running"}, {InstanceName: "b", Status: "running"}}
+			if !reflect.DeepEqual(done.Instances, want) {
+				t.Errorf("instances when done = %+v, want %+v", done.Instances, want)
+			}
+			if done.Updated.Before(done.Created) {
+				t.Errorf("Updated %s is before Created %s", done.Updated, done.Created)
+			}
+		})
+	}
+}
+
+func TestEvict(t *testing.T) {
+
+	now := time.Now().UTC()
+	tests := []struct {
+		name      string
+		retention time.Duration
+		state     State
+		age       time.Duration
+		wantKept  bool
+	}{
+		{name: "old succeeded job", retention: time.Hour, state: Succeeded, age: 2 * time.Hour},
+		{name: "old failed job", retention: time.Hour, state: Failed, age: 2 * time.Hour},
+		{name: "recent finished job", retention: time.Hour, state: Succeeded, age: time.Minute, wantKept: true},
+		{name: "old running job", retention: time.Hour, state: Running, age: 2 * time.Hour, wantKept: true},
+		{name: "no retention", state: Succeeded, age: 1000 * time.Hour, wantKept: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewManager(0, 1, tt.retention)
+			m.jobs["old"] = &Job{ID: "old", State: tt.state, Updated: now.Add(-tt.age)}
+			m.evict(now)
+			if _, ok := m.Get("old"); ok != tt.wantKept {
+				t.Errorf("job kept = %v, want %v", ok, tt.wantKept)
+			}
+		})
+	}
+}
@@ -0,0 +1,198 @@
+package keys
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+//ErrNotFound is returned for a key the registry does not have.
+var ErrNotFound = errors.New("ssh key not found")
+
+//ErrExists is returned by Add for a name already registered.
+var ErrExists = errors.New("ssh key already exists")
+
+var keyName = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,62}$`)
+
+//Key object is a named SSH public key teams can provision instances with.
+type Key struct {
+	Name string `json:"name"`
+	Team string `json:"team,omitempty"`
+	//Environment is the environment the key may provision in, any environment when empty.
+	Environment string `json:"env,omitempty"`
+	PublicKey   string `json:"publicKey"`
+	//PrivateKeyRef is the secret reference of the private key of generated keys.
+	PrivateKeyRef string    `json:"privateKeyRef,omitempty"`
+	Created       time.Time `json:"created"`
+}
+
+//CheckName returns an error if name can't be used for a key, it has to be valid as an EC2 key pair name and a GCE label.
+func CheckName(name string) error {
+	if !keyName.MatchString(name) {
+		return fmt.Errorf("invalid key name %q, use up to 63 lowercase letters, digits and dashes", name)
+	}
+	return nil
+}
+
+//CheckPublicKey returns an error if key is not a single authorized_keys line.
+func CheckPublicKey(key string) error {
+
+	fields := strings.Fields(key)
+	if len(fields) < 2 || strings.Contains(strings.TrimSpace(key), "\n") {
+		return errors.New("public key must be one authorized_keys line: <type> <base64> [comment]")
+	}
+	switch {
+	case fields[0] == "ssh-rsa", fields[0] == "ssh-ed25519", strings.HasPrefix(fields[0], "ecdsa-sha2-"):
+	default:
+		return fmt.Errorf("unsupported public key type %q", fields[0])
+	}
+	wire, err := base64.StdEncoding.DecodeString(fields[1])
+	if err != nil {
+		return fmt.Errorf("public key is not base64: %w", err)
+	}
+	//the key blob starts with its own type, length prefixed.
+	if len(wire) < 4 {
+		return errors.New("public key is truncated")
+	}
+	size := binary.BigEndian.Uint32(wire)
+	if uint32(len(wire)-4) < size || !bytes.Equal(wire[4:4+size], []byte(fields[0])) {
+		return errors.New("public key does not match its type")
+	}
+	return nil
+}
+
+//Registry keeps named keys in a JSON file.
+type Registry struct {
+	mu   sync.RWMutex
+	path string
+	keys map[string]Key
+}
+
+//Open loads the registry at path, creating it on first write.
+func Open(path string) (*Registry, error) {
+
+	r := &Registry{path: path, keys: make(map[string]Key)}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return r, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	list := make([]Key, 0)
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("could not parse %s: %w", path, err)
+	}
+	for _, k := range list {
+		r.keys[k.Name] = k
+	}
+	return r, nil
+}
+
+//Get returns the key with the given name.
+func (r *Registry) Get(name string) (Key, error) {
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	k, ok := r.keys[name]
+	if !ok {
+		return Key{}, fmt.Errorf("%w: %s", ErrNotFound, name)
+	}
+	return k, nil
+}
+
+//List returns the keys of team, or every key if team is empty, sorted by name.
+func (r *Registry) List(team string) []Key {
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	list := make([]Key, 0, len(r.keys))
+	for _, k := range r.keys {
+		if team == "" || strings.EqualFold(team, k.Team) {
+			list = append(list, k)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+//Add registers k and persists the registry.
+func (r *Registry) Add(k Key) error {
+
+	if err := CheckName(k.Name); err != nil {
+		return err
+	}
+	if err := CheckPublicKey(k.PublicKey); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.keys[k.Name]; ok {
+		return fmt.Errorf("%w: %s", ErrExists, k.Name)
+	}
+	if k.Created.IsZero() {
+		k.Created = time.Now().UTC()
+	}
+	r.keys[k.Name] = k
+	if err := r.save(); err != nil {
+		delete(r.keys, k.Name)
+		return err
+	}
+	return nil
+}
+
+//Delete removes the key with the given name and persists the registry.
+func (r *Registry) Delete(name string) error {
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	k, ok := r.keys[name]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrNotFound, name)
+	}
+	delete(r.keys, name)
+	if err := r.save(); err != nil {
+		r.keys[name] = k
+		return err
+	}
+	return nil
+}
+
+//save writes the registry to a temp file and renames it over the old one.
+func (r *Registry) save() error {
+
+	list := make([]Key, 0, len(r.keys))
+	for _, k := range r.keys {
+		list = append(list, k)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	data, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(r.path), filepath.Base(r.path)+".tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), r.path)
+}
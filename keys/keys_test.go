@@ -0,0 +1,115 @@
+package keys
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+//blob returns a base64 key blob starting with the length prefixed kind, then rest.
+func blob(kind string, rest []byte) string {
+	wire := make([]byte, 4, 4+len(kind)+len(rest))
+	binary.BigEndian.PutUint32(wire, uint32(len(kind)))
+	wire = append(append(wire, kind...), rest...)
+	return base64.StdEncoding.EncodeToString(wire)
+}
+
+func TestCheckPublicKey(t *testing.T) {
+
+	rsa := blob("ssh-rsa", []byte{0, 0, 0, 1, 1})
+	tests := []struct {
+		name    string
+		key     string
+		wantErr bool
+	}{
+		{name: "rsa with comment", key: "ssh-rsa " + rsa + " ops@example"},
+		{name: "rsa without comment", key: "ssh-rsa " + rsa},
+		{name: "ed25519", key: "ssh-ed25519 " + blob("ssh-ed25519", make([]byte, 36))},
+		{name: "ecdsa", key: "ecdsa-sha2-nistp256 " + blob("ecdsa-sha2-nistp256", make([]byte, 8))},
+		{name: "trailing newline", key: "ssh-rsa " + rsa + "\n"},
+		{name: "empty", key: "", wantErr: true},
+		{name: "type only", key: "ssh-rsa", wantErr: true},
+		{name: "two lines", key: "ssh-rsa " + rsa + "\nssh-rsa " + rsa, wantErr: true},
+		{name: "unsupported type", key: "ssh-dss " + blob("ssh-dss", nil), wantErr: true},
+		{name: "not base64", key: "ssh-rsa not-base64!", wantErr: true},
+		{name: "truncated blob", key: "ssh-rsa " + base64.StdEncoding.EncodeToString([]byte{0, 0}), wantErr: true},
+		{name: "blob of another type", key: "ssh-rsa " + blob("ssh-ed25519", nil), wantErr: true},
+		{name: "length past the blob", key: "ssh-rsa " + base64.StdEncoding.EncodeToString([]byte{0, 0, 0, 40, 's'}), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := CheckPublicKey(tt.key); (err != nil) != tt.wantErr {
+				t.Errorf("CheckPublicKey() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCheckName(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		wantErr bool
+	}{
+		{name: "ops"},
+		{name: "ops-2020"},
+		{name: "0ops"},
+		{name: "", wantErr: true},
+		{name: "Ops", wantErr: true},
+		{name: "-ops", wantErr: true},
+		{name: "ops_key", wantErr: true},
+		{name: "abcdefghijklmnopqrstuvwxyzabcdefghijklmnopqrstuvwxyzabcdefghijkl", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := CheckName(tt.name); (err != nil) != tt.wantErr {
+				t.Errorf("CheckName(%q) error = %v, wantErr %v", tt.name, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRegistry(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "keys")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "keys.json")
+	r, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := Key{Name: "ops", Team: "platform", Environment: "dev", PublicKey: "ssh-rsa " + blob("ssh-rsa", nil)}
+	if err := r.Add(key); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Add(key); !errors.Is(err, ErrExists) {
+		t.Errorf("Add() twice error = %v, want %v", err, ErrExists)
+	}
+	reopened, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := reopened.Get("ops")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Environment != "dev" || got.Created.IsZero() {
+		t.Errorf("Get() = %+v, want the env and creation time saved", got)
+	}
+	if list := reopened.List("other"); len(list) != 0 {
+		t.Errorf("List(other) = %v, want none", list)
+	}
+	if err := reopened.Delete("ops"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := reopened.Get("ops"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get() after Delete error = %v, want %v", err, ErrNotFound)
+	}
+}
@@ -0,0 +1,143 @@
+package landingzone
+
+import (
+	"errors"
+	"fmt"
+	"math/bits"
+	"net"
+	"regexp"
+	"strings"
+
+	"github.com/shakilbd009/go-cloud/config"
+)
+
+//ErrExists is returned when the network of a landing zone already exists.
+var ErrExists = errors.New("landing zone already exists")
+
+//Tiers every landing zone gets a subnet and security group for, in the order they are carved from its CIDR.
+var Tiers = []string{"web", "app", "db"}
+
+var envName = regexp.MustCompile(`^[a-z][a-z0-9-]{0,19}$`)
+
+//Request object asks for the network of an environment.
+type Request struct {
+	Provider      string `json:"provider"`
+	Environment   string `json:"env"`
+	CIDR          string `json:"cidr"`
+	Region        string `json:"region,omitempty"`
+	ResourceGroup string `json:"resourceGroup,omitempty"`
+}
+
+//Check returns an error if the environment name or CIDR of r can't be used.
+func (r Request) Check() error {
+
+	if !envName.MatchString(r.Environment) {
+		return fmt.Errorf("invalid env %q, use up to 20 lowercase letters, digits and dashes starting with a letter", r.Environment)
+	}
+	_, err := Carve(r.CIDR, len(Tiers))
+	return err
+}
+
+//Subnet object is the subnet and security group of a tier.
+type Subnet struct {
+	Tier            string `json:"tier"`
+	Name            string `json:"name"`
+	ID              string `json:"id,omitempty"`
+	CIDR            string `json:"cidr"`
+	Zone            string `json:"zone,omitempty"`
+	SecurityGroup   string `json:"securityGroup,omitempty"`
+	SecurityGroupID string `json:"securityGroupId,omitempty"`
+}
+
+//Zone object is what a landing zone created.
+type Zone struct {
+	Provider    string   `json:"provider"`
+	Environment string   `json:"env"`
+	Region      string   `json:"region"`
+	Network     string   `json:"network"`
+	NetworkID   string   `json:"networkId,omitempty"`
+	CIDR        string   `json:"cidr"`
+	Subnets     []Subnet `json:"subnets"`
+	//Config is the environment to add to the config file so requests are placed in the landing zone.
+	Config config.Environment `json:"config"`
+}
+
+//Rule object allows inbound TCP traffic to a tier from a CIDR, or from another tier when Tier is set.
+type Rule struct {
+	FromPort int64
+	ToPort   int64
+	CIDR     string
+	Tier     string
+}
+
+//Rules returns the inbound rules of tier: ssh from the landing zone, web from anywhere, app from web and db from app.
+func Rules(tier, cidr string) []Rule {
+
+	rules := []Rule{{FromPort: 22, ToPort: 22, CIDR: cidr}}
+	switch tier {
+	case "web":
+		rules = append(rules, Rule{FromPort: 80, ToPort: 80, CIDR: "0.0.0.0/0"}, Rule{FromPort: 443, ToPort: 443, CIDR: "0.0.0.0/0"})
+	case "app":
+		rules = append(rules, Rule{FromPort: 0, ToPort: 65535, Tier: "web"})
+	case "db":
+		rules = append(rules, Rule{FromPort: 0, ToPort: 65535, Tier: "app"})
+	}
+	return rules
+}
+
+//Name returns the name of a resource of kind for env, and tier if any, i.e "dev-web-subnet".
+func Name(env, tier, kind string) string {
+	if tier == "" {
+		return fmt.Sprintf("%s-%s", env, kind)
+	}
+	return fmt.Sprintf("%s-%s-%s", env, tier, kind)
+}
+
+//Tag returns the network tag instances of env and tier get on providers that target firewall rules by tag.
+func Tag(env, tier string) string {
+	return strings.ToLower(strings.TrimSpace(env) + "-" + strings.TrimSpace(tier))
+}
+
+//Carve splits an IPv4 cidr into the first n of its equal power of two parts, each at least a /28.
+func Carve(cidr string, n int) ([]string, error) {
+
+	ip, block, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return nil, err
+	}
+	if ip.To4() == nil {
+		return nil, errors.New("only IPv4 CIDRs are supported")
+	}
+	if !ip.Equal(block.IP) {
+		return nil, fmt.Errorf("%s is not the first address of its block, use %s", cidr, block)
+	}
+	ones, _ := block.Mask.Size()
+	extra := bits.Len(uint(n - 1))
+	if ones < 16 || ones+extra > 28 {
+		return nil, fmt.Errorf("cidr %s must be between a /16 and a /%d to hold %d subnets", cidr, 28-extra, n)
+	}
+	size := uint32(1) << uint(32-ones-extra)
+	base := uint32(block.IP[0])<<24 | uint32(block.IP[1])<<16 | uint32(block.IP[2])<<8 | uint32(block.IP[3])
+	subnets := make([]string, n)
+	for i := range subnets {
+		start := base + uint32(i)*size
+		subnets[i] = fmt.Sprintf("%d.%d.%d.%d/%d", byte(start>>24), byte(start>>16), byte(start>>8), byte(start), ones+extra)
+	}
+	return subnets, nil
+}
+
+//Config returns the config environment placing every tier of env in the named network and subnets of provider.
+func Config(provider, region, resourceGroup, network string, subnets []Subnet) config.Environment {
+
+	env := make(config.Environment, len(subnets))
+	for _, s := range subnets {
+		env[s.Tier] = config.Tier{provider: config.Network{
+			Region:        region,
+			Network:       network,
+			Subnet:        s.Name,
+			SecurityGroup: s.SecurityGroup,
+			ResourceGroup: resourceGroup,
+		}}
+	}
+	return env
+}
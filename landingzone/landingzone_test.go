@@ -0,0 +1,62 @@
+package landingzone
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCarve(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		cidr    string
+		n       int
+		want    []string
+		wantErr bool
+	}{
+		{name: "three tiers of a /16", cidr: "10.1.0.0/16", n: 3, want: []string{"10.1.0.0/18", "10.1.64.0/18", "10.1.128.0/18"}},
+		{name: "four parts of a /24", cidr: "192.168.5.0/24", n: 4, want: []string{"192.168.5.0/26", "192.168.5.64/26", "192.168.5.128/26", "192.168.5.192/26"}},
+		{name: "two parts of a /20", cidr: "172.16.16.0/20", n: 2, want: []string{"172.16.16.0/21", "172.16.24.0/21"}},
+		{name: "one part is the whole block", cidr: "10.0.0.0/24", n: 1, want: []string{"10.0.0.0/24"}},
+		{name: "smallest block for three tiers", cidr: "10.0.0.0/26", n: 3, want: []string{"10.0.0.0/28", "10.0.0.16/28", "10.0.0.32/28"}},
+		{name: "too small for three tiers", cidr: "10.0.0.0/27", n: 3, wantErr: true},
+		{name: "larger than a /16", cidr: "10.0.0.0/15", n: 3, wantErr: true},
+		{name: "not the first address", cidr: "10.1.2.3/16", n: 3, wantErr: true},
+		{name: "ipv6", cidr: "fd00::/48", n: 3, wantErr: true},
+		{name: "not a cidr", cidr: "10.0.0.0", n: 3, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Carve(tt.cidr, tt.n)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Carve(%q, %d) error = %v, wantErr %v", tt.cidr, tt.n, err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Carve(%q, %d) = %v, want %v", tt.cidr, tt.n, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRequestCheck(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		req     Request
+		wantErr bool
+	}{
+		{name: "valid", req: Request{Environment: "dev", CIDR: "10.1.0.0/16"}},
+		{name: "dashes and digits", req: Request{Environment: "dev-2", CIDR: "10.1.0.0/16"}},
+		{name: "upper case env", req: Request{Environment: "Dev", CIDR: "10.1.0.0/16"}, wantErr: true},
+		{name: "env starting with a digit", req: Request{Environment: "2dev", CIDR: "10.1.0.0/16"}, wantErr: true},
+		{name: "env too long", req: Request{Environment: "abcdefghijklmnopqrstu", CIDR: "10.1.0.0/16"}, wantErr: true},
+		{name: "bad cidr", req: Request{Environment: "dev", CIDR: "10.1.0.0/28"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.req.Check(); (err != nil) != tt.wantErr {
+				t.Errorf("Check() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
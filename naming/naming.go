@@ -0,0 +1,302 @@
+package naming
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+//ErrCollision is returned by Check when a name is already taken.
+var ErrCollision = errors.New("instance name already exists")
+
+//EnvCodes object holds the letters an environment contributes to a name.
+type EnvCodes struct {
+	Code  string `json:"code"`
+	Stage string `json:"stage"`
+}
+
+//ProviderRules object holds a provider's name prefix and naming constraints.
+type ProviderRules struct {
+	Prefix string `json:"prefix"`
+	Site   string `json:"site"`
+	//Sites overrides Site for an environment and OS code, keyed "<env>/<os code>".
+	Sites            map[string]string `json:"sites,omitempty"`
+	MaxLength        int               `json:"maxLength"`
+	WindowsMaxLength int               `json:"windowsMaxLength,omitempty"`
+	Charset          string            `json:"charset"`
+}
+
+//Config object is the declarative naming convention.
+type Config struct {
+	Template     string                   `json:"template"`
+	Sequence     string                   `json:"sequence"`
+	Environments map[string]EnvCodes      `json:"environments"`
+	OS           map[string]string        `json:"os"`
+	Providers    map[string]ProviderRules `json:"providers"`
+}
+
+//DefaultConfig returns the naming standard the servers have always used,
+//base linux servers on aws and gcp keeping the w site code they have always been named with.
+func DefaultConfig() Config {
+	linux := "x"
+	return Config{
+		Template: "{prefix}{env}{os}{site}{stage}{app}",
+		Sequence: "%02d",
+		Environments: map[string]EnvCodes{
+			"base":    {Code: "b", Stage: "d"},
+			"prod":    {Code: "p", Stage: "p"},
+			"dev":     {Code: "s", Stage: "d"},
+			"nonprod": {Code: "s", Stage: "d"},
+		},
+		OS: map[string]string{
+			"windows": "w",
+			"redhat":  linux,
+			"centos":  linux,
+			"suse":    linux,
+			"debian":  linux,
+			"ubuntu":  linux,
+			"amazon":  linux,
+		},
+		Providers: map[string]ProviderRules{
+			"aws": {Prefix: "aws", Site: "e", Sites: map[string]string{"base/" + linux: "w"}, MaxLength: 255, Charset: `^[\x20-\x7e]+$`},
+			"gcp": {Prefix: "gcp", Site: "e", Sites: map[string]string{"base/" + linux: "w"}, MaxLength: 63,
+				Charset: `^[a-z]([-a-z0-9]*[a-z0-9])?$`},
+			"azure": {Prefix: "az", Site: "w", MaxLength: 64, WindowsMaxLength: 15,
+				Charset: `^[a-zA-Z0-9]([-a-zA-Z0-9]*[a-zA-Z0-9])?$`},
+		},
+	}
+}
+
+var placeholder = regexp.MustCompile(`\{(\w+)\}`)
+
+var knownPlaceholders = map[string]bool{"prefix": true, "env": true, "os": true, "site": true, "stage": true, "app": true}
+
+//Namer generates and validates instance names from a Config.
+type Namer struct {
+	cfg      Config
+	charset  map[string]*regexp.Regexp
+	mu       sync.Mutex
+	reserved map[string]bool
+}
+
+//New returns a Namer for cfg or an error if cfg is invalid.
+func New(cfg Config) (*Namer, error) {
+
+	if cfg.Template == "" {
+		return nil, errors.New("naming template must not be empty")
+	}
+	for _, m := range placeholder.FindAllStringSubmatch(cfg.Template, -1) {
+		if !knownPlaceholders[m[1]] {
+			return nil, fmt.Errorf("unknown placeholder {%s} in naming template", m[1])
+		}
+	}
+	if cfg.Sequence == "" {
+		cfg.Sequence = "%02d"
+	}
+	n := &Namer{cfg: cfg, charset: make(map[string]*regexp.Regexp), reserved: make(map[string]bool)}
+	for name, rules := range cfg.Providers {
+		if rules.Charset == "" {
+			continue
+		}
+		re, err := regexp.Compile(rules.Charset)
+		if err != nil {
+			return nil, fmt.Errorf("invalid charset for %s: %w", name, err)
+		}
+		n.charset[name] = re
+	}
+	return n, nil
+}
+
+//Default returns a Namer for DefaultConfig.
+func Default() *Namer {
+	n, err := New(DefaultConfig())
+	if err != nil {
+		panic(err)
+	}
+	return n
+}
+
+//Load returns a Namer for the JSON config at path.
+func Load(path string) (*Namer, error) {
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	cfg := Config{}
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, err
+	}
+	return New(cfg)
+}
+
+//Prefix returns the name for the given provider, environment, OS and app code, without a sequence number.
+func (n *Namer) Prefix(provider, env, os, app string) (string, error) {
+
+	rules, ok := n.cfg.Providers[provider]
+	if !ok {
+		return "", fmt.Errorf("no naming rules for provider %s", provider)
+	}
+	env = strings.ToLower(strings.TrimSpace(env))
+	envCodes, ok := n.cfg.Environments[env]
+	if !ok {
+		return "", fmt.Errorf("instance name could not be generated for environment %q", env)
+	}
+	osCode, ok := n.cfg.OS[strings.ToLower(strings.TrimSpace(os))]
+	if !ok {
+		return "", fmt.Errorf("instance name could not be generated for OS %q", os)
+	}
+	site := rules.Site
+	if override, ok := rules.Sites[env+"/"+osCode]; ok {
+		site = override
+	}
+	values := map[string]string{
+		"prefix": rules.Prefix,
+		"env":    envCodes.Code,
+		"os":     osCode,
+		"site":   site,
+		"stage":  envCodes.Stage,
+		"app":    app,
+	}
+	return placeholder.ReplaceAllStringFunc(n.cfg.Template, func(m string) string {
+		return values[m[1:len(m)-1]]
+	}), nil
+}
+
+//Name returns the prefix followed by seq, validated against the provider rules.
+func (n *Namer) Name(provider, env, os, app string, seq int) (string, error) {
+
+	prefix, err := n.Prefix(provider, env, os, app)
+	if err != nil {
+		return "", err
+	}
+	name := prefix + fmt.Sprintf(n.cfg.Sequence, seq)
+	if err := n.Validate(provider, os, name); err != nil {
+		return "", err
+	}
+	return name, nil
+}
+
+//Validate checks name against the provider's length and charset rules.
+func (n *Namer) Validate(provider, os, name string) error {
+
+	rules, ok := n.cfg.Providers[provider]
+	if !ok {
+		return fmt.Errorf("no naming rules for provider %s", provider)
+	}
+	max := rules.MaxLength
+	if strings.EqualFold(os, "windows") && rules.WindowsMaxLength > 0 {
+		max = rules.WindowsMaxLength
+	}
+	if max > 0 && len(name) > max {
+		return fmt.Errorf("instance name %s is longer than %d characters allowed on %s", name, max, provider)
+	}
+	if re, ok := n.charset[provider]; ok && !re.MatchString(name) {
+		return fmt.Errorf("instance name %s does not match %s naming rules %s", name, provider, rules.Charset)
+	}
+	return nil
+}
+
+//Checker reports whether an instance name is already in use.
+type Checker interface {
+	Exists(ctx context.Context, name string) (bool, error)
+}
+
+//Check returns ErrCollision if any of names already exists according to c.
+func Check(ctx context.Context, c Checker, names ...string) error {
+	_, _, err := Available(ctx, c, false, names...)
+	return err
+}
+
+//Available splits names into the free ones and the ones that already exist according to c.
+//Existing names are an ErrCollision unless resume is set, i.e when a request is retried.
+func Available(ctx context.Context, c Checker, resume bool, names ...string) (free, taken []string, err error) {
+
+	free, taken = make([]string, 0, len(names)), make([]string, 0)
+	for _, name := range names {
+		exists, err := c.Exists(ctx, name)
+		if err != nil {
+			return nil, nil, err
+		}
+		if exists {
+			taken = append(taken, name)
+			continue
+		}
+		free = append(free, name)
+	}
+	if len(taken) > 0 && !resume {
+		return nil, nil, fmt.Errorf("%w: %s", ErrCollision, strings.Join(taken, ", "))
+	}
+	return free, taken, nil
+}
+
+//Lister returns the names of existing instances starting with prefix.
+type Lister interface {
+	NamesWithPrefix(ctx context.Context, prefix string) ([]string, error)
+}
+
+//sequence returns the sequence number name carries after prefix.
+func (n *Namer) sequence(prefix, name string) (int, bool) {
+
+	if len(name) <= len(prefix) || !strings.EqualFold(name[:len(prefix)], prefix) {
+		return 0, false
+	}
+	rest := name[len(prefix):]
+	//the digits are read past the width of the sequence format, which only pads them.
+	head := strings.TrimRight(rest, "0123456789")
+	seq, err := strconv.Atoi(rest[len(head):])
+	if err != nil || fmt.Sprintf(n.cfg.Sequence, seq) != rest {
+		return 0, false
+	}
+	return seq, true
+}
+
+//Allocate returns count names numbered after the highest sequence number l reports for the prefix.
+//The names stay reserved until release is called, so concurrent requests never get the same names.
+func (n *Namer) Allocate(ctx context.Context, l Lister, provider, env, os, app string, count int) (names []string, release func(), err error) {
+
+	prefix, err := n.Prefix(provider, env, os, app)
+	if err != nil {
+		return nil, nil, err
+	}
+	existing, err := l.NamesWithPrefix(ctx, prefix)
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not list instances named %s: %w", prefix, err)
+	}
+	next := 1
+	for _, name := range existing {
+		if seq, ok := n.sequence(prefix, name); ok && seq >= next {
+			next = seq + 1
+		}
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	names = make([]string, 0, count)
+	for seq := next; len(names) < count; seq++ {
+		name, err := n.Name(provider, env, os, app, seq)
+		if err != nil {
+			return nil, nil, err
+		}
+		if n.reserved[strings.ToLower(name)] {
+			continue
+		}
+		names = append(names, name)
+	}
+	for _, name := range names {
+		n.reserved[strings.ToLower(name)] = true
+	}
+	release = func() {
+		n.mu.Lock()
+		defer n.mu.Unlock()
+		for _, name := range names {
+			delete(n.reserved, strings.ToLower(name))
+		}
+	}
+	return names, release, nil
+}
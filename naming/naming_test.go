@@ -0,0 +1,170 @@
+package naming
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestPrefix(t *testing.T) {
+
+	tests := []struct {
+		name, provider, env, os, app string
+		want                         string
+		wantErr                      bool
+	}{
+		{name: "aws base linux keeps the w site", provider: "aws", env: "base", os: "redhat", app: "abc", want: "awsbxwdabc"},
+		{name: "gcp base linux keeps the w site", provider: "gcp", env: "base", os: "ubuntu", app: "abc", want: "gcpbxwdabc"},
+		{name: "aws base windows", provider: "aws", env: "base", os: "windows", app: "abc", want: "awsbwedabc"},
+		{name: "gcp prod linux", provider: "gcp", env: "prod", os: "redhat", app: "abc", want: "gcppxepabc"},
+		{name: "gcp dev linux", provider: "gcp", env: "dev", os: "suse", app: "abc", want: "gcpsxedabc"},
+		{name: "azure nonprod windows", provider: "azure", env: "nonprod", os: "windows", app: "abc", want: "azswwdabc"},
+		{name: "env and os are case insensitive", provider: "azure", env: " Prod", os: "RedHat ", app: "abc", want: "azpxwpabc"},
+		{name: "unknown env", provider: "aws", env: "qa", os: "redhat", app: "abc", wantErr: true},
+		{name: "unknown os", provider: "aws", env: "prod", os: "beos", app: "abc", wantErr: true},
+		{name: "unknown provider", provider: "oci", env: "prod", os: "redhat", app: "abc", wantErr: true},
+	}
+	n := Default()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := n.Prefix(tt.provider, tt.env, tt.os, tt.app)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Prefix() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Prefix() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestName(t *testing.T) {
+
+	tests := []struct {
+		name, provider, os, app string
+		seq                     int
+		want                    string
+		wantErr                 bool
+	}{
+		{name: "two digit sequence", provider: "aws", os: "redhat", app: "abc", seq: 3, want: "awsbxwdabc03"},
+		{name: "three digit sequence", provider: "gcp", os: "redhat", app: "abc", seq: 120, want: "gcpbxwdabc120"},
+		{name: "windows name too long for azure", provider: "azure", os: "windows", app: "verylongapp", seq: 1, wantErr: true},
+		{name: "linux name within azure limit", provider: "azure", os: "redhat", app: "verylongapp", seq: 1, want: "azbxwdverylongapp01"},
+		{name: "gcp charset rejects upper case", provider: "gcp", os: "redhat", app: "ABC", seq: 1, wantErr: true},
+	}
+	n := Default()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := n.Name(tt.provider, "base", tt.os, tt.app, tt.seq)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Name() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Name() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSequence(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		want    int
+		wantOK  bool
+		comment string
+	}{
+		{name: "awsbxwdabc07", want: 7, wantOK: true},
+		{name: "AWSBXWDABC03", want: 3, wantOK: true, comment: "prefix is case insensitive"},
+		{name: "awsbxwdabc120", want: 120, wantOK: true},
+		{name: "awsbxwdabc7", comment: "not zero padded"},
+		{name: "awsbxwdabc07x", comment: "trailing characters"},
+		{name: "awsbxwdabc", comment: "no sequence"},
+		{name: "awsbxwdab", comment: "shorter than prefix"},
+		{name: "gcpbxwdabc01", comment: "other prefix"},
+	}
+	n := Default()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := n.sequence("awsbxwdabc", tt.name)
+			if ok != tt.wantOK || got != tt.want {
+				t.Errorf("sequence(%q) = %d, %v, want %d, %v %s", tt.name, got, ok, tt.want, tt.wantOK, tt.comment)
+			}
+		})
+	}
+}
+
+type fakeLister struct {
+	names []string
+	err   error
+}
+
+func (f fakeLister) NamesWithPrefix(ctx context.Context, prefix string) ([]string, error) {
+	return f.names, f.err
+}
+
+func TestAllocate(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		existing []string
+		count    int
+		want     []string
+		wantErr  bool
+	}{
+		{name: "first names", count: 2, want: []string{"awsbxwdabc01", "awsbxwdabc02"}},
+		{name: "after the highest sequence", existing: []string{"awsbxwdabc01", "awsbxwdabc03"}, count: 2,
+			want: []string{"awsbxwdabc04", "awsbxwdabc05"}},
+		{name: "ignores names of other sequences", existing: []string{"awsbxwdabc7", "awsbxwdabc02-old"}, count: 1,
+			want: []string{"awsbxwdabc01"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, release, err := Default().Allocate(context.Background(), fakeLister{names: tt.existing}, "aws", "base", "redhat", "abc", tt.count)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Allocate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			defer release()
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Allocate() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAllocateReservesNames(t *testing.T) {
+
+	n := Default()
+	l := fakeLister{names: []string{"awsbxwdabc01"}}
+	first, release, err := n.Allocate(context.Background(), l, "aws", "base", "redhat", "abc", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, releaseSecond, err := n.Allocate(context.Background(), l, "aws", "base", "redhat", "abc", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer releaseSecond()
+	if want := []string{"awsbxwdabc04"}; !reflect.DeepEqual(second, want) {
+		t.Errorf("Allocate() while %v are reserved = %v, want %v", first, second, want)
+	}
+	release()
+	third, releaseThird, err := n.Allocate(context.Background(), l, "aws", "base", "redhat", "abc", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer releaseThird()
+	if want := []string{"awsbxwdabc02"}; !reflect.DeepEqual(third, want) {
+		t.Errorf("Allocate() after release = %v, want %v", third, want)
+	}
+}
+
+func TestAllocateListError(t *testing.T) {
+
+	boom := errors.New("boom")
+	_, _, err := Default().Allocate(context.Background(), fakeLister{err: boom}, "aws", "base", "redhat", "abc", 1)
+	if !errors.Is(err, boom) {
+		t.Errorf("Allocate() error = %v, want %v", err, boom)
+	}
+}
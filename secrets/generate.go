@@ -0,0 +1,91 @@
+package secrets
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/pem"
+	"errors"
+	"math/big"
+)
+
+const (
+	lower   = "abcdefghijkmnopqrstuvwxyz"
+	upper   = "ABCDEFGHJKLMNPQRSTUVWXYZ"
+	digits  = "23456789"
+	special = "!@#%^*-_=+"
+)
+
+//GeneratePassword returns a random password of length characters with at least one lower, upper, digit and special character.
+func GeneratePassword(length int) (string, error) {
+
+	if length < 12 {
+		return "", errors.New("password length must be at least 12")
+	}
+	classes := []string{lower, upper, digits, special}
+	all := lower + upper + digits + special
+	pw := make([]byte, length)
+	for i := range pw {
+		set := all
+		if i < len(classes) {
+			set = classes[i]
+		}
+		c, err := randIndex(len(set))
+		if err != nil {
+			return "", err
+		}
+		pw[i] = set[c]
+	}
+	//shuffle so the guaranteed classes are not always up front.
+	for i := len(pw) - 1; i > 0; i-- {
+		j, err := randIndex(i + 1)
+		if err != nil {
+			return "", err
+		}
+		pw[i], pw[j] = pw[j], pw[i]
+	}
+	return string(pw), nil
+}
+
+func randIndex(n int) (int, error) {
+	v, err := rand.Int(rand.Reader, big.NewInt(int64(n)))
+	if err != nil {
+		return 0, err
+	}
+	return int(v.Int64()), nil
+}
+
+//GenerateSSHKey returns a new RSA private key in PEM and its public key in authorized_keys format.
+func GenerateSSHKey(bits int) (privatePEM, authorizedKey string, err error) {
+
+	key, err := rsa.GenerateKey(rand.Reader, bits)
+	if err != nil {
+		return "", "", err
+	}
+	block := &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}
+	return string(pem.EncodeToMemory(block)), AuthorizedKey(&key.PublicKey), nil
+}
+
+//AuthorizedKey formats an RSA public key as an ssh-rsa authorized_keys line.
+func AuthorizedKey(pub *rsa.PublicKey) string {
+
+	e := big.NewInt(int64(pub.E)).Bytes()
+	wire := make([]byte, 0)
+	for _, field := range [][]byte{[]byte("ssh-rsa"), mpint(e), mpint(pub.N.Bytes())} {
+		size := make([]byte, 4)
+		binary.BigEndian.PutUint32(size, uint32(len(field)))
+		wire = append(wire, size...)
+		wire = append(wire, field...)
+	}
+	return "ssh-rsa " + base64.StdEncoding.EncodeToString(wire)
+}
+
+//mpint prefixes b with a zero byte when its high bit is set, as the SSH wire format requires.
+func mpint(b []byte) []byte {
+	if len(b) > 0 && b[0]&0x80 != 0 {
+		return append([]byte{0}, b...)
+	}
+	return b
+}
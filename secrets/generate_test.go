@@ -0,0 +1,108 @@
+package secrets
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/pem"
+	"math/big"
+	"strings"
+	"testing"
+)
+
+func TestGeneratePassword(t *testing.T) {
+
+	tests := []struct {
+		length  int
+		wantErr bool
+	}{
+		{length: 11, wantErr: true},
+		{length: 0, wantErr: true},
+		{length: 12},
+		{length: 24},
+		{length: 64},
+	}
+	for _, tt := range tests {
+		for i := 0; i < 50; i++ {
+			pw, err := GeneratePassword(tt.length)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("GeneratePassword(%d) error = %v, wantErr %v", tt.length, err, tt.wantErr)
+			}
+			if tt.wantErr {
+				break
+			}
+			if len(pw) != tt.length {
+				t.Fatalf("GeneratePassword(%d) = %q, %d characters", tt.length, pw, len(pw))
+			}
+			for _, class := range []string{lower, upper, digits, special} {
+				if !strings.ContainsAny(pw, class) {
+					t.Fatalf("GeneratePassword(%d) = %q, no character of %q", tt.length, pw, class)
+				}
+			}
+			for _, c := range pw {
+				if !strings.ContainsRune(lower+upper+digits+special, c) {
+					t.Fatalf("GeneratePassword(%d) = %q, unexpected %q", tt.length, pw, c)
+				}
+			}
+		}
+	}
+}
+
+//wireFields splits an SSH wire format blob into its length prefixed fields.
+func wireFields(t *testing.T, wire []byte) [][]byte {
+	fields := make([][]byte, 0)
+	for len(wire) > 0 {
+		if len(wire) < 4 {
+			t.Fatalf("truncated length in %x", wire)
+		}
+		size := binary.BigEndian.Uint32(wire)
+		if uint32(len(wire)-4) < size {
+			t.Fatalf("truncated field of %d bytes", size)
+		}
+		fields = append(fields, wire[4:4+size])
+		wire = wire[4+size:]
+	}
+	return fields
+}
+
+func TestGenerateSSHKey(t *testing.T) {
+
+	private, authorized, err := GenerateSSHKey(1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, rest := pem.Decode([]byte(private))
+	if block == nil || block.Type != "RSA PRIVATE KEY" || len(bytes.TrimSpace(rest)) != 0 {
+		t.Fatalf("private key is not a single RSA PEM block: %q", private)
+	}
+	key, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key.N.BitLen() != 1024 {
+		t.Errorf("key has %d bits, want 1024", key.N.BitLen())
+	}
+	parts := strings.Fields(authorized)
+	if len(parts) != 2 || parts[0] != "ssh-rsa" {
+		t.Fatalf("authorized key = %q, want ssh-rsa and the key", authorized)
+	}
+	wire, err := base64.StdEncoding.DecodeString(parts[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	fields := wireFields(t, wire)
+	if len(fields) != 3 || string(fields[0]) != "ssh-rsa" {
+		t.Fatalf("authorized key has fields %q", fields)
+	}
+	if e := new(big.Int).SetBytes(fields[1]); e.Int64() != int64(key.E) {
+		t.Errorf("exponent = %s, want %d", e, key.E)
+	}
+	//the modulus has its high bit set, so it is prefixed by a zero byte to stay positive.
+	if fields[2][0] != 0 || new(big.Int).SetBytes(fields[2]).Cmp(key.N) != 0 {
+		t.Errorf("modulus does not match the private key")
+	}
+	if _, other, _ := GenerateSSHKey(1024); other == authorized {
+		t.Error("two generated keys are the same")
+	}
+}
@@ -0,0 +1,108 @@
+package secrets
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+//ErrNotFound is returned by Get when a reference does not resolve.
+var ErrNotFound = errors.New("secret not found")
+
+//Store keeps secrets and hands out references to them.
+type Store interface {
+	//Put stores value under name and returns a reference to it.
+	Put(ctx context.Context, name string, value []byte) (string, error)
+	//Get returns the secret a reference points to.
+	Get(ctx context.Context, ref string) ([]byte, error)
+	//Delete removes the secret a reference points to, deleting one that does not exist is not an error.
+	Delete(ctx context.Context, ref string) error
+}
+
+//Open returns the Store described by spec, i.e "file:/var/lib/go-cloud/secrets" or "vault:http://127.0.0.1:8200".
+func Open(spec string) (Store, error) {
+
+	kind, arg := spec, ""
+	if i := strings.Index(spec, ":"); i >= 0 {
+		kind, arg = spec[:i], spec[i+1:]
+	}
+	switch kind {
+	case "file":
+		return NewFileStore(arg)
+	case "vault":
+		token := os.Getenv("VAULT_TOKEN")
+		if token == "" {
+			return nil, errors.New("VAULT_TOKEN must be set to use the vault secret backend")
+		}
+		return NewVaultStore(arg, token, "secret"), nil
+	}
+	return nil, fmt.Errorf("unknown secret backend %q, use file: or vault:", kind)
+}
+
+//FileStore keeps every secret in its own 0600 file under a directory.
+type FileStore struct {
+	dir string
+}
+
+//NewFileStore returns a FileStore rooted at dir, creating it if needed.
+func NewFileStore(dir string) (*FileStore, error) {
+	if dir == "" {
+		return nil, errors.New("file secret backend needs a directory")
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &FileStore{dir: dir}, nil
+}
+
+//Put writes value to a file named after name.
+func (s *FileStore) Put(ctx context.Context, name string, value []byte) (string, error) {
+	path, err := s.path(name)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return "", err
+	}
+	if err := ioutil.WriteFile(path, value, 0600); err != nil {
+		return "", err
+	}
+	return "file:" + name, nil
+}
+
+//Get reads the file ref points to.
+func (s *FileStore) Get(ctx context.Context, ref string) ([]byte, error) {
+	path, err := s.path(strings.TrimPrefix(ref, "file:"))
+	if err != nil {
+		return nil, err
+	}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	return data, err
+}
+
+//Delete removes the file ref points to.
+func (s *FileStore) Delete(ctx context.Context, ref string) error {
+	path, err := s.path(strings.TrimPrefix(ref, "file:"))
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (s *FileStore) path(name string) (string, error) {
+	clean := filepath.Clean("/" + name)
+	if clean == "/" {
+		return "", errors.New("secret name must not be empty")
+	}
+	return filepath.Join(s.dir, clean), nil
+}
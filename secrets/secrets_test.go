@@ -0,0 +1,106 @@
+package secrets
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFileStore(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "secrets")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	s, err := NewFileStore(filepath.Join(dir, "store"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	ref, err := s.Put(ctx, "azure/rg/vm1/admin", []byte("s3cret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ref != "file:azure/rg/vm1/admin" {
+		t.Errorf("ref = %q", ref)
+	}
+	for path, want := range map[string]os.FileMode{
+		"store":                    0700,
+		"store/azure/rg":           0700,
+		"store/azure/rg/vm1/admin": 0600,
+	} {
+		info, err := os.Stat(filepath.Join(dir, path))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := info.Mode().Perm(); got != want {
+			t.Errorf("%s has mode %s, want %s", path, got, want)
+		}
+	}
+	if got, err := s.Get(ctx, ref); err != nil || string(got) != "s3cret" {
+		t.Errorf("Get(%q) = %q, %v", ref, got, err)
+	}
+	if err := s.Delete(ctx, ref); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Get(ctx, ref); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get after Delete error = %v, want ErrNotFound", err)
+	}
+	if err := s.Delete(ctx, ref); err != nil {
+		t.Errorf("deleting a missing secret: %v", err)
+	}
+}
+
+func TestFileStoreStaysInItsDirectory(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "secrets")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	s, err := NewFileStore(filepath.Join(dir, "store"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if _, err := s.Put(ctx, "../../outside", []byte("x")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "store", "outside")); err != nil {
+		t.Errorf("secret was not kept in the store: %v", err)
+	}
+	for _, name := range []string{"", "/", ".."} {
+		if _, err := s.Put(ctx, name, []byte("x")); err == nil {
+			t.Errorf("Put(%q) succeeded", name)
+		}
+	}
+}
+
+func TestOpen(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "secrets")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	os.Setenv("VAULT_TOKEN", "")
+	tests := []struct {
+		spec    string
+		wantErr bool
+	}{
+		{spec: "file:" + dir},
+		{spec: "file:", wantErr: true},
+		{spec: "vault:http://127.0.0.1:8200", wantErr: true},
+		{spec: "env:", wantErr: true},
+		{spec: "s3:bucket", wantErr: true},
+	}
+	for _, tt := range tests {
+		if _, err := Open(tt.spec); (err != nil) != tt.wantErr {
+			t.Errorf("Open(%q) error = %v, wantErr %v", tt.spec, err, tt.wantErr)
+		}
+	}
+}
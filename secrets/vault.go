@@ -0,0 +1,181 @@
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+type vaultData struct {
+	Data map[string]string `json:"data"`
+}
+
+type vaultResponse struct {
+	Data vaultData `json:"data"`
+}
+
+//VaultStore keeps secrets in a HashiCorp Vault KV version 2 mount.
+type VaultStore struct {
+	Addr   string
+	Token  string
+	Mount  string
+	Client *http.Client
+}
+
+//NewVaultStore returns a VaultStore for the KV v2 mount at addr.
+func NewVaultStore(addr, token, mount string) *VaultStore {
+	return &VaultStore{
+		Addr:   strings.TrimSuffix(addr, "/"),
+		Token:  token,
+		Mount:  mount,
+		Client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (s *VaultStore) url(name string) string {
+	return fmt.Sprintf("%s/v1/%s/data/%s", s.Addr, s.Mount, strings.TrimPrefix(name, "/"))
+}
+
+//name returns the secret name ref points to.
+func (s *VaultStore) name(ref string) string {
+	return strings.TrimPrefix(strings.TrimPrefix(ref, "vault:"), s.Mount+"/")
+}
+
+//Put writes value to the "value" key of the secret at name.
+func (s *VaultStore) Put(ctx context.Context, name string, value []byte) (string, error) {
+
+	body, err := json.Marshal(vaultData{Data: map[string]string{"value": string(value)}})
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequest(http.MethodPost, s.url(name), bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-Vault-Token", s.Token)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := s.Client.Do(req.WithContext(ctx))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return "", fmt.Errorf("vault returned %s storing %s", resp.Status, name)
+	}
+	return "vault:" + s.Mount + "/" + name, nil
+}
+
+//Get reads the "value" key of the secret ref points to.
+func (s *VaultStore) Get(ctx context.Context, ref string) ([]byte, error) {
+
+	name := s.name(ref)
+	req, err := http.NewRequest(http.MethodGet, s.url(name), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Vault-Token", s.Token)
+	resp, err := s.Client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, ErrNotFound
+	}
+	if resp.StatusCode/100 != 2 {
+		return nil, fmt.Errorf("vault returned %s reading %s", resp.Status, name)
+	}
+	secret := vaultResponse{}
+	if err := json.NewDecoder(resp.Body).Decode(&secret); err != nil {
+		return nil, err
+	}
+	value, ok := secret.Data.Data["value"]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return []byte(value), nil
+}
+
+//Delete removes every version of the secret ref points to through its metadata, so nothing can be undeleted.
+func (s *VaultStore) Delete(ctx context.Context, ref string) error {
+
+	name := s.name(ref)
+	url := fmt.Sprintf("%s/v1/%s/metadata/%s", s.Addr, s.Mount, strings.TrimPrefix(name, "/"))
+	req, err := http.NewRequest(http.MethodDelete, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("X-Vault-Token", s.Token)
+	resp, err := s.Client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 && resp.StatusCode != http.StatusNotFound {
+		return fmt.Errorf("vault returned %s deleting %s", resp.Status, name)
+	}
+	return nil
+}
+
+//VaultStub is an in-memory stand-in for the Vault KV v2 API, meant for local development only.
+type VaultStub struct {
+	Token string
+	mu    sync.RWMutex
+	data  map[string]map[string]string
+}
+
+//NewVaultStub returns a VaultStub accepting the given token.
+func NewVaultStub(token string) *VaultStub {
+	return &VaultStub{Token: token, data: make(map[string]map[string]string)}
+}
+
+//ServeHTTP serves GET and POST/PUT on /v1/{mount}/data/{path} and DELETE on /v1/{mount}/metadata/{path}.
+func (v *VaultStub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+
+	if r.Header.Get("X-Vault-Token") != v.Token {
+		http.Error(w, `{"errors":["permission denied"]}`, http.StatusForbidden)
+		return
+	}
+	path := strings.TrimPrefix(r.URL.Path, "/v1/")
+	if r.Method == http.MethodDelete && strings.Contains(path, "/metadata/") {
+		v.mu.Lock()
+		delete(v.data, strings.Replace(path, "/metadata/", "/data/", 1))
+		v.mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if !strings.Contains(path, "/data/") {
+		http.NotFound(w, r)
+		return
+	}
+	switch r.Method {
+	case http.MethodPost, http.MethodPut:
+		secret := vaultData{}
+		if err := json.NewDecoder(r.Body).Decode(&secret); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		v.mu.Lock()
+		v.data[path] = secret.Data
+		v.mu.Unlock()
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"data":{"version":1}}`))
+	case http.MethodGet:
+		v.mu.RLock()
+		data, ok := v.data[path]
+		v.mu.RUnlock()
+		if !ok {
+			http.Error(w, `{"errors":[]}`, http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(vaultResponse{Data: vaultData{Data: data}})
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,61 @@
+package secrets
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestVaultStoreWithStub(t *testing.T) {
+
+	server := httptest.NewServer(NewVaultStub("token"))
+	defer server.Close()
+	s := NewVaultStore(server.URL+"/", "token", "secret")
+	ctx := context.Background()
+	ref, err := s.Put(ctx, "keys/deploy", []byte("private"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ref != "vault:secret/keys/deploy" {
+		t.Errorf("ref = %q", ref)
+	}
+	if got, err := s.Get(ctx, ref); err != nil || string(got) != "private" {
+		t.Errorf("Get(%q) = %q, %v", ref, got, err)
+	}
+	if _, err := s.Put(ctx, "keys/deploy", []byte("rotated")); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := s.Get(ctx, ref); err != nil || string(got) != "rotated" {
+		t.Errorf("Get after overwrite = %q, %v", got, err)
+	}
+	if _, err := s.Get(ctx, "vault:secret/keys/other"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get of a missing secret error = %v, want ErrNotFound", err)
+	}
+	if err := s.Delete(ctx, ref); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Get(ctx, ref); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get after Delete error = %v, want ErrNotFound", err)
+	}
+	if err := s.Delete(ctx, ref); err != nil {
+		t.Errorf("deleting a missing secret: %v", err)
+	}
+}
+
+func TestVaultStubRejectsOtherTokens(t *testing.T) {
+
+	server := httptest.NewServer(NewVaultStub("token"))
+	defer server.Close()
+	s := NewVaultStore(server.URL, "wrong", "secret")
+	ctx := context.Background()
+	if _, err := s.Put(ctx, "keys/deploy", []byte("private")); err == nil {
+		t.Error("Put with a wrong token succeeded")
+	}
+	if _, err := s.Get(ctx, "vault:secret/keys/deploy"); err == nil || errors.Is(err, ErrNotFound) {
+		t.Errorf("Get with a wrong token error = %v, want a permission error", err)
+	}
+	if err := s.Delete(ctx, "vault:secret/keys/deploy"); err == nil {
+		t.Error("Delete with a wrong token succeeded")
+	}
+}
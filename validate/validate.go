@@ -0,0 +1,310 @@
+package validate
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/shakilbd009/go-cloud/bootstrap"
+	"github.com/shakilbd009/go-cloud/cloud"
+	"github.com/shakilbd009/go-cloud/config"
+)
+
+//Error codes of a FieldError.
+const (
+	CodeRequired = "required"
+	CodeInvalid  = "invalid"
+	CodeRange    = "out_of_range"
+	CodeNotFound = "not_configured"
+)
+
+//FieldError object describes what is wrong with one request field.
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+//Errors is the list of field errors of a request.
+type Errors []FieldError
+
+//Error joins the field errors into one message.
+func (e Errors) Error() string {
+	msgs := make([]string, 0, len(e))
+	for _, fe := range e {
+		msgs = append(msgs, fe.Field+": "+fe.Message)
+	}
+	return strings.Join(msgs, "; ")
+}
+
+func (e *Errors) add(field, code, format string, args ...interface{}) {
+	*e = append(*e, FieldError{Field: field, Code: code, Message: fmt.Sprintf(format, args...)})
+}
+
+//Count modes of Rules.
+const (
+	//CountRange validates the countTO range, i.e "1-3".
+	CountRange = iota
+	//CountMinMax validates the min and max fields.
+	CountMinMax
+)
+
+//Rules object holds what a provider accepts in a request.
+type Rules struct {
+	Provider string
+	//OS maps each accepted OS to the accepted flavors, a flavor is accepted if it contains one of them. An empty list accepts any flavor.
+	OS                  map[string][]string
+	MaxDisks            int
+	MaxDiskGB           int64
+	CountMode           int
+	MaxCount            int
+	RequireInstanceType bool
+	//SizeField is the JSON field the instance size is passed in.
+	SizeField string
+	//Identity lists the JSON fields that identify existing instances for GET and DELETE.
+	Identity []string
+	//Lookup lists JSON fields GET accepts instead of Identity, any one of them is enough.
+	Lookup []string
+}
+
+var appCode = regexp.MustCompile(`^[a-z0-9]+$`)
+
+//resourceGroup matches the names azure accepts for resource groups, which also keeps them safe to use in secret paths.
+var resourceGroup = regexp.MustCompile(`^[-\w.()]{0,89}[-\w()]$`)
+
+//Provision checks a provisioning request against rules and the environments in cfg.
+func Provision(req cloud.Request, cfg *config.Config, rules Rules) Errors {
+
+	errs := make(Errors, 0)
+	if req.Environment == "" {
+		errs.add("env", CodeRequired, "env is required, use one of %s", strings.Join(cfg.EnvNames(rules.Provider), ", "))
+	} else if req.Tier == "" {
+		errs.add("tier", CodeRequired, "tier is required")
+	} else if _, err := cfg.Network(rules.Provider, req.Environment, req.Tier); err != nil {
+		field := "tier"
+		if _, ok := cfg.Environments[strings.ToLower(strings.TrimSpace(req.Environment))]; !ok {
+			field = "env"
+		}
+		errs.add(field, CodeNotFound, "%v", err)
+	}
+	if req.AppCode == "" {
+		errs.add("appCode", CodeRequired, "appCode is required")
+	} else if !appCode.MatchString(req.AppCode) {
+		errs.add("appCode", CodeInvalid, "appCode may only contain lower case letters and digits")
+	}
+	checkOS(&errs, req, rules)
+	checkDisks(&errs, req.Disks, rules)
+	checkCount(&errs, req, rules)
+	checkSize(&errs, req, cfg, rules)
+	if _, err := req.Timeout(); err != nil {
+		errs.add("waitTimeout", CodeInvalid, "%v", err)
+	}
+	switch req.Rollback {
+	case "", cloud.RollbackAll, cloud.RollbackKeepSuccessful, cloud.RollbackNone:
+	default:
+		errs.add("rollback", CodeInvalid, "rollback must be one of %s, %s or %s", cloud.RollbackAll, cloud.RollbackKeepSuccessful, cloud.RollbackNone)
+	}
+	if req.UserData != "" && req.Template != "" {
+		errs.add("template", CodeInvalid, "userData and template are mutually exclusive")
+	}
+	if err := bootstrap.Check(rules.Provider, req.Osname, req.UserData); err != nil {
+		errs.add("userData", CodeInvalid, "%v", err)
+	}
+	if req.SSHKey != "" && strings.EqualFold(req.Osname, "windows") {
+		errs.add("sshKey", CodeInvalid, "sshKey is only supported on linux")
+	}
+	if req.KeyName != "" && rules.Provider != "aws" {
+		errs.add("keyName", CodeInvalid, "keyName is only supported on aws, use sshKey")
+	} else if req.KeyName != "" && req.SSHKey != "" {
+		errs.add("keyName", CodeInvalid, "keyName and sshKey are mutually exclusive")
+	}
+	if rules.Provider == "azure" && req.RG == "" {
+		errs.add("resourceGroup", CodeRequired, "resourceGroup is required")
+	} else if rules.Provider == "azure" && !resourceGroup.MatchString(req.RG) {
+		errs.add("resourceGroup", CodeInvalid, "resourceGroup may only contain up to 90 letters, digits, underscores, hyphens, periods and parentheses and must not end with a period")
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+//Identity checks that a GET or DELETE request names the instances it targets.
+func Identity(req cloud.Request, rules Rules) Errors {
+
+	errs := make(Errors, 0)
+	for _, field := range rules.Identity {
+		if missing(req, field) {
+			errs.add(field, CodeRequired, "%s is required", field)
+		}
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+//Describe checks that a GET request passes one of the Lookup fields of rules, or its Identity fields if it has none.
+func Describe(req cloud.Request, rules Rules) Errors {
+
+	if len(rules.Lookup) == 0 {
+		return Identity(req, rules)
+	}
+	for _, field := range rules.Lookup {
+		if !missing(req, field) {
+			return nil
+		}
+	}
+	errs := make(Errors, 0, len(rules.Lookup))
+	for _, field := range rules.Lookup {
+		errs.add(field, CodeRequired, "one of %s is required", strings.Join(rules.Lookup, ", "))
+	}
+	return errs
+}
+
+func missing(req cloud.Request, field string) bool {
+	switch field {
+	case "instanceIds":
+		return len(req.InstanceIDs) == 0
+	case "instanceName":
+		return req.Instance == ""
+	case "vmName":
+		return req.VMname == "" && req.Instance == ""
+	case "resourceGroup":
+		return req.RG == ""
+	case "requestNum":
+		return req.ChangeNum == ""
+	}
+	return false
+}
+
+func checkOS(errs *Errors, req cloud.Request, rules Rules) {
+
+	osname := strings.ToLower(strings.TrimSpace(req.Osname))
+	accepted := make([]string, 0, len(rules.OS))
+	for name := range rules.OS {
+		accepted = append(accepted, name)
+	}
+	sort.Strings(accepted)
+	if osname == "" {
+		errs.add("os", CodeRequired, "os is required, use one of %s", strings.Join(accepted, ", "))
+		return
+	}
+	flavors, ok := rules.OS[osname]
+	if !ok {
+		errs.add("os", CodeInvalid, "%s is not supported on %s, use one of %s", req.Osname, rules.Provider, strings.Join(accepted, ", "))
+		return
+	}
+	flavor := strings.ToLower(strings.TrimSpace(req.OsFlavor))
+	if flavor == "" {
+		errs.add("flavor", CodeRequired, "flavor is required")
+		return
+	}
+	if len(flavors) == 0 {
+		return
+	}
+	for _, f := range flavors {
+		if strings.Contains(flavor, f) {
+			return
+		}
+	}
+	errs.add("flavor", CodeInvalid, "flavor %s of %s is not supported, use one of %s", req.OsFlavor, osname, strings.Join(flavors, ", "))
+}
+
+func checkSize(errs *Errors, req cloud.Request, cfg *config.Config, rules Rules) {
+
+	field := rules.SizeField
+	if field == "" {
+		field = "instanceType"
+	}
+	size := req.InstanceType
+	if req.MachineType != "" {
+		size = req.MachineType
+	}
+	if size == "" {
+		size = cfg.Provider(rules.Provider).InstanceType
+	}
+	if size == "" {
+		if rules.RequireInstanceType {
+			errs.add(field, CodeRequired, "%s is required", field)
+		}
+		return
+	}
+	allowed := cfg.Sizes(rules.Provider, req.Environment)
+	if len(allowed) == 0 {
+		return
+	}
+	for _, s := range allowed {
+		if strings.EqualFold(s, size) {
+			return
+		}
+	}
+	errs.add(field, CodeInvalid, "%s is not allowed in %s, use one of %s", size, req.Environment, strings.Join(allowed, ", "))
+}
+
+func checkDisks(errs *Errors, disks string, rules Rules) {
+
+	if strings.TrimSpace(disks) == "" {
+		errs.add("disks", CodeRequired, "disks is required, i.e 50gb,100gb")
+		return
+	}
+	list := strings.Split(disks, ",")
+	if rules.MaxDisks > 0 && len(list) > rules.MaxDisks {
+		errs.add("disks", CodeRange, "at most %d data disks are supported on %s", rules.MaxDisks, rules.Provider)
+	}
+	for i, v := range list {
+		v = strings.TrimSuffix(strings.ToLower(v), "gb")
+		size, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			errs.add(fmt.Sprintf("disks[%d]", i), CodeInvalid, "%q is not a size such as 100gb", list[i])
+			continue
+		}
+		if size < 1 || (rules.MaxDiskGB > 0 && size > rules.MaxDiskGB) {
+			errs.add(fmt.Sprintf("disks[%d]", i), CodeRange, "size must be between 1 and %d GB", rules.MaxDiskGB)
+		}
+	}
+}
+
+func checkCount(errs *Errors, req cloud.Request, rules Rules) {
+
+	switch rules.CountMode {
+	case CountRange:
+		if req.CountTO != "" && req.Count != 0 {
+			errs.add("count", CodeInvalid, "pass either countTO or count, not both")
+			return
+		}
+		if req.CountTO == "" && req.Count == 0 {
+			errs.add("count", CodeRequired, "count or countTO is required, i.e 3 or 1-3")
+			return
+		}
+		if req.CountTO == "" {
+			if req.Count < 1 || (rules.MaxCount > 0 && req.Count > rules.MaxCount) {
+				errs.add("count", CodeRange, "count must be between 1 and %d", rules.MaxCount)
+			}
+			return
+		}
+		start, end, err := cloud.ParseCount(req.CountTO)
+		if err != nil {
+			errs.add("countTO", CodeInvalid, "%v", err)
+			return
+		}
+		if start < 1 || start > 99 || end > 99 {
+			errs.add("countTO", CodeRange, "countTO must stay between 1 and 99")
+		}
+		if rules.MaxCount > 0 && end-start+1 > rules.MaxCount {
+			errs.add("countTO", CodeRange, "at most %d instances can be built per request", rules.MaxCount)
+		}
+	case CountMinMax:
+		if req.Min < 1 {
+			errs.add("min", CodeRange, "min must be at least 1")
+		}
+		if req.Max < req.Min {
+			errs.add("max", CodeRange, "max must be greater than or equal to min")
+		}
+		if rules.MaxCount > 0 && req.Max > int64(rules.MaxCount) {
+			errs.add("max", CodeRange, "at most %d instances can be built per request", rules.MaxCount)
+		}
+	}
+}
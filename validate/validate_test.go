@@ -0,0 +1,183 @@
+package validate
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/shakilbd009/go-cloud/cloud"
+	"github.com/shakilbd009/go-cloud/config"
+)
+
+var testConfig = &config.Config{
+	Providers: map[string]config.ProviderDefaults{
+		"gcp": {Region: "us-east1", InstanceType: "e2-small", Sizes: map[string][]string{
+			"*":    {"e2-small", "e2-medium"},
+			"prod": {"n2-standard-2"},
+		}},
+	},
+	Environments: map[string]config.Environment{
+		"dev":  {"web": {"gcp": {Network: "dev", Subnet: "web"}}},
+		"prod": {"web": {"gcp": {Network: "prod", Subnet: "web"}}},
+	},
+}
+
+var testRules = Rules{
+	Provider:  "gcp",
+	OS:        map[string][]string{"redhat": {"7", "8"}, "windows": {}},
+	MaxDisks:  2,
+	MaxDiskGB: 100,
+	CountMode: CountRange,
+	MaxCount:  5,
+	SizeField: "machineType",
+}
+
+func validRequest() cloud.Request {
+	return cloud.Request{
+		Environment: "dev",
+		Tier:        "web",
+		Osname:      "redhat",
+		OsFlavor:    "rhel-8",
+		Disks:       "50gb,100gb",
+		CountTO:     "1-3",
+		AppCode:     "abc",
+	}
+}
+
+//codes returns the field and code of every error, sorted.
+func codes(errs Errors) []string {
+	list := make([]string, 0, len(errs))
+	for _, fe := range errs {
+		list = append(list, fe.Field+"="+fe.Code)
+	}
+	sort.Strings(list)
+	return list
+}
+
+func TestProvision(t *testing.T) {
+
+	tests := []struct {
+		name   string
+		rules  func(*Rules)
+		change func(*cloud.Request)
+		want   []string
+	}{
+		{name: "valid", change: func(r *cloud.Request) {}},
+		{name: "missing env", change: func(r *cloud.Request) { r.Environment = "" }, want: []string{"env=required"}},
+		{name: "unknown env", change: func(r *cloud.Request) { r.Environment = "qa" }, want: []string{"env=not_configured"}},
+		{name: "missing tier", change: func(r *cloud.Request) { r.Tier = "" }, want: []string{"tier=required"}},
+		{name: "unknown tier", change: func(r *cloud.Request) { r.Tier = "db" }, want: []string{"tier=not_configured"}},
+		{name: "missing app code", change: func(r *cloud.Request) { r.AppCode = "" }, want: []string{"appCode=required"}},
+		{name: "upper case app code", change: func(r *cloud.Request) { r.AppCode = "ABC" }, want: []string{"appCode=invalid"}},
+		{name: "missing os", change: func(r *cloud.Request) { r.Osname = "" }, want: []string{"os=required"}},
+		{name: "unsupported os", change: func(r *cloud.Request) { r.Osname = "suse" }, want: []string{"os=invalid"}},
+		{name: "missing flavor", change: func(r *cloud.Request) { r.OsFlavor = "" }, want: []string{"flavor=required"}},
+		{name: "unsupported flavor", change: func(r *cloud.Request) { r.OsFlavor = "rhel-6" }, want: []string{"flavor=invalid"}},
+		{name: "any flavor of an os without a list", change: func(r *cloud.Request) { r.Osname, r.OsFlavor = "windows", "2019" }},
+		{name: "missing disks", change: func(r *cloud.Request) { r.Disks = " " }, want: []string{"disks=required"}},
+		{name: "too many disks", change: func(r *cloud.Request) { r.Disks = "10,20,30" }, want: []string{"disks=out_of_range"}},
+		{name: "disk not a size", change: func(r *cloud.Request) { r.Disks = "50gb,big" }, want: []string{"disks[1]=invalid"}},
+		{name: "disk too large", change: func(r *cloud.Request) { r.Disks = "500gb" }, want: []string{"disks[0]=out_of_range"}},
+		{name: "count and countTO", change: func(r *cloud.Request) { r.Count = 2 }, want: []string{"count=invalid"}},
+		{name: "no count", change: func(r *cloud.Request) { r.CountTO = "" }, want: []string{"count=required"}},
+		{name: "count over the max", change: func(r *cloud.Request) { r.CountTO, r.Count = "", 6 }, want: []string{"count=out_of_range"}},
+		{name: "countTO not a range", change: func(r *cloud.Request) { r.CountTO = "3" }, want: []string{"countTO=invalid"}},
+		{name: "countTO over the max", change: func(r *cloud.Request) { r.CountTO = "1-6" }, want: []string{"countTO=out_of_range"}},
+		{name: "countTO past 99", change: func(r *cloud.Request) { r.CountTO = "98-100" }, want: []string{"countTO=out_of_range"}},
+		{name: "min and max", rules: func(r *Rules) { r.CountMode = CountMinMax },
+			change: func(r *cloud.Request) { r.CountTO, r.Min, r.Max = "", 2, 1 }, want: []string{"max=out_of_range"}},
+		{name: "size not allowed in env", change: func(r *cloud.Request) { r.MachineType = "n2-standard-2" }, want: []string{"machineType=invalid"}},
+		{name: "size allowed in prod", change: func(r *cloud.Request) { r.Environment, r.MachineType = "prod", "n2-standard-2" }},
+		{name: "required size", rules: func(r *Rules) { r.RequireInstanceType, r.Provider = true, "oci" },
+			change: func(r *cloud.Request) {}, want: []string{"machineType=required", "tier=not_configured"}},
+		{name: "bad wait timeout", change: func(r *cloud.Request) { r.WaitTimeout = "-1m" }, want: []string{"waitTimeout=invalid"}},
+		{name: "unknown rollback", change: func(r *cloud.Request) { r.Rollback = "some" }, want: []string{"rollback=invalid"}},
+		{name: "user data and template", change: func(r *cloud.Request) { r.UserData, r.Template = "#!/bin/sh", "base" },
+			want: []string{"template=invalid"}},
+		{name: "ssh key on windows", change: func(r *cloud.Request) { r.Osname, r.OsFlavor, r.SSHKey = "windows", "2019", "ops" },
+			want: []string{"sshKey=invalid"}},
+		{name: "key name off aws", change: func(r *cloud.Request) { r.KeyName = "ops" }, want: []string{"keyName=invalid"}},
+		{name: "several errors at once", change: func(r *cloud.Request) { r.AppCode, r.Disks = "", "" },
+			want: []string{"appCode=required", "disks=required"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules := testRules
+			if tt.rules != nil {
+				tt.rules(&rules)
+			}
+			req := validRequest()
+			tt.change(&req)
+			got := Provision(req, testConfig, rules)
+			if len(tt.want) == 0 {
+				if got != nil {
+					t.Fatalf("Provision() = %v, want nil", got)
+				}
+				return
+			}
+			if !reflect.DeepEqual(codes(got), tt.want) {
+				t.Errorf("Provision() = %v, want %v", codes(got), tt.want)
+			}
+		})
+	}
+}
+
+func TestProvisionAzureResourceGroup(t *testing.T) {
+
+	cfg := &config.Config{
+		Providers:    map[string]config.ProviderDefaults{"azure": {}},
+		Environments: map[string]config.Environment{"dev": {"web": {"azure": {Network: "vnet", Subnet: "web"}}}},
+	}
+	rules := Rules{Provider: "azure", OS: map[string][]string{"redhat": {}}, CountMode: CountRange}
+	tests := []struct {
+		rg   string
+		want []string
+	}{
+		{rg: "", want: []string{"resourceGroup=required"}},
+		{rg: "dev-app_rg.01(web)", want: []string{}},
+		{rg: strings.Repeat("r", 90), want: []string{}},
+		{rg: strings.Repeat("r", 91), want: []string{"resourceGroup=invalid"}},
+		{rg: "rg.", want: []string{"resourceGroup=invalid"}},
+		{rg: "../keys", want: []string{"resourceGroup=invalid"}},
+		{rg: "dev/rg", want: []string{"resourceGroup=invalid"}},
+		{rg: "dev rg", want: []string{"resourceGroup=invalid"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.rg, func(t *testing.T) {
+			req := validRequest()
+			req.RG = tt.rg
+			if got := codes(Provision(req, cfg, rules)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Provision() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIdentityAndDescribe(t *testing.T) {
+
+	rules := Rules{Identity: []string{"instanceName", "zone"}, Lookup: []string{"instanceIds", "requestNum"}}
+	tests := []struct {
+		name         string
+		req          cloud.Request
+		wantIdentity []string
+		wantDescribe []string
+	}{
+		{name: "name only", req: cloud.Request{Instance: "gcpbxwdabc01"},
+			wantDescribe: []string{"instanceIds=required", "requestNum=required"}},
+		{name: "lookup by request number", req: cloud.Request{ChangeNum: "CHG1"},
+			wantIdentity: []string{"instanceName=required"}},
+		{name: "nothing", req: cloud.Request{},
+			wantIdentity: []string{"instanceName=required"}, wantDescribe: []string{"instanceIds=required", "requestNum=required"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := codes(Identity(tt.req, rules)); !reflect.DeepEqual(got, append([]string{}, tt.wantIdentity...)) {
+				t.Errorf("Identity() = %v, want %v", got, tt.wantIdentity)
+			}
+			if got := codes(Describe(tt.req, rules)); !reflect.DeepEqual(got, append([]string{}, tt.wantDescribe...)) {
+				t.Errorf("Describe() = %v, want %v", got, tt.wantDescribe)
+			}
+		})
+	}
+}